@@ -3,39 +3,76 @@
 package eml
 
 import (
-	"errors"
+	"bytes"
 	"fmt"
+	"mime"
 	"strings"
 )
 
+// Address is an entry of an address list: a mailbox (MailboxAddr) or a
+// group of mailboxes (GroupAddr).
 type Address interface {
+	// String renders the address as it is written on a header, with the
+	// display name quoted or RFC2047 encoded when needed, so it can be
+	// parsed back by ParseAddress
 	String() string
+
+	// Name returns the decoded display name; a mailbox without one returns
+	// its email
 	Name() string
+
+	// Email returns the addr-spec of a mailbox (local@domain), empty for a
+	// group
 	Email() string
+
+	// Mailbox returns the local part of a mailbox, empty for a group
+	Mailbox() string
+
+	// Domain returns the domain of a mailbox, empty for a group
+	Domain() string
 }
 
 type MailboxAddr struct {
-	name   string
-	local  string
-	domain string
+	name     string
+	local    string
+	domain   string
+	comments []string
+}
+
+// Comments returns the decoded text of the comments written around the
+// address, such as "Automated System" in "a@b.com (Automated System)"
+func (ma MailboxAddr) Comments() []string {
+	return ma.comments
 }
 
 func (ma MailboxAddr) Name() string {
 	if ma.name == "" {
-		return fmt.Sprintf("%s@%s", ma.local, ma.domain)
+		return ma.Email()
 	}
 	return ma.name
 }
 
 func (ma MailboxAddr) String() string {
 	if ma.name == "" {
-		return fmt.Sprintf("%s@%s", ma.local, ma.domain)
+		return ma.Email()
 	}
-	return fmt.Sprintf("%s <%s@%s>", ma.name, ma.local, ma.domain)
+	return fmt.Sprintf("%s <%s>", formatPhrase(ma.name), ma.Email())
 }
 
 func (ma MailboxAddr) Email() string {
-	return fmt.Sprintf("%s@%s", ma.local, ma.domain)
+	local := ma.local
+	if local != "" && !isDotAtom(local) {
+		local = quoteString(local)
+	}
+	return fmt.Sprintf("%s@%s", local, ma.domain)
+}
+
+func (ma MailboxAddr) Mailbox() string {
+	return ma.local
+}
+
+func (ma MailboxAddr) Domain() string {
+	return ma.domain
 }
 
 type GroupAddr struct {
@@ -47,27 +84,134 @@ func (ga GroupAddr) Name() string {
 	return ga.name
 }
 
+// String renders the group as name: a@b.c, d@e.f;
 func (ga GroupAddr) String() string {
-	return ""
+	boxes := make([]string, len(ga.boxes))
+	for i, ma := range ga.boxes {
+		boxes[i] = ma.String()
+	}
+	if len(boxes) == 0 {
+		return formatPhrase(ga.name) + ":;"
+	}
+	return fmt.Sprintf("%s: %s;", formatPhrase(ga.name), strings.Join(boxes, ", "))
+}
+
+// Mailboxes returns the members of the group, none for an empty group such
+// as "undisclosed-recipients:;"
+func (ga GroupAddr) Mailboxes() []MailboxAddr {
+	return ga.boxes
 }
 
 func (ga GroupAddr) Email() string {
 	return ""
 }
 
-func ParseAddress(bs []byte) (Address, error) {
+func (ga GroupAddr) Mailbox() string {
+	return ""
+}
 
-	// UTF8 decode the address list
-	dd, e := decodeRFC2047(bs)
-	if e == nil {
-		bs = []byte(dd)
+func (ga GroupAddr) Domain() string {
+	return ""
+}
+
+// check if s can be written as a dot-atom, without quoting
+func isDotAtom(s string) bool {
+	if s == "" || s[0] == '.' || s[len(s)-1] == '.' || strings.Contains(s, "..") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '.' && !isAtext(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// write s as a quoted-string
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// write a display name as a phrase: RFC2047 encoded when it is not ASCII,
+// quoted when it has specials
+func formatPhrase(name string) string {
+	// the specials are not allowed in the Q encoded-words of a phrase
+	if !isASCII(name) {
+		if strings.ContainsAny(name, `()<>[]:;@\,."`) {
+			return mime.BEncoding.Encode("utf-8", name)
+		}
+		return mime.QEncoding.Encode("utf-8", name)
+	}
+
+	for _, w := range strings.Fields(name) {
+		if !isDotAtom(w) || strings.Contains(w, ".") {
+			return quoteString(name)
+		}
 	}
 
+	if strings.Join(strings.Fields(name), " ") != name {
+		return quoteString(name)
+	}
+
+	return name
+}
+
+// get the decoded text of the words of a phrase (a display name or a group
+// name): quoted-strings are unquoted, and encoded-words are decoded. the
+// encoded-words found inside quoted-strings are decoded too, as many
+// clients write them that way
+func decodePhrase(ts []token) string {
+	words := make([]string, 0, len(ts))
+	for _, t := range ts {
+		if len(t) > 1 && t[0] == '"' && t[len(t)-1] == '"' {
+			var w []byte
+			for i := 1; i < len(t)-1; i++ {
+				if t[i] == '\\' && i < len(t)-2 {
+					i++
+				}
+				w = append(w, t[i])
+			}
+			words = append(words, string(w))
+			continue
+		}
+		words = append(words, string(t))
+	}
+
+	d, _ := Decode([]byte(strings.Join(words, " ")))
+
+	return strings.TrimSpace(string(d))
+}
+
+// canonical form of a mailbox used to compare addresses. the local part and
+// the domain are lowercased, as virtually every server ignores their case
+func canonicalMailbox(ma MailboxAddr) MailboxAddr {
+	ma.local = strings.ToLower(strings.TrimSpace(ma.local))
+	ma.domain = strings.ToLower(strings.TrimSpace(ma.domain))
+	return ma
+}
+
+// flatten an address list into its mailboxes, expanding the groups
+func mailboxes(list []Address) (boxes []MailboxAddr) {
+	for _, a := range list {
+		switch a := a.(type) {
+		case MailboxAddr:
+			boxes = append(boxes, a)
+		case GroupAddr:
+			boxes = append(boxes, a.boxes...)
+		}
+	}
+	return
+}
+
+func ParseAddress(bs []byte) (Address, error) {
 	toks, err := tokenize(bs)
 	if err != nil {
-		return nil, err
+		return nil, locateAddressError(bs, err)
 	}
-	return parseAddress(toks)
+
+	a, err := parseAddress(toks)
+
+	return a, locateAddressError(bs, err)
 }
 
 func parseAddress(toks []token) (Address, error) {
@@ -85,10 +229,13 @@ func parseAddress(toks []token) (Address, error) {
 		if err != nil {
 			return nil, err
 		}
+		var words []token
 		for _, nt := range nts {
-			ga.name += string(nt) + " "
+			if !isComment(nt) {
+				words = append(words, nt)
+			}
 		}
-		ga.name = strings.TrimSpace(ga.name)
+		ga.name = decodePhrase(words)
 		ga.boxes = []MailboxAddr{}
 
 		last := 0
@@ -115,7 +262,7 @@ func splitOn(ts []token, s token) ([]token, []token, error) {
 			return ts[:i], ts[i+1:], nil
 		}
 	}
-	return nil, nil, errors.New("split token not found")
+	return nil, nil, addressError(fmt.Sprintf("missing %q", s), ts[len(ts)-1])
 }
 
 func parseMailboxAddr(ts []token) (ma MailboxAddr, err error) {
@@ -123,6 +270,22 @@ func parseMailboxAddr(ts []token) (ma MailboxAddr, err error) {
 	// characters up to "<" constitute the name. Otherwise, there is no
 	// name.
 	ma = MailboxAddr{}
+
+	// keep the comments apart from the address
+	var rest []token
+	for _, t := range ts {
+		if isComment(t) {
+			ma.comments = append(ma.comments, decodeComment(t))
+			continue
+		}
+		rest = append(rest, t)
+	}
+
+	ts = rest
+	if len(ts) == 0 {
+		return
+	}
+
 	ltok := ts[len(ts)-1]
 	if len(ltok) == 1 && ltok[0] == '>' {
 		var nts, ats []token
@@ -130,10 +293,7 @@ func parseMailboxAddr(ts []token) (ma MailboxAddr, err error) {
 		if err != nil {
 			return
 		}
-		for _, nt := range nts {
-			ma.name += string(nt) + " "
-		}
-		ma.name = strings.TrimSpace(ma.name)
+		ma.name = decodePhrase(nts)
 		ma.local, ma.domain, err = parseSimpleAddr(ats[:len(ats)-1])
 		return
 	}
@@ -141,6 +301,21 @@ func parseMailboxAddr(ts []token) (ma MailboxAddr, err error) {
 	return
 }
 
+// get the text of a comment token, without its parenthesis and quoted-pairs
+func decodeComment(t token) string {
+	var c []byte
+	for i := 1; i < len(t)-1; i++ {
+		if t[i] == '\\' && i < len(t)-2 {
+			i++
+		}
+		c = append(c, t[i])
+	}
+
+	d, _ := Decode(bytes.TrimSpace(c))
+
+	return string(d)
+}
+
 func parseSimpleAddr(ts []token) (l, d string, e error) {
 	// Check if there are tokens to analyize, otherwise a panic will occur
 	if len(ts) <= 1 {
@@ -149,12 +324,19 @@ func parseSimpleAddr(ts []token) (l, d string, e error) {
 
 	// The second token must be '@' - all further tokens are stuck in the domain.
 	l = string(ts[0])
+	if len(l) > 1 && l[0] == '"' && l[len(l)-1] == '"' {
+		l = decodePhrase(ts[:1])
+	}
 	if !(len(ts[1]) == 1 && ts[1][0] == '@') {
-		return "", "", errors.New("invalid simpleAddr")
+		return "", "", addressError("invalid simpleAddr", ts[1])
 	}
-	for _, dp := range ts[2:] {
-		d += string(dp) + " "
+	// the tokens of a domain literal are joined back without the spaces
+	// around its brackets and before its commas
+	for i, dp := range ts[2:] {
+		if i > 0 && string(ts[i+1]) != "[" && string(dp) != "]" && string(dp) != "," {
+			d += " "
+		}
+		d += string(dp)
 	}
-	d = strings.TrimSpace(d)
 	return
 }
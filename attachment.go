@@ -0,0 +1,241 @@
+// Attachment helpers.
+
+package eml
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// common types missing from the builtin table of the mime package, which
+// depends on the files of the system for them
+var extensionTypes = map[string]string{
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".zip":  "application/zip",
+	".txt":  "text/plain",
+	".csv":  "text/csv",
+	".ics":  "text/calendar",
+	".eml":  "message/rfc822",
+}
+
+// GuessedContentType returns the media type of the attachment. When it was
+// declared with a generic type (application/octet-stream), as some
+// generators do for everything, the type is guessed from the extension of
+// the filename; application/octet-stream is returned when it is unknown.
+func (a Attachment) GuessedContentType() string {
+	if a.MIMEType != "" && a.MIMEType != "application/octet-stream" {
+		return a.MIMEType
+	}
+
+	ext := strings.ToLower(filepath.Ext(a.Filename))
+	if t, ok := extensionTypes[ext]; ok {
+		return t
+	}
+
+	if t := mime.TypeByExtension(ext); t != "" {
+		if mt, _, err := mime.ParseMediaType(t); err == nil {
+			return mt
+		}
+	}
+
+	return "application/octet-stream"
+}
+
+// hex encoded SHA-256 digest of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// name parameters of a Content-Disposition, with their RFC2231 section
+// number and extended flag: filename, filename*, filename*0 or filename*0*.
+// a quoted value may hold backslash-escaped quotes
+var filenameParamR = regexp.MustCompile(`(?i)(?:^|;)\s*(filename|name)(?:\*(\d+))?(\*)?\s*=\s*("(?:[^"\\]|\\.)*"?|[^;\s]*)`)
+
+// the folds of a header value, whose line break is removed by unfolding
+var foldR = regexp.MustCompile(`\r?\n([ \t])`)
+
+// the quoted-pairs of a quoted-string
+var quotedPairR = regexp.MustCompile(`\\(.)`)
+
+// get the filename of a Content-Disposition. mime.ParseMediaType handles
+// the well formed values, the others are read parameter by parameter: the
+// RFC2231 sections (filename*0, filename*1...) are joined and the extended
+// values (charset'language'percent-encoded) are decoded to UTF-8. the name
+// parameter, sent by some clients, is used when there is no filename
+func dispositionFilename(cd string) (string, bool) {
+	if _, ps, err := mime.ParseMediaType(cd); err == nil && ps["filename"] != "" {
+		return ps["filename"], true
+	}
+
+	// the value may still be folded, within a quoted filename too
+	cd = foldR.ReplaceAllString(cd, "$1")
+
+	for _, key := range []string{"filename", "name"} {
+		plain := ""
+		sections := make(map[int]string)
+		extended := make(map[int]bool)
+
+		for _, m := range filenameParamR.FindAllStringSubmatch(cd, -1) {
+			if !strings.EqualFold(m[1], key) {
+				continue
+			}
+
+			v := m[4]
+			if strings.HasPrefix(v, `"`) {
+				v = quotedPairR.ReplaceAllString(strings.TrimSuffix(v[1:], `"`), "$1")
+			}
+			switch {
+			case m[2] != "":
+				n, _ := strconv.Atoi(m[2])
+				sections[n], extended[n] = v, m[3] != ""
+			case m[3] != "":
+				sections[0], extended[0] = v, true
+			default:
+				plain = v
+			}
+		}
+
+		if len(sections) == 0 {
+			if plain != "" {
+				return plain, true
+			}
+			continue
+		}
+
+		// the charset is only written on the first section
+		var raw []byte
+		charset := ""
+		for i := 0; i < len(sections); i++ {
+			v, ok := sections[i]
+			if !ok {
+				break
+			}
+
+			if !extended[i] {
+				raw = append(raw, v...)
+				continue
+			}
+
+			if i == 0 {
+				if parts := strings.SplitN(v, "'", 3); len(parts) == 3 {
+					charset, v = parts[0], parts[2]
+				}
+			}
+
+			if d, err := url.PathUnescape(v); err == nil {
+				v = d
+			}
+			raw = append(raw, v...)
+		}
+
+		if charset != "" {
+			if d, err := UTF8(charset, raw); err == nil {
+				raw = d
+			}
+		}
+
+		return string(raw), true
+	}
+
+	return "", false
+}
+
+// get the filename of a part: the filename of its Content-Disposition,
+// else the name parameter of its Content-Type. the name is still raw, as
+// found in the header
+func partFilename(part Part) (string, bool) {
+	h := textproto.MIMEHeader(part.Headers)
+
+	if filename, ok := dispositionFilename(h.Get("Content-Disposition")); ok {
+		return filename, true
+	}
+	if part.Params["name"] != "" {
+		return part.Params["name"], true
+	}
+
+	return dispositionFilename(h.Get("Content-Type"))
+}
+
+// get the filename of an attachment, as found by partFilename, else a
+// generated attachment-<n>.bin
+func attachmentFilename(part Part, n int) string {
+	if filename, ok := partFilename(part); ok {
+		return filename
+	}
+
+	return fmt.Sprintf("attachment-%d.bin", n)
+}
+
+// pick the attachments among the parts, as told by isAttachment or, when
+// nil, by their Content-Disposition, leaving out the parts giving the text
+// and HTML bodies. they are mapped from their index in parts to their
+// number, counted from 1, which names the ones without a filename
+func attachmentParts(parts []Part, isAttachment func(Part) bool) map[int]int {
+	if isAttachment == nil {
+		isAttachment = defaultIsAttachment
+	}
+
+	text, html, _ := bodyParts(parts)
+
+	attachments := make(map[int]int)
+	for k, p := range parts {
+		if k != text && k != html && isAttachment(p) {
+			attachments[k] = len(attachments) + 1
+		}
+	}
+
+	return attachments
+}
+
+// WalkAttachments calls fn for each attachment of the message, with a
+// reader decoding its data on the fly from the encoded data kept in Parts,
+// as Attachments would hold it. Parse with ParseOptions.SkipAttachmentData
+// so the decoded attachments are not held in memory too. The walk stops at
+// the first error returned by fn, or at an unknown transfer encoding. The
+// attachments and their names are the ones of Attachments, as told by the
+// ParseOptions.IsAttachment the message was parsed with.
+func (m Message) WalkAttachments(fn func(name, mimeType string, r io.Reader) error) error {
+	attachments := attachmentParts(m.Parts, m.isAttachment)
+
+	// a single part message is encoded as its headers say
+	msgHeaders := m.ParsedHeaders
+	if isCompositeType(m.ContentType) {
+		msgHeaders = nil
+	}
+
+	for k, p := range m.Parts {
+		n, ok := attachments[k]
+		if !ok {
+			continue
+		}
+
+		name, _ := Decode(rawHeaderToUTF8([]byte(attachmentFilename(p, n)), ParseOptions{}))
+
+		r, _, err := transferDecoder(transferEncoding(msgHeaders, p.Headers), p.Data)
+		if err != nil {
+			return fmt.Errorf("attachment %q: %w", name, err)
+		}
+
+		if err := fn(string(name), strings.ToLower(strings.TrimSpace(strings.Split(p.Type, ";")[0])), r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
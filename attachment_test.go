@@ -0,0 +1,693 @@
+package eml
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// a text body, a text file and an unnamed PDF as attachments, and an image
+// shown inline
+const attachmentsMessage = `From: a@example.com
+Content-Type: multipart/mixed; boundary=b
+
+--b
+Content-Type: text/plain
+
+see the attached files
+--b
+Content-Type: text/plain; name=notes.txt
+Content-Disposition: attachment; filename=notes.txt
+
+some notes
+--b
+Content-Type: application/pdf
+Content-Disposition: attachment
+
+%PDF-1.4
+--b
+Content-Type: image/png; name=logo.png
+Content-Disposition: inline
+Content-ID: <logo@example.com>
+Content-Transfer-Encoding: base64
+
+iVBORw0KGgo=
+--b--
+`
+
+// the names of the attachments, as found by Attachments and WalkAttachments
+func attachmentNames(t *testing.T, m Message) (parsed, walked []string) {
+	for _, a := range m.Attachments {
+		parsed = append(parsed, a.Filename)
+	}
+
+	err := m.WalkAttachments(func(name, mimeType string, r io.Reader) error {
+		walked = append(walked, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestAttachments(t *testing.T) {
+	m, errs := Parse(crlf(attachmentsMessage))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.Text != "see the attached files" {
+		t.Errorf("Text %q", m.Text)
+	}
+
+	want := "notes.txt,attachment-2.bin"
+	parsed, walked := attachmentNames(t, m)
+	if got := strings.Join(parsed, ","); got != want {
+		t.Errorf("Attachments %q, want %q", got, want)
+	}
+	if got := strings.Join(walked, ","); got != want {
+		t.Errorf("WalkAttachments %q, want %q", got, want)
+	}
+
+	if len(m.Inlines) != 1 || m.Inlines[0].ContentID != "logo@example.com" {
+		t.Errorf("Inlines %+v", m.Inlines)
+	}
+}
+
+func TestIsAttachmentInlineAsAttachment(t *testing.T) {
+	// any part with a name is an attachment, inline or not
+	opts := ParseOptions{IsAttachment: func(p Part) bool {
+		return defaultIsAttachment(p) || p.Params["name"] != ""
+	}}
+
+	m, errs := ParseWithOptions(crlf(attachmentsMessage), opts)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := "notes.txt,attachment-2.bin,logo.png"
+	parsed, walked := attachmentNames(t, m)
+	if got := strings.Join(parsed, ","); got != want {
+		t.Errorf("Attachments %q, want %q", got, want)
+	}
+	if got := strings.Join(walked, ","); got != want {
+		t.Errorf("WalkAttachments %q, want %q", got, want)
+	}
+
+	if len(m.Inlines) != 0 {
+		t.Errorf("Inlines %+v", m.Inlines)
+	}
+	if a := m.Attachments[2]; a.MIMEType != "image/png" || a.Size != 8 {
+		t.Errorf("logo.png %+v", a)
+	}
+}
+
+func TestIsAttachmentAttachmentAsInline(t *testing.T) {
+	// the images are shown inline, whatever their disposition
+	raw := strings.Replace(attachmentsMessage, "Content-Disposition: inline", "Content-Disposition: attachment", 1)
+	opts := ParseOptions{IsAttachment: func(p Part) bool {
+		return defaultIsAttachment(p) && !strings.HasPrefix(p.Type, "image/")
+	}}
+
+	m, errs := ParseWithOptions(crlf(raw), opts)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := "notes.txt,attachment-2.bin"
+	parsed, walked := attachmentNames(t, m)
+	if got := strings.Join(parsed, ","); got != want {
+		t.Errorf("Attachments %q, want %q", got, want)
+	}
+	if got := strings.Join(walked, ","); got != want {
+		t.Errorf("WalkAttachments %q, want %q", got, want)
+	}
+
+	if len(m.Inlines) != 1 || m.Inlines[0].Filename != "logo.png" {
+		t.Errorf("Inlines %+v", m.Inlines)
+	}
+}
+
+// a message with an attachment of size bytes, base64 encoded on 76
+// character lines
+func largeAttachmentMessage(size int) (raw []byte, data []byte) {
+	data = make([]byte, size)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	b.WriteString("Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\nContent-Type: text/plain\r\n\r\nhello\r\n")
+	b.WriteString("--b\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=big.bin\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n--b--\r\n")
+
+	return []byte(b.String()), data
+}
+
+func TestWalkAttachmentsLarge(t *testing.T) {
+	raw, data := largeAttachmentMessage(8 << 20)
+	want := sha256.Sum256(data)
+
+	m, errs := Parse(raw)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	walked := 0
+	err := m.WalkAttachments(func(name, mimeType string, r io.Reader) error {
+		walked++
+		if name != "big.bin" || mimeType != "application/octet-stream" {
+			t.Errorf("attachment %q of type %q", name, mimeType)
+		}
+
+		h := sha256.New()
+		n, err := io.Copy(h, r)
+		if err != nil {
+			return err
+		}
+		if n != int64(len(data)) {
+			t.Errorf("%d bytes streamed, want %d", n, len(data))
+		}
+		if !bytes.Equal(h.Sum(nil), want[:]) {
+			t.Error("SHA-256 of the streamed data differs")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walked != 1 {
+		t.Errorf("%d attachments walked, want 1", walked)
+	}
+	if m.Attachments[0].SHA256 != hex.EncodeToString(want[:]) {
+		t.Errorf("Attachments SHA256 %s", m.Attachments[0].SHA256)
+	}
+}
+
+func TestWalkAttachmentsEncodings(t *testing.T) {
+	raw := `Content-Type: multipart/mixed; boundary=b
+
+--b
+Content-Type: text/plain
+
+hello
+--b
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename=url.bin
+Content-Transfer-Encoding: base64
+
+-_-_
+--b
+Content-Type: text/plain
+Content-Disposition: attachment; filename=qp.txt
+Content-Transfer-Encoding: Quoted-Printable
+
+caf=C3=A9 =
+au lait
+--b
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename=uu.bin
+Content-Transfer-Encoding: x-uuencode
+
+begin 644 uu.bin
+#0V%T
+` + "`" + `
+end
+--b
+Content-Type: message/rfc822
+Content-Disposition: attachment; filename=fwd.eml
+Content-Transfer-Encoding: base64
+
+Subject: not decoded
+--b--
+`
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	var walked [][]byte
+	err := m.WalkAttachments(func(name, mimeType string, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		walked = append(walked, data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(walked) != len(m.Attachments) || len(walked) != 4 {
+		t.Fatalf("%d attachments walked, %d parsed", len(walked), len(m.Attachments))
+	}
+	for i, a := range m.Attachments {
+		if !bytes.Equal(walked[i], a.Data) {
+			t.Errorf("%s: walked %q, parsed %q", a.Filename, walked[i], a.Data)
+		}
+	}
+	if string(walked[2]) != "Cat" {
+		t.Errorf("uuencoded data %q", walked[2])
+	}
+}
+
+func TestWalkAttachmentsSinglePart(t *testing.T) {
+	// the transfer encoding of the only part is in the message headers
+	raw := "Content-Type: application/pdf\r\nContent-Transfer-Encoding: base64\r\n\r\nJVBERi0xLjQK\r\n"
+	opts := ParseOptions{IsAttachment: func(p Part) bool { return p.Type == "application/pdf" }}
+
+	m, errs := ParseWithOptions([]byte(raw), opts)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	var walked []byte
+	err := m.WalkAttachments(func(name, mimeType string, r io.Reader) error {
+		var err error
+		walked, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Attachments) != 1 || string(walked) != "%PDF-1.4\n" || !bytes.Equal(walked, m.Attachments[0].Data) {
+		t.Errorf("walked %q, parsed %+v", walked, m.Attachments)
+	}
+}
+
+func TestWalkAttachmentsStop(t *testing.T) {
+	m, errs := Parse(crlf(attachmentsMessage))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	stop := errors.New("stop")
+	var walked []string
+	err := m.WalkAttachments(func(name, mimeType string, r io.Reader) error {
+		walked = append(walked, name)
+		return stop
+	})
+	if err != stop {
+		t.Errorf("err = %v", err)
+	}
+	if len(walked) != 1 || walked[0] != "notes.txt" {
+		t.Errorf("walked %q", walked)
+	}
+}
+
+func TestSkipAttachmentData(t *testing.T) {
+	raw := `Content-Type: multipart/mixed; boundary=b
+
+--b
+Content-Type: text/plain
+
+hello
+--b
+Content-Type: application/pdf
+Content-Disposition: attachment; filename=a.pdf
+Content-Transfer-Encoding: base64
+
+JVBERi0xLjQK
+--b--
+`
+
+	full, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	m, errs := ParseWithOptions(crlf(raw), ParseOptions{SkipAttachmentData: true})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	a := m.Attachments[0]
+	if a.Data != nil {
+		t.Errorf("Data %q", a.Data)
+	}
+	if a.Size != len("%PDF-1.4\n") || a.Size != len(full.Attachments[0].Data) {
+		t.Errorf("Size %d, want %d", a.Size, len(full.Attachments[0].Data))
+	}
+	if a.SHA256 != full.Attachments[0].SHA256 {
+		t.Errorf("SHA256 %s, want %s", a.SHA256, full.Attachments[0].SHA256)
+	}
+
+	// the encoded data is still streamed
+	var walked []byte
+	err := m.WalkAttachments(func(name, mimeType string, r io.Reader) error {
+		var err error
+		walked, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(walked, full.Attachments[0].Data) {
+		t.Errorf("walked %q, want %q", walked, full.Attachments[0].Data)
+	}
+	if m.Text != "hello" {
+		t.Errorf("Text %q", m.Text)
+	}
+}
+
+func TestInlineFilename(t *testing.T) {
+	for _, c := range []struct {
+		headers, want string
+	}{
+		{"Content-Type: image/png; name=logo.png\nContent-Disposition: inline", "logo.png"},
+		{"Content-Type: image/png\nContent-Disposition: inline; filename*0*=utf-8''caf%C3%A9; filename*1=\".png\"", "café.png"},
+		{"Content-Type: image/png\nContent-Disposition: inline; broken; filename=\"say \\\"hi\\\".png\"", `say "hi".png`},
+		{"Content-Type: image/png\nContent-Disposition: inline; size=3;\n filename=\"a long\n name.png\"", "a long name.png"},
+		{"Content-Type: image/png\nContent-Disposition: inline", ""},
+	} {
+		raw := "Content-Type: multipart/related; boundary=b\n\n--b\nContent-Type: text/html\n\n<img src=\"cid:i\">\n--b\n" +
+			c.headers + "\nContent-ID: <i>\n\nPNG\n--b--\n"
+
+		m, errs := Parse(crlf(raw))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if len(m.Inlines) != 1 || m.Inlines[0].Filename != c.want {
+			t.Errorf("%q: inlines %+v, want %q", c.headers, m.Inlines, c.want)
+		}
+	}
+}
+
+func TestAttachmentFilenameEscapes(t *testing.T) {
+	for _, c := range []struct {
+		cd, want string
+	}{
+		{`attachment; filename="weird\"name.pdf"`, `weird"name.pdf`},
+		{`attachment; broken; filename="weird\"name.pdf"`, `weird"name.pdf`},
+		{`attachment; broken; filename="back\\slash.pdf"`, `back\slash.pdf`},
+		{"attachment; broken; filename=\"folded\r\n name.pdf\"", "folded name.pdf"},
+		{`attachment; broken; filename*0="we\"ird"; filename*1=".pdf"`, `we"ird.pdf`},
+	} {
+		got, ok := dispositionFilename(c.cd)
+		if !ok || got != c.want {
+			t.Errorf("dispositionFilename(%q) = %q, want %q", c.cd, got, c.want)
+		}
+	}
+}
+
+func TestAttachmentFilenameRFC2231(t *testing.T) {
+	for _, c := range []struct {
+		cd, want string
+	}{
+		{"attachment; filename=report.pdf", "report.pdf"},
+		{"attachment; filename=\"the report.pdf\"", "the report.pdf"},
+		{"attachment; filename*=utf-8''caf%C3%A9.pdf", "café.pdf"},
+		{"attachment; filename*=iso-8859-1'fr'caf%E9.pdf", "café.pdf"},
+		{"attachment; filename*0=\"annual \"; filename*1=\"report.pdf\"", "annual report.pdf"},
+		{"attachment; filename*0*=utf-8''%E6%96%87; filename*1*=%E4%BB%B6.pdf", "文件.pdf"},
+		{"attachment;\n filename*0*=utf-8''%E6%96%87;\n filename*1=\".pdf\"", "文.pdf"},
+	} {
+		raw := "Content-Type: multipart/mixed; boundary=b\n\n" +
+			"--b\nContent-Type: text/plain\n\nhello\n" +
+			"--b\nContent-Type: application/pdf\nContent-Disposition: " + c.cd + "\n\n%PDF-1.4\n" +
+			"--b--\n"
+
+		m, errs := Parse(crlf(raw))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		parsed, walked := attachmentNames(t, m)
+		if len(parsed) != 1 || parsed[0] != c.want || walked[0] != c.want {
+			t.Errorf("%q: attachments %q, walked %q, want %q", c.cd, parsed, walked, c.want)
+		}
+	}
+}
+
+func TestAttachmentFilenameFallback(t *testing.T) {
+	raw := `Content-Type: multipart/mixed; boundary=b
+
+--b
+Content-Type: text/plain
+
+hello
+--b
+Content-Type: application/pdf; name=type.pdf
+Content-Disposition: attachment; filename=disposition.pdf
+
+%PDF-1.4
+--b
+Content-Type: application/pdf; name="only type.pdf"
+Content-Disposition: attachment
+
+%PDF-1.4
+--b
+Content-Type: application/pdf
+Content-Disposition: attachment
+
+%PDF-1.4
+--b
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename=""
+
+data
+--b--
+`
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := "disposition.pdf,only type.pdf,attachment-3.bin,attachment-4.bin"
+	parsed, walked := attachmentNames(t, m)
+	if got := strings.Join(parsed, ","); got != want {
+		t.Errorf("Attachments %q, want %q", got, want)
+	}
+	if got := strings.Join(walked, ","); got != want {
+		t.Errorf("WalkAttachments %q, want %q", got, want)
+	}
+}
+
+func TestURLSafeBase64Attachment(t *testing.T) {
+	data := []byte{0xfb, 0xff, 0xbf, 0xfe, 0x00}
+
+	for _, c := range []struct {
+		name    string
+		enc     *base64.Encoding
+		warning string
+	}{
+		{"standard", base64.StdEncoding, ""},
+		{"unpadded standard", base64.RawStdEncoding, "base64 data decoded with the unpadded standard alphabet"},
+		{"URL-safe", base64.URLEncoding, "base64 data decoded with the URL-safe alphabet"},
+		{"unpadded URL-safe", base64.RawURLEncoding, "base64 data decoded with the unpadded URL-safe alphabet"},
+	} {
+		encoded := c.enc.EncodeToString(data)
+		if _, err := base64.StdEncoding.DecodeString(encoded); (err == nil) != (c.warning == "") {
+			t.Fatalf("%s: %q is valid standard base64: %v", c.name, encoded, err == nil)
+		}
+
+		raw := "Content-Type: multipart/mixed; boundary=b\n\n" +
+			"--b\nContent-Type: text/plain\n\nhello\n" +
+			"--b\nContent-Type: application/octet-stream\n" +
+			"Content-Disposition: attachment; filename=data.bin\n" +
+			"Content-Transfer-Encoding: base64\n\n" + encoded + "\n" +
+			"--b--\n"
+
+		m, errs := Parse(crlf(raw))
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", c.name, errs)
+			continue
+		}
+
+		if len(m.Attachments) != 1 || !bytes.Equal(m.Attachments[0].Data, data) {
+			t.Errorf("%s: attachments %v", c.name, m.Attachments)
+		}
+
+		var warnings []string
+		for _, w := range m.Warnings {
+			warnings = append(warnings, string(w))
+		}
+		if c.warning == "" && len(warnings) > 0 || c.warning != "" && strings.Join(warnings, "\n") != c.warning {
+			t.Errorf("%s: warnings %q", c.name, warnings)
+		}
+	}
+}
+
+func TestRawFilename(t *testing.T) {
+	for _, c := range []struct {
+		name, disposition, charset, want string
+	}{
+		{"utf-8", "attachment; filename=\"Größe.pdf\"", "windows-1252", "Größe.pdf"},
+		{"latin-1", "attachment; filename=\"Gr\xf6\xdfe.pdf\"", "iso-8859-1", "Größe.pdf"},
+		{"latin-1 sniffed", "attachment; filename=\"Gr\xf6\xdfe.pdf\"", "", "Größe.pdf"},
+		{"latin-1 unquoted", "attachment; filename=r\xe9sum\xe9.pdf", "iso-8859-1", "résumé.pdf"},
+		{"koi8-r", "attachment; filename=\"\xf3\xde\xc5\xd4.txt\"", "koi8-r", "Счет.txt"},
+		{"encoded-word", "attachment; filename=\"=?utf-8?q?Gr=C3=B6=C3=9Fe.pdf?=\"", "koi8-r", "Größe.pdf"},
+	} {
+		raw := "Content-Type: multipart/mixed; boundary=b\n\n" +
+			"--b\nContent-Type: text/plain\n\nhello\n" +
+			"--b\nContent-Type: application/octet-stream\nContent-Disposition: " + c.disposition + "\n\ndata\n" +
+			"--b--\n"
+
+		m, errs := ParseWithOptions(crlf(raw), ParseOptions{DefaultCharset: c.charset})
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", c.name, errs)
+			continue
+		}
+
+		if len(m.Attachments) != 1 || m.Attachments[0].Filename != c.want {
+			t.Errorf("%s: attachments %+v, want %q", c.name, m.Attachments, c.want)
+		}
+	}
+}
+
+func TestGuessedContentType(t *testing.T) {
+	for _, c := range []struct {
+		filename, mimeType, want string
+	}{
+		{"report.pdf", "application/octet-stream", "application/pdf"},
+		{"Report.PDF", "application/octet-stream", "application/pdf"},
+		{"letter.docx", "application/octet-stream", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"sheet.xlsx", "", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"photo.jpeg", "application/octet-stream", "image/jpeg"},
+		{"data.unknownext", "application/octet-stream", "application/octet-stream"},
+		{"noextension", "application/octet-stream", "application/octet-stream"},
+		{"report.pdf", "image/png", "image/png"},
+	} {
+		a := Attachment{Filename: c.filename, MIMEType: c.mimeType}
+		if got := a.GuessedContentType(); got != c.want {
+			t.Errorf("%s (%s): %q, want %q", c.filename, c.mimeType, got, c.want)
+		}
+	}
+}
+
+func TestAttachmentSizeLimits(t *testing.T) {
+	raw, _ := largeAttachmentMessage(1 << 20)
+
+	m, errs := ParseWithOptions(raw, ParseOptions{MaxAttachmentBytes: 64 << 10})
+	if len(m.Attachments) != 0 {
+		t.Errorf("%d attachments over the limit kept", len(m.Attachments))
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `attachment "big.bin" skipped`) || !strings.Contains(errs[0].Error(), "over the limit of 65536") {
+		t.Errorf("errors = %v", errs)
+	}
+	if m.Text != "hello" {
+		t.Errorf("Text = %q", m.Text)
+	}
+
+	// the attachment fits the limit
+	m, errs = ParseWithOptions(raw, ParseOptions{MaxAttachmentBytes: 2 << 20})
+	if len(errs) > 0 || len(m.Attachments) != 1 || m.Attachments[0].Size != 1<<20 {
+		t.Errorf("%d attachments, errors %v", len(m.Attachments), errs)
+	}
+}
+
+func TestTotalSizeLimit(t *testing.T) {
+	raw := crlf("Content-Type: multipart/mixed; boundary=b\n\n" +
+		"--b\nContent-Type: text/plain\n\nhello\n" +
+		"--b\nContent-Type: text/plain\nContent-Disposition: attachment; filename=one.txt\n\n" + strings.Repeat("1", 100) + "\n" +
+		"--b\nContent-Type: text/plain\nContent-Disposition: attachment; filename=two.txt\n\n" + strings.Repeat("2", 100) + "\n" +
+		"--b--\n")
+
+	m, errs := ParseWithOptions(raw, ParseOptions{MaxTotalBytes: 150})
+	if got, _ := attachmentNames(t, m); len(got) != 1 || got[0] != "one.txt" {
+		t.Errorf("attachments = %q", got)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `attachment "two.txt" skipped`) || !strings.Contains(errs[0].Error(), "total over the limit of 150") {
+		t.Errorf("errors = %v", errs)
+	}
+	if m.Text != "hello" {
+		t.Errorf("Text = %q", m.Text)
+	}
+}
+
+func TestPartsLimit(t *testing.T) {
+	m, errs := ParseWithOptions(crlf(attachmentsMessage), ParseOptions{MaxParts: 1})
+	if len(m.Parts) != 1 {
+		t.Errorf("%d parts", len(m.Parts))
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "over the limit of 1 are dropped") {
+		t.Errorf("errors = %v", errs)
+	}
+}
+
+func TestAttachmentTransferEncodings(t *testing.T) {
+	tests := []struct {
+		encoding, body, data string
+		err                  bool
+	}{
+		{"7bit", "plain ascii", "plain ascii", false},
+		{"8bit", "caf\xc3\xa9", "caf\xc3\xa9", false},
+		{"Binary", "\x00\x01\xff", "\x00\x01\xff", false},
+		{"base64", "Q2F0", "Cat", false},
+		{"quoted-printable", "caf=C3=A9", "caf\xc3\xa9", false},
+		{"x-uuencode", "begin 644 a.bin\r\n#0V%T\r\n`\r\nend", "Cat", false},
+		{"x-unknown", "Q2F0", "Q2F0", true},
+	}
+
+	for _, tt := range tests {
+		raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+			"--b\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=a.bin\r\n" +
+			"Content-Transfer-Encoding: " + tt.encoding + "\r\n\r\n" + tt.body + "\r\n--b--\r\n"
+
+		m, errs := Parse([]byte(raw))
+		if tt.err {
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), `unknown transfer encoding "x-unknown"`) {
+				t.Errorf("%s: errors = %v", tt.encoding, errs)
+			}
+		} else if len(errs) > 0 {
+			t.Errorf("%s: errors = %v", tt.encoding, errs)
+		}
+
+		if len(m.Attachments) != 1 || string(m.Attachments[0].Data) != tt.data {
+			t.Errorf("%s: attachments %+v", tt.encoding, m.Attachments)
+		}
+	}
+}
+
+func TestAttachmentSHA256(t *testing.T) {
+	pdf := "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\n%%EOF\n"
+	encoded := base64.StdEncoding.EncodeToString([]byte(pdf))
+
+	message := func(filename, cte, body string) Message {
+		raw := "Content-Type: multipart/mixed; boundary=b\n\n" +
+			"--b\nContent-Type: text/plain\n\nsee the file\n" +
+			"--b\nContent-Type: application/pdf\nContent-Disposition: attachment; filename=" + filename + "\n" +
+			"Content-Transfer-Encoding: " + cte + "\n\n" + body + "\n" +
+			"--b--\n"
+
+		m, errs := Parse(crlf(raw))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if len(m.Attachments) != 1 {
+			t.Fatalf("%d attachments", len(m.Attachments))
+		}
+		return m
+	}
+
+	// the same file, encoded differently and named differently
+	a := message("report.pdf", "base64", encoded)
+	b := message("copy.pdf", "base64", encoded[:20]+"\n"+encoded[20:])
+	other := message("report.pdf", "base64", base64.StdEncoding.EncodeToString([]byte(pdf+"\n")))
+
+	sum := sha256.Sum256([]byte(pdf))
+	if a.Attachments[0].SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 %s, want %x", a.Attachments[0].SHA256, sum)
+	}
+	if b.Attachments[0].SHA256 != a.Attachments[0].SHA256 {
+		t.Errorf("SHA256 of the same file %s and %s", a.Attachments[0].SHA256, b.Attachments[0].SHA256)
+	}
+	if other.Attachments[0].SHA256 == a.Attachments[0].SHA256 {
+		t.Error("same SHA256 for different files")
+	}
+}
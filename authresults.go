@@ -0,0 +1,142 @@
+// Authentication results.
+
+package eml
+
+import (
+	"strings"
+)
+
+// AuthResult is the outcome of an authentication method, as recorded by an
+// Authentication-Results header (RFC8601)
+type AuthResult struct {
+	AuthServID string            // host that ran the check, as named by the header
+	Method     string            // such as spf, dkim, dmarc or arc, lowercased
+	Result     string            // such as pass, fail, softfail, neutral or none, lowercased
+	Reason     string            // explanation given by reason=, if any
+	Properties map[string]string // such as header.d or smtp.mailfrom, keyed in lowercase
+}
+
+// split an Authentication-Results value on its ";", dropping the comments.
+// the quoted strings are kept whole, with their quotes
+func splitAuthResults(v string) (segments []string) {
+	s := []byte(v)
+	var cur []byte
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			l := commentLen(s[i:])
+			if l == 0 {
+				l = len(s) - i
+			}
+			cur = append(cur, ' ')
+			i += l - 1
+		case '"':
+			l := quotedLen(s[i:])
+			if l == 0 {
+				l = len(s) - i
+			}
+			cur = append(cur, s[i:i+l]...)
+			i += l - 1
+		case ';':
+			segments = append(segments, string(cur))
+			cur = nil
+		default:
+			cur = append(cur, s[i])
+		}
+	}
+
+	return append(segments, string(cur))
+}
+
+// read the words and key=value pairs of a segment, in order. a bare word
+// has an empty value
+func authResultPairs(segment string) (pairs [][2]string) {
+	s := strings.TrimSpace(segment)
+
+	for len(s) > 0 {
+		n := strings.IndexAny(s, " \t\r\n=")
+		if n < 0 {
+			n = len(s)
+		}
+		key := s[:n]
+		s = strings.TrimLeft(s[n:], " \t\r\n")
+
+		if !strings.HasPrefix(s, "=") {
+			pairs = append(pairs, [2]string{key, ""})
+			continue
+		}
+		s = strings.TrimLeft(s[1:], " \t\r\n")
+
+		var value string
+		if l := quotedLen([]byte(s)); strings.HasPrefix(s, `"`) && l > 0 {
+			value = strings.ReplaceAll(s[1:l-1], `\"`, `"`)
+			s = s[l:]
+		} else {
+			e := strings.IndexAny(s, " \t\r\n")
+			if e < 0 {
+				e = len(s)
+			}
+			value = s[:e]
+			s = s[e:]
+		}
+		s = strings.TrimLeft(s, " \t\r\n")
+
+		pairs = append(pairs, [2]string{key, value})
+	}
+
+	return
+}
+
+// parse an Authentication-Results header value: the authserv-id, with an
+// optional version, then a method=result clause with its properties for
+// each check, separated by ";"
+func parseAuthResults(v string) (results []AuthResult) {
+	segments := splitAuthResults(v)
+
+	servID := ""
+	if pairs := authResultPairs(segments[0]); len(pairs) > 0 {
+		servID = pairs[0][0]
+	}
+
+	for _, segment := range segments[1:] {
+		pairs := authResultPairs(segment)
+		if len(pairs) == 0 || pairs[0][1] == "" {
+			continue // "none", no check was run
+		}
+
+		// the method may carry a version, as in dkim/1=pass
+		r := AuthResult{
+			AuthServID: servID,
+			Method:     strings.ToLower(strings.SplitN(pairs[0][0], "/", 2)[0]),
+			Result:     strings.ToLower(pairs[0][1]),
+			Properties: make(map[string]string),
+		}
+
+		for _, p := range pairs[1:] {
+			switch key := strings.ToLower(p[0]); {
+			case key == "reason":
+				r.Reason = p[1]
+			case strings.Contains(key, "."):
+				r.Properties[key] = p[1]
+			}
+		}
+
+		results = append(results, r)
+	}
+
+	return
+}
+
+// AuthenticationResults returns the checks recorded by the
+// Authentication-Results headers, the most recent (the topmost header)
+// first, in the order each header lists them. Only the headers added by a
+// trusted host, told by AuthServID, should be believed, as anyone can
+// write one before sending the message.
+func (m Message) AuthenticationResults() (results []AuthResult) {
+	for _, v := range m.header("Authentication-Results") {
+		results = append(results, parseAuthResults(v)...)
+	}
+
+	return
+}
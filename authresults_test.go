@@ -0,0 +1,34 @@
+package eml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuthenticationResults(t *testing.T) {
+	raw := "Authentication-Results: mx.example.com;\n" +
+		"\tdkim=pass (2048-bit key; unprotected) header.d=example.org header.i=@example.org header.b=\"AbC+dEf\";\n" +
+		"\tspf=fail (domain of a@example.org does not designate 192.0.2.7) smtp.mailfrom=a@example.org;\n" +
+		"\tdmarc=neutral reason=\"policy test\" header.from=example.org\n" +
+		"Authentication-Results: relay.example.net 1; spf=none smtp.helo=laptop\n" +
+		"Authentication-Results: relay.example.net; none\n" +
+		"Subject: hi\n\nbody\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := []AuthResult{
+		{"mx.example.com", "dkim", "pass", "", map[string]string{
+			"header.d": "example.org", "header.i": "@example.org", "header.b": "AbC+dEf",
+		}},
+		{"mx.example.com", "spf", "fail", "", map[string]string{"smtp.mailfrom": "a@example.org"}},
+		{"mx.example.com", "dmarc", "neutral", "policy test", map[string]string{"header.from": "example.org"}},
+		{"relay.example.net", "spf", "none", "", map[string]string{"smtp.helo": "laptop"}},
+	}
+
+	if got := m.AuthenticationResults(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+// Autocrypt header parsing (https://autocrypt.org/level1.html).
+
+package eml
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+type AutocryptHeader struct {
+	Addr          string
+	PreferEncrypt string // "mutual" or empty (no preference)
+	KeyData       []byte // binary OpenPGP public key
+}
+
+// parse an Autocrypt or Autocrypt-Gossip header value. the header is
+// rejected when a required attribute is missing or when an unknown critical
+// attribute (one not starting with "_") is present
+func parseAutocrypt(v string) (h AutocryptHeader, ok bool) {
+	for _, attr := range strings.Split(v, ";") {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+
+		switch {
+		case key == "addr":
+			h.Addr = value
+		case key == "prefer-encrypt":
+			h.PreferEncrypt = value
+		case key == "keydata":
+			// the key data is usually folded, so drop all the whitespace
+			data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+			if err != nil {
+				return h, false
+			}
+			h.KeyData = data
+		case strings.HasPrefix(key, "_"):
+			// non-critical attribute, ignore it
+		default:
+			return h, false
+		}
+	}
+
+	return h, h.Addr != "" && len(h.KeyData) > 0
+}
+
+// Autocrypt returns the sender key announced in the Autocrypt header. As
+// required by the spec, the header is only used when there is exactly one
+// valid Autocrypt header and its addr matches the From address.
+func (m Message) Autocrypt() (*AutocryptHeader, bool) {
+	if len(m.From) != 1 {
+		return nil, false
+	}
+
+	var found *AutocryptHeader
+	for _, v := range m.header("Autocrypt") {
+		h, ok := parseAutocrypt(v)
+		if !ok || !strings.EqualFold(h.Addr, m.From[0].Email()) {
+			continue
+		}
+
+		if found != nil {
+			return nil, false
+		}
+		found = &h
+	}
+
+	return found, found != nil
+}
+
+// AutocryptGossip returns the keys of the other recipients announced with
+// Autocrypt-Gossip headers, usually found on the decrypted inner message
+func (m Message) AutocryptGossip() (gossip []AutocryptHeader) {
+	for _, v := range m.header("Autocrypt-Gossip") {
+		if h, ok := parseAutocrypt(v); ok {
+			h.PreferEncrypt = ""
+			gossip = append(gossip, h)
+		}
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package eml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// an Autocrypt header for addr, with the key data folded over several lines
+func autocryptHeader(name, addr, attrs string, key []byte) string {
+	data := base64.StdEncoding.EncodeToString(key)
+
+	var folded []string
+	for len(data) > 40 {
+		folded = append(folded, data[:40])
+		data = data[40:]
+	}
+	folded = append(folded, data)
+
+	return name + ": addr=" + addr + ";" + attrs + " keydata=\n " + strings.Join(folded, "\n ") + "\n"
+}
+
+func TestAutocrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{0x99, 0x01, 0x0d, 0x04}, 50)
+
+	raw := "From: Alice <Alice@Example.com>\n" +
+		autocryptHeader("Autocrypt", "alice@example.com", " prefer-encrypt=mutual; _comment=ignored;", key) +
+		"\nhi\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	h, ok := m.Autocrypt()
+	if !ok {
+		t.Fatal("no Autocrypt header")
+	}
+	if h.Addr != "alice@example.com" || h.PreferEncrypt != "mutual" {
+		t.Errorf("addr %q, prefer-encrypt %q", h.Addr, h.PreferEncrypt)
+	}
+	if !bytes.Equal(h.KeyData, key) {
+		t.Errorf("key data %x", h.KeyData)
+	}
+}
+
+func TestAutocryptRejected(t *testing.T) {
+	key := []byte("key")
+
+	for _, c := range []struct {
+		name, headers string
+	}{
+		{"other addr", autocryptHeader("Autocrypt", "mallory@example.com", "", key)},
+		{"critical attribute", autocryptHeader("Autocrypt", "alice@example.com", " type=2;", key)},
+		{"bad key data", "Autocrypt: addr=alice@example.com; keydata=!!!\n"},
+		{"no key data", "Autocrypt: addr=alice@example.com; prefer-encrypt=mutual\n"},
+		{"two headers", autocryptHeader("Autocrypt", "alice@example.com", "", key) + autocryptHeader("Autocrypt", "alice@example.com", "", key)},
+	} {
+		m, errs := Parse(crlf("From: alice@example.com\n" + c.headers + "\nhi\n"))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if h, ok := m.Autocrypt(); ok {
+			t.Errorf("%s: %+v", c.name, h)
+		}
+	}
+}
+
+func TestAutocryptGossip(t *testing.T) {
+	raw := "From: alice@example.com\n" +
+		autocryptHeader("Autocrypt-Gossip", "bob@example.com", " prefer-encrypt=mutual;", []byte("bob key")) +
+		autocryptHeader("Autocrypt-Gossip", "carol@example.com", "", []byte("carol key")) +
+		autocryptHeader("Autocrypt-Gossip", "dave@example.com", " type=2;", []byte("dave key")) +
+		"\nhi\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	gossip := m.AutocryptGossip()
+	if len(gossip) != 2 {
+		t.Fatalf("%d gossip headers", len(gossip))
+	}
+	if gossip[0].Addr != "bob@example.com" || string(gossip[0].KeyData) != "bob key" || gossip[0].PreferEncrypt != "" {
+		t.Errorf("gossip %+v", gossip[0])
+	}
+	if gossip[1].Addr != "carol@example.com" || string(gossip[1].KeyData) != "carol key" {
+		t.Errorf("gossip %+v", gossip[1])
+	}
+
+	if _, ok := m.Autocrypt(); ok {
+		t.Error("gossip used as the sender key")
+	}
+}
@@ -0,0 +1,172 @@
+// Composition of new messages.
+
+package eml
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Builder composes a new message. The zero value is ready to use; Build
+// renders the message and parses it back into a Message.
+type Builder struct {
+	headers     [][2]string
+	from        Address
+	to          []Address
+	subject     string
+	text        string
+	html        string
+	attachments []Attachment
+}
+
+// SetHeader sets a header of the message, replacing its previous values
+func (b *Builder) SetHeader(key, value string) *Builder {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+
+	for i := 0; i < len(b.headers); i++ {
+		if b.headers[i][0] == key {
+			b.headers = append(b.headers[:i], b.headers[i+1:]...)
+			i--
+		}
+	}
+
+	b.headers = append(b.headers, [2]string{key, value})
+
+	return b
+}
+
+// SetFrom sets the author of the message
+func (b *Builder) SetFrom(addr Address) *Builder {
+	b.from = addr
+	return b
+}
+
+// AddTo adds recipients to the To header
+func (b *Builder) AddTo(addrs ...Address) *Builder {
+	b.to = append(b.to, addrs...)
+	return b
+}
+
+// SetSubject sets the message subject
+func (b *Builder) SetSubject(subject string) *Builder {
+	b.subject = subject
+	return b
+}
+
+// SetText sets the plain text body
+func (b *Builder) SetText(text string) *Builder {
+	b.text = text
+	return b
+}
+
+// SetHTML sets the HTML body. With a plain text body too, the two are sent
+// as a multipart/alternative.
+func (b *Builder) SetHTML(html string) *Builder {
+	b.html = html
+	return b
+}
+
+// AddAttachment adds an attachment, sent base64 encoded within a
+// multipart/mixed. An empty mimeType is sent as application/octet-stream.
+func (b *Builder) AddAttachment(filename string, data []byte, mimeType string) *Builder {
+	b.attachments = append(b.attachments, Attachment{Filename: filename, MIMEType: mimeType, Size: len(data), SHA256: sha256Hex(data), Data: data})
+	return b
+}
+
+// has a header been set with SetHeader
+func (b *Builder) hasHeader(key string) bool {
+	for _, h := range b.headers {
+		if strings.EqualFold(h[0], key) {
+			return true
+		}
+	}
+	return false
+}
+
+// generate a unique Message-ID in the domain of the author, or localhost
+func generateMessageID(from Address) string {
+	domain := "localhost"
+	if from != nil && from.Domain() != "" {
+		domain = from.Domain()
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return "<" + hex.EncodeToString(id) + "@" + domain + ">"
+}
+
+// join an address list for a header
+func formatAddressList(list []Address) string {
+	s := make([]string, len(list))
+	for i, a := range list {
+		s[i] = a.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// write an address header. the display names are already encoded by
+// formatAddressList, and the addr-specs are left as they are, in UTF-8 if
+// need be (RFC6532 3.2): an encoded-word can't stand for an addr-spec
+func writeAddressHeader(w io.Writer, key string, list []Address) error {
+	_, err := io.WriteString(w, foldHeader(key, formatAddressList(list)))
+	return err
+}
+
+// Build renders the message and parses it back, returning the Message as
+// a parser would see it. The Date and Message-ID headers are generated
+// unless they were set with SetHeader, and the From, To and Subject set
+// with their own methods replace the ones set with SetHeader. The texts
+// are quoted-printable encoded, as a multipart/alternative when there are
+// both, and put in a multipart/mixed with the attachments when there are
+// some.
+func (b *Builder) Build() (Message, error) {
+	var buf bytes.Buffer
+
+	// writes to a bytes.Buffer can't fail
+	if !b.hasHeader("Date") {
+		writeHeader(&buf, "Date", time.Now().Format(time.RFC1123Z))
+	}
+
+	if !b.hasHeader("Message-Id") {
+		writeHeader(&buf, "Message-ID", generateMessageID(b.from))
+	}
+
+	// the headers set with SetFrom, AddTo and SetSubject replace the ones
+	// set with SetHeader
+	for _, h := range b.headers {
+		switch {
+		case h[0] == "From" && b.from != nil, h[0] == "To" && len(b.to) > 0, h[0] == "Subject" && b.subject != "":
+			continue
+		}
+		writeRawHeader(&buf, h[0], h[1])
+	}
+
+	if b.from != nil {
+		writeAddressHeader(&buf, "From", []Address{b.from})
+	}
+
+	if len(b.to) > 0 {
+		writeAddressHeader(&buf, "To", b.to)
+	}
+
+	if b.subject != "" {
+		writeHeader(&buf, "Subject", b.subject)
+	}
+
+	body := Message{Text: b.text, Html: b.html, Attachments: b.attachments}
+	body.writeBody(&buf)
+
+	msg, errs := Parse(buf.Bytes())
+	if len(errs) > 0 {
+		return msg, fmt.Errorf("built message: %v", errs[0])
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,128 @@
+package eml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func mustParseAddress(t *testing.T, s string) Address {
+	t.Helper()
+	a, err := ParseAddress([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestBuilderRoundTrip(t *testing.T) {
+	from := mustParseAddress(t, "Jürgen Müller <müller@bücher.de>")
+	to := []Address{
+		mustParseAddress(t, "Zoë <zoe@example.com>"),
+		mustParseAddress(t, "\"Doe, John\" <john@example.com>"),
+		mustParseAddress(t, "用户@例子.广告"),
+	}
+
+	m, err := new(Builder).
+		SetFrom(from).
+		AddTo(to...).
+		SetSubject("Grüße aus Köln").
+		SetText("Hallo!\n").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.From) != 1 || m.From[0].Email() != "müller@bücher.de" || m.From[0].Name() != "Jürgen Müller" {
+		t.Errorf("From = %v", m.From)
+	}
+	if len(m.To) != len(to) {
+		t.Fatalf("To = %v, want %v", m.To, to)
+	}
+	for i, a := range m.To {
+		if a.String() != to[i].String() {
+			t.Errorf("To[%d] = %q, want %q", i, a, to[i])
+		}
+	}
+	if m.Subject != "Grüße aus Köln" {
+		t.Errorf("Subject = %q", m.Subject)
+	}
+	if m.Text != "Hallo!\r\n" {
+		t.Errorf("Text = %q", m.Text)
+	}
+
+	// the addr-specs are written raw, the display names encoded
+	h := m.ParsedHeaders["From"][0]
+	if !strings.Contains(h, "<müller@bücher.de>") || strings.Contains(h, "Jürgen") {
+		t.Errorf("From header %q", h)
+	}
+}
+
+func TestBuilderSetHeaderAddresses(t *testing.T) {
+	m, err := new(Builder).
+		SetHeader("From", "Zoë <zoë@example.com>").
+		SetHeader("Cc", "ann@example.com, Jürgen <jürgen@bücher.de>").
+		SetText("hi").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.From) != 1 || m.From[0].Email() != "zoë@example.com" || m.From[0].Name() != "Zoë" {
+		t.Errorf("From = %v", m.From)
+	}
+	if len(m.Cc) != 2 || m.Cc[1].Email() != "jürgen@bücher.de" {
+		t.Errorf("Cc = %v", m.Cc)
+	}
+}
+
+func TestBuilderSingleFrom(t *testing.T) {
+	b := new(Builder).
+		SetHeader("From", "old@example.com").
+		SetHeader("Subject", "old").
+		SetFrom(mustParseAddress(t, "new@example.com")).
+		SetSubject("new")
+
+	m, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := m.ParsedHeaders["From"]; len(got) != 1 {
+		t.Errorf("From fields %q, want one", got)
+	}
+	if len(m.From) != 1 || m.From[0].Email() != "new@example.com" {
+		t.Errorf("From = %v", m.From)
+	}
+	if got := m.ParsedHeaders["Subject"]; len(got) != 1 || m.Subject != "new" {
+		t.Errorf("Subject fields %q", got)
+	}
+}
+
+func TestBuilderAttachments(t *testing.T) {
+	data := bytes.Repeat([]byte{0, 1, 2, 0xff}, 100)
+
+	m, err := new(Builder).
+		SetFrom(mustParseAddress(t, "a@example.com")).
+		SetText("text").
+		SetHTML("<p>html</p>").
+		AddAttachment("blob.bin", data, "").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Text != "text" || m.Html != "<p>html</p>" {
+		t.Errorf("Text %q, Html %q", m.Text, m.Html)
+	}
+	if len(m.Attachments) != 1 {
+		t.Fatalf("%d attachments", len(m.Attachments))
+	}
+	a := m.Attachments[0]
+	if a.Filename != "blob.bin" || a.MIMEType != "application/octet-stream" || !bytes.Equal(a.Data, data) {
+		t.Errorf("attachment %q of type %q, %d bytes", a.Filename, a.MIMEType, len(a.Data))
+	}
+	if m.MessageID == "" || !strings.HasSuffix(m.MessageID, "@example.com") || m.Date.IsZero() {
+		t.Errorf("Message-ID %q, Date %v", m.MessageID, m.Date)
+	}
+}
@@ -0,0 +1,164 @@
+package eml
+
+import "testing"
+
+func TestCharsetFallback(t *testing.T) {
+	body := "He said \x93hello\x94 \x96 twice\n"
+	want := "He said “hello” – twice\r\n"
+
+	for _, c := range []struct {
+		name        string
+		contentType string
+		warned      bool
+	}{
+		{"undeclared", "text/plain", true},
+		{"empty", `text/plain; charset=""`, true},
+		{"mislabeled us-ascii", "text/plain; charset=us-ascii", true},
+		{"unknown", "text/plain; charset=x-unknown", true},
+		{"declared", "text/plain; charset=windows-1252", false},
+	} {
+		raw := "MIME-Version: 1.0\nContent-Type: " + c.contentType + "\n\n" + body
+
+		m, errs := Parse(crlf(raw))
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", c.name, errs)
+			continue
+		}
+		if m.Text != want {
+			t.Errorf("%s: text %q, want %q", c.name, m.Text, want)
+		}
+		if m.TextCharset != "windows-1252" {
+			t.Errorf("%s: charset %q, want windows-1252", c.name, m.TextCharset)
+		}
+		if (len(m.Warnings) > 0) != c.warned {
+			t.Errorf("%s: warnings %q", c.name, m.Warnings)
+		}
+	}
+}
+
+func TestCharsetFallbackPart(t *testing.T) {
+	raw := "MIME-Version: 1.0\nContent-Type: multipart/alternative; boundary=b\n\n" +
+		"--b\nContent-Type: text/plain\n\nplain ascii\n" +
+		"--b\nContent-Type: text/html; charset=us-ascii\n\n<p>\x93quoted\x94</p>\n" +
+		"--b--\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.TextCharset != "us-ascii" || m.HtmlCharset != "windows-1252" {
+		t.Errorf("charsets %q and %q, want us-ascii and windows-1252", m.TextCharset, m.HtmlCharset)
+	}
+	if m.Html != "<p>“quoted”</p>" {
+		t.Errorf("html %q", m.Html)
+	}
+	for _, p := range m.Parts {
+		if p.Type == "text/html" && p.DecodedCharset != "windows-1252" {
+			t.Errorf("html part decoded as %q", p.DecodedCharset)
+		}
+	}
+}
+
+func TestDecodedCharset(t *testing.T) {
+	raw := "MIME-Version: 1.0\nContent-Type: multipart/mixed; boundary=m\n\n" +
+		"--m\nContent-Type: multipart/alternative; boundary=b\n\n" +
+		"--b\nContent-Type: text/plain; charset=utf-8\n\ncaf\xc3\xa9\n" +
+		"--b\nContent-Type: text/html; charset=utf-8\n\n<p>caf\xe9</p>\n" +
+		"--b--\n" +
+		"--m\nContent-Type: text/plain; charset=utf-8\nContent-Disposition: attachment; filename=a.txt\n\nnotes\n" +
+		"--m--\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// the declared charset is used for the text, the HTML is not UTF-8
+	if m.Text != "café" || m.TextCharset != "utf-8" {
+		t.Errorf("text %q decoded from %q", m.Text, m.TextCharset)
+	}
+	if m.Html != "<p>café</p>" || m.HtmlCharset != "windows-1252" {
+		t.Errorf("html %q decoded from %q", m.Html, m.HtmlCharset)
+	}
+
+	want := []struct{ charset, decoded string }{
+		{"utf-8", "utf-8"},
+		{"utf-8", "windows-1252"},
+		{"utf-8", ""}, // an attachment, not decoded
+	}
+	if len(m.Parts) != len(want) {
+		t.Fatalf("%d parts", len(m.Parts))
+	}
+	for i, p := range m.Parts {
+		if p.Charset != want[i].charset || p.DecodedCharset != want[i].decoded {
+			t.Errorf("part %d: charset %q decoded from %q, want %q and %q", i, p.Charset, p.DecodedCharset, want[i].charset, want[i].decoded)
+		}
+	}
+}
+
+func TestPseudoCharsets(t *testing.T) {
+	for _, label := range []string{"unknown-8bit", "x-unknown", "x-user-defined", "unknown", "UNKNOWN-8BIT"} {
+		raw := "MIME-Version: 1.0\nContent-Type: text/plain; charset=" + label + "\n\ncaf\xe9 cr\xe8me\n"
+
+		m, errs := ParseWithOptions(crlf(raw), ParseOptions{DefaultCharset: "iso-8859-1"})
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", label, errs)
+			continue
+		}
+		if m.Text != "café crème\r\n" {
+			t.Errorf("%s: text %q", label, m.Text)
+		}
+		if m.TextCharset != "iso-8859-1" {
+			t.Errorf("%s: charset %q, want iso-8859-1", label, m.TextCharset)
+		}
+		if len(m.Warnings) != 1 {
+			t.Errorf("%s: warnings %q", label, m.Warnings)
+		}
+
+		// sniffed without a default charset
+		m, errs = Parse(crlf(raw))
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", label, errs)
+			continue
+		}
+		if m.Text != "café crème\r\n" {
+			t.Errorf("%s: sniffed text %q", label, m.Text)
+		}
+	}
+}
+
+func TestPseudoCharsetUTF8(t *testing.T) {
+	raw := "Content-Type: text/plain; charset=unknown-8bit\n\ncafé\n"
+
+	m, errs := ParseWithOptions(crlf(raw), ParseOptions{DefaultCharset: "utf-8"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if m.Text != "café\r\n" {
+		t.Errorf("text %q", m.Text)
+	}
+}
+
+func TestRawDisplayNameCharset(t *testing.T) {
+	for _, c := range []struct {
+		name, header, charset, want string
+	}{
+		{"latin-1", "From: Fran\xe7ois M\xfcller <f@example.com>", "iso-8859-1", "François Müller"},
+		{"koi8-r", "From: \xe9\xd7\xc1\xce <ivan@example.com>", "koi8-r", "Иван"},
+		{"quoted", "From: \"M\xfcller, Hans\" <h@example.com>", "iso-8859-1", "Müller, Hans"},
+		{"sniffed", "From: Fran\xe7ois <f@example.com>", "", "François"},
+		{"utf-8 kept", "From: Zoë <zoe@example.com>", "koi8-r", "Zoë"},
+		{"encoded-word kept", "From: =?utf-8?q?Zo=C3=AB?= <zoe@example.com>", "koi8-r", "Zoë"},
+	} {
+		m, errs := ParseWithOptions(crlf(c.header+"\n\nhi\n"), ParseOptions{DefaultCharset: c.charset})
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", c.name, errs)
+			continue
+		}
+
+		if len(m.From) != 1 || m.From[0].Name() != c.want {
+			t.Errorf("%s: From %v, want %q", c.name, m.From, c.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Sensitivity and classification markings.
+
+package eml
+
+import (
+	"strings"
+)
+
+// Sensitivity of a message, as defined by the RFC2156 Sensitivity header
+type Sensitivity string
+
+const (
+	SensitivityPersonal            Sensitivity = "Personal"
+	SensitivityPrivate             Sensitivity = "Private"
+	SensitivityCompanyConfidential Sensitivity = "Company-Confidential"
+)
+
+// headers used by DLP and classification tools to label a message
+var classificationHeaders = []string{
+	"X-Classification",
+	"X-Microsoft-Classified",
+	"X-Microsoft-Classification",
+	"X-Titus-Classification",
+	"Msip_labels",
+}
+
+// normalize a Sensitivity header value into one of the RFC2156 values.
+// unknown values are kept as they were sent
+func parseSensitivity(v string) Sensitivity {
+	v = strings.TrimSpace(v)
+
+	switch strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(v, "-", " "))), " ") {
+	case "personal":
+		return SensitivityPersonal
+	case "private":
+		return SensitivityPrivate
+	case "company confidential":
+		return SensitivityCompanyConfidential
+	}
+
+	return Sensitivity(v)
+}
+
+// Classification returns the classification markings found on the message,
+// keyed by the header they were found in (e.g. X-Classification)
+func (m Message) Classification() map[string][]string {
+	found := make(map[string][]string)
+
+	for _, h := range classificationHeaders {
+		if v := m.header(h); len(v) > 0 {
+			found[h] = v
+		}
+	}
+
+	return found
+}
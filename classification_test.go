@@ -0,0 +1,59 @@
+package eml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSensitivity(t *testing.T) {
+	for _, c := range []struct {
+		value string
+		want  Sensitivity
+	}{
+		{"Personal", SensitivityPersonal},
+		{"private", SensitivityPrivate},
+		{"Company-Confidential", SensitivityCompanyConfidential},
+		{"company confidential", SensitivityCompanyConfidential},
+		{" COMPANY-CONFIDENTIAL ", SensitivityCompanyConfidential},
+		{"Secret", "Secret"},
+	} {
+		m, errs := Parse(crlf("Sensitivity: " + c.value + "\n\nhi\n"))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if m.Sensitivity != c.want {
+			t.Errorf("%q: %q, want %q", c.value, m.Sensitivity, c.want)
+		}
+	}
+
+	m, _ := Parse(crlf("Subject: x\n\nhi\n"))
+	if m.Sensitivity != "" {
+		t.Errorf("no header: %q", m.Sensitivity)
+	}
+}
+
+func TestClassification(t *testing.T) {
+	raw := "X-Classification: Internal\n" +
+		"x-microsoft-classified: Confidential\n" +
+		"MSIP_Labels: MSIP_Label_1234_Enabled=true\n" +
+		"X-Other: not a marking\n\nhi\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := map[string][]string{
+		"X-Classification":       {"Internal"},
+		"X-Microsoft-Classified": {"Confidential"},
+		"Msip_labels":            {"MSIP_Label_1234_Enabled=true"},
+	}
+	if got := m.Classification(); !reflect.DeepEqual(got, want) {
+		t.Errorf("%q, want %q", got, want)
+	}
+
+	m, _ = Parse(crlf("Subject: x\n\nhi\n"))
+	if got := m.Classification(); len(got) != 0 {
+		t.Errorf("no markings: %q", got)
+	}
+}
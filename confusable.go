@@ -0,0 +1,97 @@
+// Detection of homograph (confusable characters) attacks.
+
+package eml
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// scripts whose letters are commonly mistaken for one another
+var confusableScripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Armenian", unicode.Armenian},
+	{"Cherokee", unicode.Cherokee},
+}
+
+// Cyrillic and Greek letters that look like Latin ones
+const latinLookalikes = "аеорсухіјѕԁӏһԛԝАВЕКМНОРСТХІЈЅ" + "οανικτυχΑΒΕΖΗΙΚΜΝΟΡΤΥΧ"
+
+// get the scripts of the letters of a word, in order of appearance
+func wordScripts(w string) (scripts []string) {
+	for _, r := range w {
+		for _, s := range confusableScripts {
+			if unicode.Is(s.table, r) {
+				found := false
+				for _, name := range scripts {
+					found = found || name == s.name
+				}
+				if !found {
+					scripts = append(scripts, s.name)
+				}
+				break
+			}
+		}
+	}
+	return
+}
+
+// check if every letter of a word can be mistaken for a Latin one, while
+// not being Latin at all (e.g. "аррӏе" written in Cyrillic)
+func isWholeScriptConfusable(w string) bool {
+	letters := 0
+	for _, r := range w {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if !strings.ContainsRune(latinLookalikes, r) {
+			return false
+		}
+		letters++
+	}
+	return letters > 0
+}
+
+// report the words of s that mix confusable scripts or that impersonate
+// Latin words
+func confusableWords(what, s string) (warnings []string) {
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '.' || r == '-' || r == '@'
+	}) {
+		if scripts := wordScripts(w); len(scripts) > 1 {
+			warnings = append(warnings, fmt.Sprintf("%s %q mixes the %s scripts", what, w, strings.Join(scripts, " and ")))
+		} else if isWholeScriptConfusable(w) {
+			warnings = append(warnings, fmt.Sprintf("%s %q only has characters that look like Latin ones", what, w))
+		}
+	}
+	return
+}
+
+// ConfusableWarnings reports the signs of a homograph attack: words of the
+// sender display names, the From domain and the subject that mix scripts
+// with look-alike letters (such as a Cyrillic "а" among Latin letters), or
+// that are written only with letters impersonating Latin ones. Punycode
+// domains are checked in their Unicode form.
+func (m Message) ConfusableWarnings() (warnings []string) {
+	for _, ma := range mailboxes(append(append([]Address{}, m.From...), m.ReplyTo...)) {
+		warnings = append(warnings, confusableWords("display name", ma.name)...)
+	}
+
+	for _, ma := range mailboxes(m.From) {
+		domain, err := idna.ToUnicode(ma.domain)
+		if err != nil {
+			domain = ma.domain
+		}
+		warnings = append(warnings, confusableWords("From domain", domain)...)
+	}
+
+	return append(warnings, confusableWords("subject", m.Subject)...)
+}
@@ -1,6 +1,10 @@
 package eml
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,28 +14,137 @@ var dateFormats = []string{
 	`Mon, 02 Jan 2006 15:04:05 -0700`,
 	`02 Jan 2006 15:04:05 -0700`,
 
-	`Mon, 02 Jan 2006 15:04 -0700 (MST)`,
-	`02 Jan 2006 15:04 -0700 (MST)`,
-	`Mon, 02 Jan 2006 15:04:05 -0700 (MST)`,
-	`02 Jan 2006 15:04:05 -0700 (MST)`,
-
 	`Mon, 2 Jan 2006 15:04 -0700`,
 	`2 Jan 2006 15:04 -0700`,
 	`Mon, 2 Jan 2006 15:04:05 -0700`,
 	`2 Jan 2006 15:04:05 -0700`,
+}
+
+// date with an obsolete two or three digit year (RFC5322 4.3)
+var obsYearR = regexp.MustCompile(`^((?:[A-Za-z]+,\s*)?\d{1,2}\s+[A-Za-z]+\s+)(\d{2,3})(\s)`)
+
+// offsets of the obsolete zone names (RFC5322 4.3). the military zones were
+// defined with the wrong sign, so they are taken as -0000 (unknown) as the
+// RFC asks, except Z
+var obsZones = map[string]string{
+	"UT":  "+0000",
+	"GMT": "+0000",
+	"Z":   "+0000",
+	"EST": "-0500",
+	"EDT": "-0400",
+	"CST": "-0600",
+	"CDT": "-0500",
+	"MST": "-0700",
+	"MDT": "-0600",
+	"PST": "-0800",
+	"PDT": "-0700",
+}
 
-	`Mon, 2 Jan 2006 15:04 -0700 (MST)`,
-	`2 Jan 2006 15:04 -0700 (MST)`,
-	`Mon, 2 Jan 2006 15:04:05 -0700 (MST)`,
-	`2 Jan 2006 15:04:05 -0700 (MST)`,
+// replace an obsolete zone name at the end of a date with its offset
+func numericZone(s string) string {
+	i := strings.LastIndexByte(s, ' ')
+	zone := strings.ToUpper(s[i+1:])
+
+	if offset, ok := obsZones[zone]; ok {
+		return s[:i+1] + offset
+	}
+	if len(zone) == 1 && zone[0] >= 'A' && zone[0] <= 'Z' && zone != "J" {
+		return s[:i+1] + "-0000"
+	}
+	return s
 }
 
+// ParseDate parses the value of a Date header, returning the current time
+// when it can't be parsed. Use ParseDateErr to tell the failures apart.
 func ParseDate(s string) time.Time {
-	for _, fmt := range dateFormats {
-		t, e := time.Parse(fmt, s)
+	if t, err := ParseDateErr(s); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// ParseDateErr parses the value of a Date header. Besides the RFC5322
+// format, the obsolete syntax is accepted: two or three digit years (49 is
+// 2049, 50 is 1950, 103 is 2003), missing seconds, comments anywhere, such
+// as a trailing "(PST)", and zone names (GMT, EST, PDT...) instead of
+// offsets. The time keeps the offset it was written with. The zero time and
+// an error are returned when the date can't be parsed.
+func ParseDateErr(s string) (time.Time, error) {
+	if t, ok := parseDate(s); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unparsable date %q", strings.TrimSpace(s))
+}
+
+// parse a date with the known formats, telling if any of them matched
+func parseDate(s string) (time.Time, bool) {
+	s = strings.Join(strings.Fields(stripComments(s)), " ")
+	s = numericZone(strings.ReplaceAll(s, " ,", ","))
+
+	if m := obsYearR.FindStringSubmatch(s); m != nil {
+		y, _ := strconv.Atoi(m[2])
+		switch {
+		case len(m[2]) == 3:
+			y += 1900
+		case y < 50:
+			y += 2000
+		default:
+			y += 1900
+		}
+		s = m[1] + strconv.Itoa(y) + s[len(m[0])-1:]
+	}
+
+	for _, layout := range dateFormats {
+		t, e := time.Parse(layout, s)
 		if e == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// remove the (possibly nested) comments of a structured header value
+func stripComments(s string) string {
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && depth > 0:
+			i++
+		case c == '(':
+			depth++
+			b.WriteByte(' ')
+		case c == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// EffectiveDate returns the best known date of the message. When the Date
+// header is missing or can't be parsed, the timestamp of the most recent
+// Received header is used, then the Resent-Date. It is the zero time when
+// none of them is usable.
+func (m Message) EffectiveDate() time.Time {
+	for _, v := range m.header("Date") {
+		if t, ok := parseDate(v); ok {
 			return t
 		}
 	}
-	return time.Now()
+
+	for _, v := range m.header("Received") {
+		if t, ok := receivedDate(v); ok {
+			return t
+		}
+	}
+
+	for _, v := range m.header("Resent-Date") {
+		if t, ok := parseDate(v); ok {
+			return t
+		}
+	}
+
+	return time.Time{}
 }
@@ -0,0 +1,128 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDateErr(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want string
+	}{
+		{"Mon, 2 Oct 2023 10:00:05 +0200", "2023-10-02T10:00:05+02:00"},
+		{"2 Oct 2023 10:00:05 +0200", "2023-10-02T10:00:05+02:00"},
+		{"Mon, 02 Oct 2023 10:00 +0200", "2023-10-02T10:00:00+02:00"},
+		{"Mon, 2 Oct 23 10:00:05 +0000", "2023-10-02T10:00:05Z"},
+		{"Sat, 1 Jan 49 00:00:00 +0000", "2049-01-01T00:00:00Z"},
+		{"Sun, 1 Jan 50 00:00:00 +0000", "1950-01-01T00:00:00Z"},
+		{"Thu, 1 May 103 12:00:00 +0000", "2003-05-01T12:00:00Z"},
+		{"Mon, 2 Oct 2023 10:00:05 -0700 (PST)", "2023-10-02T10:00:05-07:00"},
+		{"Mon (day), 2 Oct 2023 (comment) 10:00:05 +0000", "2023-10-02T10:00:05Z"},
+		{"  Mon,  2  Oct 2023   10:00:05 +0000  ", "2023-10-02T10:00:05Z"},
+	} {
+		got, err := ParseDateErr(c.in)
+		if err != nil {
+			t.Errorf("ParseDateErr(%q): %v", c.in, err)
+			continue
+		}
+		if s := got.Format(time.RFC3339); s != c.want {
+			t.Errorf("ParseDateErr(%q) = %s, want %s", c.in, s, c.want)
+		}
+	}
+}
+
+func TestParseDateErrInvalid(t *testing.T) {
+	for _, in := range []string{"", "yesterday", "Mon, 32 Oct 2023 10:00:05 +0000", "2023-10-02T10:00:05Z"} {
+		if got, err := ParseDateErr(in); err == nil || !got.IsZero() {
+			t.Errorf("ParseDateErr(%q) = %v, %v, want the zero time and an error", in, got, err)
+		}
+	}
+}
+
+func TestParseDateReported(t *testing.T) {
+	m, errs := Parse(crlf("From: a@example.com\nDate: the day after tomorrow\n\nbody\n"))
+	if !m.Date.IsZero() {
+		t.Errorf("Date = %v, want the zero time", m.Date)
+	}
+
+	found := false
+	for _, err := range errs {
+		found = found || strings.Contains(err.Error(), "unparsable date")
+	}
+	if !found {
+		t.Errorf("errors %v, want the unparsable date", errs)
+	}
+}
+
+func TestParseDateZones(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want string
+	}{
+		{"Mon, 2 Jan 2006 15:04:05 -0700 (MST)", "2006-01-02T15:04:05-07:00"},
+		{"Mon, 2 Jan 2006 15:04:05 GMT", "2006-01-02T15:04:05Z"},
+		{"Mon, 2 Jan 2006 15:04:05 UT", "2006-01-02T15:04:05Z"},
+		{"Mon, 2 Jan 2006 15:04:05 EST", "2006-01-02T15:04:05-05:00"},
+		{"Mon, 2 Jan 2006 15:04:05 edt", "2006-01-02T15:04:05-04:00"},
+		{"Mon, 2 Jan 2006 15:04:05 CST", "2006-01-02T15:04:05-06:00"},
+		{"Mon, 2 Jan 2006 15:04:05 MDT", "2006-01-02T15:04:05-06:00"},
+		{"Mon, 2 Jan 2006 15:04:05 PDT", "2006-01-02T15:04:05-07:00"},
+		{"Mon, 2 Jan 2006 15:04:05 Z", "2006-01-02T15:04:05Z"},
+		{"Mon, 2 Jan 2006 15:04:05 A", "2006-01-02T15:04:05Z"},
+		{"Mon, 2 Jan 2006 15:04:05 +0530", "2006-01-02T15:04:05+05:30"},
+		{"Mon, 02 Jan 2006 15:04:05 -0000", "2006-01-02T15:04:05Z"},
+	} {
+		got, err := ParseDateErr(c.in)
+		if err != nil {
+			t.Errorf("ParseDateErr(%q): %v", c.in, err)
+			continue
+		}
+		if s := got.Format(time.RFC3339); s != c.want {
+			t.Errorf("ParseDateErr(%q) = %s, want %s", c.in, s, c.want)
+		}
+	}
+}
+
+func TestParseDateKeepsOffset(t *testing.T) {
+	got, err := ParseDateErr("Mon, 2 Jan 2006 15:04:05 PST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := got.Zone(); offset != -8*3600 {
+		t.Errorf("offset %d, want -8h", offset)
+	}
+	if got.Hour() != 15 {
+		t.Errorf("hour %d, want 15 in the original offset", got.Hour())
+	}
+}
+
+func TestParseDateJ(t *testing.T) {
+	if _, err := ParseDateErr("Mon, 2 Jan 2006 15:04:05 J"); err == nil {
+		t.Error("the J zone, which is not defined, was accepted")
+	}
+}
+
+func TestEffectiveDate(t *testing.T) {
+	received := "Received: from relay.example.net by mx.example.com; Mon, 2 Oct 2023 10:00:02 +0000\n" +
+		"Received: from laptop by relay.example.net; Mon, 2 Oct 2023 09:59:59 +0000\n"
+	resent := "Resent-Date: Sun, 1 Oct 2023 08:00:00 +0200\n"
+
+	for _, c := range []struct {
+		name, headers, want string
+	}{
+		{"date", "Date: Fri, 29 Sep 2023 12:00:00 -0400\n" + received + resent, "2023-09-29T12:00:00-04:00"},
+		{"most recent received", received + resent, "2023-10-02T10:00:02Z"},
+		{"unparseable date", "Date: someday\n" + received, "2023-10-02T10:00:02Z"},
+		{"received without date", "Received: by relay.example.net; not a date\n" + received, "2023-10-02T10:00:02Z"},
+		{"resent-date", "Date: someday\n" + resent, "2023-10-01T08:00:00+02:00"},
+		{"none", "Subject: undated\n", "0001-01-01T00:00:00Z"},
+	} {
+		m, _ := Parse(crlf(c.headers + "\nhi\n"))
+
+		if got := m.EffectiveDate().Format(time.RFC3339); got != c.want {
+			t.Errorf("%s: %s, want %s", c.name, got, c.want)
+		}
+	}
+}
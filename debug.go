@@ -0,0 +1,75 @@
+// Human-readable dump of a parsed message.
+
+package eml
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// write the tree with one indented line per entity
+func (n *PartNode) dump(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%s (%d bytes)\n", strings.Repeat("  ", depth+1), n.Type, len(n.Body))
+	for _, c := range n.Children {
+		c.dump(b, depth+1)
+	}
+}
+
+// Debug returns a textual dump of the parse result: the parsed header
+// fields, the MIME tree with the content type and size of each entity, the
+// attachments and the warnings. The output is deterministic, so it can be
+// compared between runs.
+func (m Message) Debug() string {
+	var b strings.Builder
+
+	addrs := func(list []Address) string {
+		s := make([]string, len(list))
+		for i, a := range list {
+			s[i] = a.String()
+		}
+		return strings.Join(s, ", ")
+	}
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+
+	field("Message-ID", m.MessageID)
+	if !m.Date.IsZero() {
+		field("Date", m.Date.Format(time.RFC1123Z))
+	}
+	if m.Sender != nil {
+		field("Sender", m.Sender.String())
+	}
+	field("From", addrs(m.From))
+	field("Reply-To", addrs(m.ReplyTo))
+	field("To", addrs(m.To))
+	field("Cc", addrs(m.Cc))
+	field("Bcc", addrs(m.Bcc))
+	field("Subject", m.Subject)
+	field("Content-Type", m.ContentType)
+	field("In-Reply-To", strings.Join(m.InReply, " "))
+	field("References", strings.Join(m.References, " "))
+
+	b.WriteString("Structure:\n")
+	m.structure().dump(&b, 0)
+
+	if len(m.Attachments) > 0 {
+		b.WriteString("Attachments:\n")
+		for _, a := range m.Attachments {
+			fmt.Fprintf(&b, "  %s (%d bytes)\n", a.Filename, len(a.Data))
+		}
+	}
+
+	if len(m.Warnings) > 0 {
+		b.WriteString("Warnings:\n")
+		for _, w := range m.Warnings {
+			fmt.Fprintf(&b, "  %s\n", w)
+		}
+	}
+
+	return b.String()
+}
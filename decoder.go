@@ -1,58 +1,212 @@
 package eml
 
 import (
-	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
+	"html"
 	"mime"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
-	"github.com/paulrosania/go-charset/charset"
-	_ "github.com/paulrosania/go-charset/data"
 	goCharset "golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
 )
 
+// labels used by gateways that could not determine the real charset
+var pseudoCharsets = map[string]bool{
+	"unknown":        true,
+	"unknown-8bit":   true,
+	"x-unknown":      true,
+	"x-user-defined": true,
+}
+
+func isUnknownCharset(cs string) bool {
+	return pseudoCharsets[strings.ToLower(strings.TrimSpace(cs))]
+}
+
+// decode data whose charset is unknown with the fallback charset, or sniff
+// it from the contents when no fallback is given. returns the used charset
+func decodeUnknownCharset(fallback string, data []byte) ([]byte, string, error) {
+	if fallback != "" {
+		decoded, err := UTF8(fallback, data)
+		return decoded, fallback, err
+	}
+
+	if utf8.Valid(data) {
+		return data, "utf-8", nil
+	}
+
+	enc, name, _ := goCharset.DetermineEncoding(data, "text/plain")
+	decoded, err := enc.NewDecoder().Bytes(data)
+
+	return decoded, name, err
+}
+
+// charset labels missing from the Encoding Standard and the IANA registry,
+// mapped to the charset they name
+var charsetAliases = map[string]string{
+	"cp932":    "shift_jis",
+	"x-cp932":  "shift_jis",
+	"win-1250": "windows-1250",
+	"win-1251": "windows-1251",
+	"win-1252": "windows-1252",
+}
+
+// resolve a charset label to its encoding. the labels of the WHATWG
+// Encoding Standard, which maps the legacy aliases (latin1, iso8859-1,
+// ansi_x3.4-1968, gb2312, ks_c_5601-1987...) to the encodings browsers use,
+// are tried first, then the names of the IANA registry (ibm437, cp850...).
+// both the headers and the bodies are decoded through it
+func resolveCharset(label string) (encoding.Encoding, error) {
+	label = strings.ToLower(strings.Trim(strings.TrimSpace(label), `"`))
+	if alias, ok := charsetAliases[label]; ok {
+		label = alias
+	}
+
+	if enc, name := goCharset.Lookup(label); enc != nil && name != "" {
+		return enc, nil
+	}
+
+	if enc, err := ianaindex.IANA.Encoding(label); enc != nil && err == nil {
+		return enc, nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownCharset, label)
+}
+
+// convert the data from the cs charset into UTF-8. only the charset is
+// converted, so HTML entities (&amp;, &#233;...) are kept for the renderer
 func UTF8(cs string, data []byte) ([]byte, error) {
-	if strings.ToUpper(cs) == "UTF-8" {
+	if strings.EqualFold(cs, "UTF-8") {
 		return data, nil
 	}
 
-	r, err := charset.NewReader(cs, bytes.NewReader(data))
+	enc, err := resolveCharset(cs)
 	if err != nil {
 		return []byte{}, err
 	}
 
-	return io.ReadAll(r)
+	return enc.NewDecoder().Bytes(data)
+}
+
+// DecodeHTMLEntities resolves the HTML entities of s. The message Html keeps
+// its entities as they were sent, use this when a plain text rendering with
+// the entities resolved is wanted
+func DecodeHTMLEntities(s string) string {
+	return html.UnescapeString(s)
 }
 
+// Decode decodes the RFC2047 encoded-words of a header value. Malformed
+// words are left as they are. The words in an unknown charset are decoded
+// as UTF-8 when they are valid, else with a sniffed charset, and reported
+// with an error wrapping ErrUnknownCharset along with the decoded value.
 func Decode(bstr []byte) (p []byte, err error) {
-	header, err := decodeRFC2047(bstr)
-	if err != nil {
-		return bstr, nil
-	}
+	header, err := decodeWords(string(bstr))
 
-	return header, err
+	return []byte(header), err
 }
 
-func decodeRFC2047(d []byte) (r []byte, err error) {
-	dec := new(mime.WordDecoder)
-	p, err := dec.DecodeHeader(string(d))
-	if err != nil {
-		return d, nil
+// an RFC2047 encoded-word: charset, with an optional RFC2231 language
+// suffix, encoding and encoded text
+var encodedWordR = regexp.MustCompile(`=\?([^?\s]+)\?([bBqQ])\?([^?]*)\?=`)
+
+// decode the text of an encoded-word to the bytes of its charset
+func decodeWordText(enc byte, text string) ([]byte, error) {
+	if enc == 'b' || enc == 'B' {
+		// some encoders leave out the padding
+		return base64.StdEncoding.DecodeString(text + strings.Repeat("=", (4-len(text)%4)%4))
+	}
+
+	var b []byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '_':
+			b = append(b, ' ')
+		case c == '=' && i+2 < len(text):
+			v, err := strconv.ParseUint(text[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted-printable %q", text[i:i+3])
+			}
+			b = append(b, byte(v))
+			i += 2
+		default:
+			b = append(b, c)
+		}
 	}
 
-	return []byte(p), err
+	return b, nil
 }
 
-func DecodeString(s string) (o string, err error) {
-	CharsetReader := func(label string, input io.Reader) (io.Reader, error) {
-		label = strings.Replace(label, "windows-", "cp", -1)
-		enc, _ := goCharset.Lookup(label)
-		return enc.NewDecoder().Reader(input), nil
+// decode the encoded-words of a header value. the whitespace between
+// adjacent encoded-words is dropped and the bytes of the consecutive words
+// in the same charset are joined before being converted, so a multibyte
+// character split across two words is decoded whole. malformed words, and
+// the runs that can't be converted, are kept as they are
+func decodeWords(s string) (string, error) {
+	var out strings.Builder
+	var run []byte
+	runCharset := ""
+	runStart, runEnd := 0, 0 // the run in s, written as is when it can't be converted
+	var unknown error        // words in an unknown charset, decoded nonetheless
+
+	flush := func() {
+		if runCharset == "" {
+			return
+		}
+
+		decoded, err := UTF8(runCharset, run)
+		if errors.Is(err, ErrUnknownCharset) {
+			// pseudo-charsets such as unknown-8bit and mistyped labels
+			used := ""
+			decoded, used, _ = decodeUnknownCharset("", run)
+			unknown = fmt.Errorf("%w %q, decoded as %s", ErrUnknownCharset, runCharset, used)
+		} else if err != nil {
+			decoded = []byte(s[runStart:runEnd])
+		}
+
+		out.Write(decoded)
+		run, runCharset = nil, ""
 	}
 
-	mimeDecoder := mime.WordDecoder{CharsetReader: CharsetReader}
-	decodedHeader, err := mimeDecoder.DecodeHeader(s)
+	last := 0
+	for _, m := range encodedWordR.FindAllStringSubmatchIndex(s, -1) {
+		between := s[last:m[0]]
+		last = m[1]
+
+		text, err := decodeWordText(s[m[4]], s[m[6]:m[7]])
+		if err != nil {
+			flush()
+			out.WriteString(between)
+			out.WriteString(s[m[0]:m[1]])
+			continue
+		}
+
+		if runCharset == "" || strings.TrimSpace(between) != "" {
+			flush()
+			out.WriteString(between)
+		}
+
+		if cs := strings.ToLower(strings.SplitN(s[m[2]:m[3]], "*", 2)[0]); cs != runCharset {
+			flush()
+			runCharset, runStart = cs, m[0]
+		}
+		run = append(run, text...)
+		runEnd = m[1]
+	}
+
+	flush()
+	out.WriteString(s[last:])
+
+	return out.String(), unknown
+}
+
+func DecodeString(s string) (o string, err error) {
+	decodedHeader, err := decodeWords(s)
 
 	if err != nil {
 		return decodedHeader, fmt.Errorf("cannot decode MIME-word-encoded header %q: %w", s, err)
@@ -60,3 +214,62 @@ func DecodeString(s string) (o string, err error) {
 
 	return decodedHeader, nil
 }
+
+// charset labels of the RFC2047 encoded-words, with an optional RFC2231
+// language suffix
+var encodedWordCharsetR = regexp.MustCompile(`=\?([^?*\s]+)(?:\*[^?\s]*)?\?[bBqQ]\?`)
+
+// normalize a charset label to its canonical name in the WHATWG Encoding
+// Standard, or to lowercase when it is unknown
+func canonicalCharset(label string) string {
+	label = strings.ToLower(strings.Trim(strings.TrimSpace(label), `"`))
+	if _, name := goCharset.Lookup(label); name != "" {
+		return name
+	}
+	return label
+}
+
+// Charsets returns every charset declared in the message, by the parts
+// Content-Type and by the encoded-words of the headers, in the order they
+// were first found. The labels are normalized to their canonical name, so
+// aliases are listed once: latin1 and iso-8859-1 are both windows-1252, as
+// the Encoding Standard maps them.
+func (m Message) Charsets() (charsets []string) {
+	seen := make(map[string]bool)
+	add := func(label string) {
+		if label = canonicalCharset(label); label != "" && !seen[label] {
+			seen[label] = true
+			charsets = append(charsets, label)
+		}
+	}
+
+	for _, w := range encodedWordCharsetR.FindAllSubmatch(m.Headers, -1) {
+		add(string(w[1]))
+	}
+
+	if v := m.header("Content-Type"); len(v) > 0 {
+		if _, ps, err := mime.ParseMediaType(v[0]); err == nil {
+			add(ps["charset"])
+		}
+	}
+
+	for _, p := range m.Parts {
+		add(p.Params["charset"])
+
+		keys := make([]string, 0, len(p.Headers))
+		for k := range p.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			for _, v := range p.Headers[k] {
+				for _, w := range encodedWordCharsetR.FindAllStringSubmatch(v, -1) {
+					add(w[1])
+				}
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,143 @@
+package eml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"plain text", "plain text"},
+		{"=?utf-8?q?Caf=C3=A9?=", "Café"},
+		{"=?utf-8?q?Caf=C3=A9?= =?utf-8?q?=ZZ?=", "Café =?utf-8?q?=ZZ?="},
+		{"=?utf-8?q?=ZZ?= =?utf-8?q?Caf=C3=A9?=", "=?utf-8?q?=ZZ?= Café"},
+		{"a =?utf-8?q?=ZZ?= b", "a =?utf-8?q?=ZZ?= b"},
+		// a character split across two words
+		{"=?utf-8?b?w6k=?= =?utf-8?b?w6k=?=", "éé"},
+		{"=?utf-8?q?Caf=C3?= =?utf-8?q?=A9_cr=C3=A8me?=", "Café crème"},
+		{"=?iso-8859-1?q?caf=E9?= and =?utf-8?q?cr=C3=A8me?=", "café and crème"},
+	} {
+		got, err := Decode([]byte(c.in))
+		if err != nil {
+			t.Errorf("Decode(%q): %v", c.in, err)
+		}
+		if string(got) != c.want {
+			t.Errorf("Decode(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestDecodeUnknownCharset(t *testing.T) {
+	got, err := Decode([]byte("=?x-unknown-cs?q?caf=C3=A9?="))
+	if !errors.Is(err, ErrUnknownCharset) {
+		t.Errorf("error %v, want ErrUnknownCharset", err)
+	}
+	if string(got) != "café" {
+		t.Errorf("decoded %q", got)
+	}
+}
+
+func TestHtmlKeepsEntities(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		raw  string
+	}{
+		{"utf-8", "Content-Type: text/html; charset=utf-8\n\n<p>Tom &amp; Jerry &lt;3 &eacute;t&#233; &nbsp;café</p>"},
+		{"latin1 quoted-printable", "Content-Type: text/html; charset=iso-8859-1\nContent-Transfer-Encoding: quoted-printable\n\n<p>Tom &amp; Jerry &lt;3 &eacute;t&#233; &nbsp;caf=E9</p>"},
+	} {
+		m, errs := Parse(crlf(c.raw))
+		if len(errs) > 0 {
+			t.Fatalf("%s: %v", c.name, errs)
+		}
+
+		want := "<p>Tom &amp; Jerry &lt;3 &eacute;t&#233; &nbsp;café</p>"
+		if m.Html != want {
+			t.Errorf("%s: Html %q, want %q", c.name, m.Html, want)
+		}
+	}
+}
+
+func TestDecodeHTMLEntities(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"Tom &amp; Jerry", "Tom & Jerry"},
+		{"&lt;p&gt;", "<p>"},
+		{"&eacute;t&#233; &#x263A;", "été ☺"},
+		{"a&nbsp;b", "a b"},
+		{"no entities", "no entities"},
+		{"&unknown; &amp", "&unknown; &"},
+	} {
+		if got := DecodeHTMLEntities(c.in); got != c.want {
+			t.Errorf("DecodeHTMLEntities(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCharsets(t *testing.T) {
+	raw := "From: =?UTF-8?B?Wm/Dqw==?= <zoe@example.com>\n" +
+		"Subject: =?iso-8859-1?q?caf=E9?= =?Shift_JIS?B?k/qWe4zq?=\n" +
+		"Content-Type: multipart/mixed; boundary=b; charset=utf-8\n\n" +
+		"--b\nContent-Type: text/plain; charset=\"latin1\"\n\ncaf\xe9\n" +
+		"--b\nContent-Type: text/html; charset=KOI8-R\n\n<p>hi</p>\n" +
+		"--b\nContent-Type: application/octet-stream\n" +
+		"Content-Disposition: attachment; filename=\"=?gb2312?B?1tDOxA==?=.txt\"\n\ndata\n" +
+		"--b\nContent-Type: text/plain; charset=x-made-up\n\nhi\n" +
+		"--b--\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := []string{"utf-8", "windows-1252", "shift_jis", "koi8-r", "gbk", "x-made-up"}
+	if got := m.Charsets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Charsets = %q, want %q", got, want)
+	}
+
+	m, _ = Parse(crlf("Subject: plain\n\nhi\n"))
+	if got := m.Charsets(); len(got) != 0 {
+		t.Errorf("Charsets of a plain message = %q", got)
+	}
+}
+
+func TestCharsetLabels(t *testing.T) {
+	for _, c := range []struct {
+		label, data, want string
+	}{
+		{"windows-1251", "\xcf\xf0\xe8\xe2\xe5\xf2", "Привет"},
+		{"cp1251", "\xcf\xf0\xe8\xe2\xe5\xf2", "Привет"},
+		{"win-1251", "\xcf\xf0\xe8\xe2\xe5\xf2", "Привет"},
+		{"latin1", "caf\xe9", "café"},
+		{"iso8859-1", "caf\xe9", "café"},
+		{"ISO_8859-1", "caf\xe9", "café"},
+		{"ansi_x3.4-1968", "plain", "plain"},
+		{"gb2312", "\xd6\xd0\xce\xc4", "中文"},
+		{"ks_c_5601-1987", "\xc7\xd1\xb1\xb9", "한국"},
+		{"cp932", "\x93\xfa\x96\x7b", "日本"},
+		{"ibm437", "\x82", "é"},
+	} {
+		body, err := UTF8(c.label, []byte(c.data))
+		if err != nil || string(body) != c.want {
+			t.Errorf("%s: body %q (%v), want %q", c.label, body, err, c.want)
+		}
+
+		var q strings.Builder
+		for _, b := range []byte(c.data) {
+			fmt.Fprintf(&q, "=%02X", b)
+		}
+		header, err := Decode([]byte("=?" + c.label + "?Q?" + q.String() + "?="))
+		if err != nil || string(header) != c.want {
+			t.Errorf("%s: header %q (%v), want %q", c.label, header, err, c.want)
+		}
+	}
+
+	if _, err := UTF8("x-no-such-charset", []byte("data")); !errors.Is(err, ErrUnknownCharset) {
+		t.Errorf("unknown charset: %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+// DKIM signature verification.
+
+package eml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNSResolver looks up the TXT records holding the DKIM public keys. The
+// net package LookupTXT function, wrapped in a type, satisfies it.
+type DNSResolver interface {
+	LookupTXT(name string) ([]string, error)
+}
+
+// the resolver of the system, used when VerifyDKIM is given none
+type systemResolver struct{}
+
+func (systemResolver) LookupTXT(name string) ([]string, error) {
+	return net.LookupTXT(name)
+}
+
+// DKIMResult is the outcome of the verification of a DKIM-Signature
+type DKIMResult struct {
+	Domain   string // signing domain, the d= tag
+	Selector string // key selector, the s= tag
+	Result   string // pass, fail, temperror or permerror (RFC8601 2.7.1)
+	Err      error  // why the signature did not pass
+}
+
+// a field of the raw header block, as found in the message
+type rawField struct {
+	key string
+	raw []byte // the whole field, folded lines and CRLF included
+}
+
+// the b= tag of a DKIM-Signature, whose value is left out of the signed data
+var dkimSignatureValueR = regexp.MustCompile(`(^|;)(\s*b\s*=)[^;]*`)
+
+// parse a tag=value list (RFC6376 3.2), with the tags in lowercase
+func parseTagList(v string) map[string]string {
+	tags := make(map[string]string)
+	for _, t := range strings.Split(v, ";") {
+		if eq := strings.IndexByte(t, '='); eq > 0 {
+			tags[strings.ToLower(strings.TrimSpace(t[:eq]))] = strings.TrimSpace(t[eq+1:])
+		}
+	}
+	return tags
+}
+
+// remove the whitespace of a base64 tag value, which may be folded
+func stripWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// collapse the whitespace runs of s to a single space
+func collapseWhitespace(s []byte) []byte {
+	var out []byte
+	space := false
+	for _, c := range s {
+		if isWSP(c) {
+			space = true
+			continue
+		}
+		if space {
+			out = append(out, ' ')
+			space = false
+		}
+		out = append(out, c)
+	}
+	if space {
+		out = append(out, ' ')
+	}
+	return out
+}
+
+// canonicalize a header field with the simple or relaxed algorithm
+// (RFC6376 3.4.1 and 3.4.2). the field has no trailing CRLF when last
+func canonicalHeader(f rawField, relaxed, last bool) []byte {
+	if !relaxed {
+		raw := canonicalLineBreaks(f.raw)
+		if last {
+			raw = bytes.TrimSuffix(raw, []byte("\r\n"))
+		}
+		return raw
+	}
+
+	value := f.raw[bytes.IndexByte(f.raw, ':')+1:]
+	value = bytes.ReplaceAll(bytes.ReplaceAll(value, []byte("\r"), nil), []byte("\n"), nil)
+	value = bytes.TrimSpace(collapseWhitespace(value))
+
+	c := append([]byte(strings.ToLower(strings.TrimSpace(f.key))+":"), value...)
+	if !last {
+		c = append(c, "\r\n"...)
+	}
+	return c
+}
+
+// canonicalize a body with the simple or relaxed algorithm (RFC6376 3.4.3
+// and 3.4.4): the trailing empty lines are removed and, with relaxed, the
+// whitespace runs of each line are collapsed and the trailing ones removed
+func canonicalBody(body []byte, relaxed bool) []byte {
+	body = canonicalLineBreaks(body)
+
+	if relaxed {
+		lines := bytes.Split(body, []byte("\r\n"))
+		for i, l := range lines {
+			lines[i] = bytes.TrimRight(collapseWhitespace(l), " ")
+		}
+		body = bytes.Join(lines, []byte("\r\n"))
+	}
+
+	body = bytes.TrimRight(body, "\r\n")
+	if len(body) > 0 || !relaxed {
+		body = append(body, "\r\n"...)
+	}
+
+	return body
+}
+
+// get the fields of the header block, with their raw bytes
+func (m Message) rawFields() ([]rawField, error) {
+	block := append(append([]byte{}, m.Headers...), "\r\n\r\n"...)
+
+	r, err := ParseRawWithOptions(block, RawOptions{HeaderSpans: true})
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]rawField, len(r.RawHeaders))
+	for i, s := range r.HeaderSpans {
+		fields[i] = rawField{s.Key, block[s.Start:s.End]}
+	}
+
+	return fields, nil
+}
+
+// fetch the public key of a selector and check that it is usable with the
+// key type of the signature algorithm
+func fetchDKIMKey(resolver DNSResolver, selector, domain, keyType string) (crypto.PublicKey, string, error) {
+	txts, err := resolver.LookupTXT(selector + "._domainkey." + domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, "permerror", fmt.Errorf("no key for selector %q: %w", selector, err)
+		}
+		return nil, "temperror", fmt.Errorf("key lookup: %w", err)
+	}
+
+	tags := parseTagList(strings.Join(txts, ""))
+	if k := strings.ToLower(tags["k"]); k != "" && k != keyType || k == "" && keyType != "rsa" {
+		return nil, "permerror", fmt.Errorf("key of type %q for a %s signature", tags["k"], keyType)
+	}
+
+	p := stripWhitespace(tags["p"])
+	if p == "" {
+		return nil, "permerror", errors.New("key revoked")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, "permerror", fmt.Errorf("key: %w", err)
+	}
+
+	if keyType == "ed25519" {
+		if len(data) != ed25519.PublicKeySize {
+			return nil, "permerror", errors.New("key: invalid ed25519 key")
+		}
+		return ed25519.PublicKey(data), "", nil
+	}
+
+	// some keys are published as a bare PKCS1 RSA key
+	pub, err := x509.ParsePKIXPublicKey(data)
+	if err != nil {
+		if pub, err = x509.ParsePKCS1PublicKey(data); err != nil {
+			return nil, "permerror", fmt.Errorf("key: %w", err)
+		}
+	}
+
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		return nil, "permerror", errors.New("key: not an RSA key")
+	}
+
+	return pub, "", nil
+}
+
+// verify a DKIM-Signature, the field at index sig of fields
+func (m Message) verifyDKIMSignature(fields []rawField, sig int, resolver DNSResolver) (r DKIMResult) {
+	value := fields[sig].raw[bytes.IndexByte(fields[sig].raw, ':')+1:]
+	tags := parseTagList(string(value))
+	r.Domain, r.Selector = tags["d"], tags["s"]
+
+	permerror := func(format string, a ...interface{}) DKIMResult {
+		r.Result, r.Err = "permerror", fmt.Errorf(format, a...)
+		return r
+	}
+
+	if tags["v"] != "1" {
+		return permerror("unsupported version %q", tags["v"])
+	}
+	for _, t := range []string{"a", "b", "bh", "d", "h", "s"} {
+		if tags[t] == "" {
+			return permerror("missing %s= tag", t)
+		}
+	}
+
+	var newHash func() hash.Hash
+	var cryptoHash crypto.Hash
+	var keyType string
+	switch strings.ToLower(tags["a"]) {
+	case "rsa-sha256":
+		newHash, cryptoHash, keyType = sha256.New, crypto.SHA256, "rsa"
+	case "rsa-sha1":
+		newHash, cryptoHash, keyType = sha1.New, crypto.SHA1, "rsa"
+	case "ed25519-sha256":
+		newHash, cryptoHash, keyType = sha256.New, crypto.SHA256, "ed25519"
+	default:
+		return permerror("unsupported algorithm %q", tags["a"])
+	}
+
+	if x := tags["x"]; x != "" {
+		if exp, err := strconv.ParseInt(x, 10, 64); err == nil && time.Now().Unix() > exp {
+			return permerror("signature expired")
+		}
+	}
+
+	headerC, bodyC, _ := strings.Cut(strings.ToLower(tags["c"]), "/")
+	relaxedHeader, relaxedBody := headerC == "relaxed", bodyC == "relaxed"
+
+	// the body hash covers the raw body, before any decoding
+	body := canonicalBody(m.Body, relaxedBody)
+	if l := tags["l"]; l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			return permerror("invalid l= tag %q", l)
+		}
+		if n < len(body) {
+			body = body[:n]
+		}
+	}
+
+	bh := newHash()
+	bh.Write(body)
+	if base64.StdEncoding.EncodeToString(bh.Sum(nil)) != stripWhitespace(tags["bh"]) {
+		r.Result, r.Err = "fail", errors.New("body hash mismatch")
+		return
+	}
+
+	// the signed fields are picked from the bottom up, a name listed more
+	// times than it appears matching nothing
+	h := newHash()
+	used := make(map[int]bool)
+	for _, name := range strings.Split(tags["h"], ":") {
+		name = strings.TrimSpace(name)
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(strings.TrimSpace(fields[i].key), name) {
+				used[i] = true
+				h.Write(canonicalHeader(fields[i], relaxedHeader, false))
+				break
+			}
+		}
+	}
+
+	signature := fields[sig]
+	k := strings.IndexByte(string(signature.raw), ':') + 1
+	signature.raw = append([]byte(string(signature.raw[:k])), dkimSignatureValueR.ReplaceAll(signature.raw[k:], []byte("$1$2"))...)
+	h.Write(canonicalHeader(signature, relaxedHeader, true))
+
+	sigData, err := base64.StdEncoding.DecodeString(stripWhitespace(tags["b"]))
+	if err != nil {
+		return permerror("invalid b= tag: %v", err)
+	}
+
+	key, result, err := fetchDKIMKey(resolver, r.Selector, r.Domain, keyType)
+	if err != nil {
+		r.Result, r.Err = result, err
+		return
+	}
+
+	switch pub := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, h.Sum(nil), sigData) {
+			err = errors.New("ed25519 verification error")
+		}
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, cryptoHash, h.Sum(nil), sigData)
+	}
+
+	if err != nil {
+		r.Result, r.Err = "fail", fmt.Errorf("signature mismatch: %w", err)
+		return
+	}
+
+	r.Result = "pass"
+	return
+}
+
+// VerifyDKIM checks each DKIM-Signature of the message (RFC6376), in the
+// order of the headers, fetching the public keys with resolver, or with the
+// system resolver when nil. The headers and the raw body are canonicalized
+// as the c= tag asks, so the message must be the one parsed, not a built
+// or modified one. An error is returned when the headers can't be read
+// back; the failures of each signature are reported in its result.
+func (m Message) VerifyDKIM(resolver DNSResolver) ([]DKIMResult, error) {
+	if resolver == nil {
+		resolver = systemResolver{}
+	}
+
+	fields, err := m.rawFields()
+	if err != nil {
+		return nil, fmt.Errorf("dkim: %w", err)
+	}
+
+	var results []DKIMResult
+	for i, f := range fields {
+		if strings.EqualFold(strings.TrimSpace(f.key), "DKIM-Signature") {
+			results = append(results, m.verifyDKIMSignature(fields, i, resolver))
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,127 @@
+package eml
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// a resolver answering from a fixed set of TXT records
+type stubResolver map[string]string
+
+func (r stubResolver) LookupTXT(name string) ([]string, error) {
+	if txt, ok := r[name]; ok {
+		return []string{txt}, nil
+	}
+	if name == "down._domainkey.example.com" {
+		return nil, errors.New("server failure")
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// sign a message whose headers are all on one line with ed25519-sha256 and
+// relaxed canonicalization, the way a signer would
+func signDKIM(t *testing.T, key ed25519.PrivateKey, selector, headers, body string) string {
+	t.Helper()
+
+	relaxed := func(s string) string { return strings.Join(strings.Fields(s), " ") }
+
+	var cb string
+	for _, line := range strings.Split(strings.TrimRight(body, "\r\n"), "\r\n") {
+		cb += relaxed(line) + "\r\n"
+	}
+	bh := sha256.Sum256([]byte(cb))
+
+	sig := "v=1; a=ed25519-sha256; c=relaxed/relaxed; d=example.com; s=" + selector +
+		"; h=from:to:subject; bh=" + base64.StdEncoding.EncodeToString(bh[:]) + "; b="
+
+	var data string
+	for _, f := range strings.Split(strings.TrimSuffix(headers, "\r\n"), "\r\n") {
+		k, v, _ := strings.Cut(f, ":")
+		data += strings.ToLower(k) + ":" + relaxed(v) + "\r\n"
+	}
+	data += "dkim-signature:" + sig
+
+	h := sha256.Sum256([]byte(data))
+	return "DKIM-Signature: " + sig + base64.StdEncoding.EncodeToString(ed25519.Sign(key, h[:])) + "\r\n"
+}
+
+func TestVerifyDKIM(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := stubResolver{
+		"sel._domainkey.example.com": "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub),
+	}
+
+	headers := "From: Alice <alice@example.com>\r\nTo:  bob@example.com\r\nSubject: Hello   there\r\n"
+	body := "Hello  world \r\n\r\nbye\r\n\r\n"
+
+	for _, c := range []struct {
+		name     string
+		selector string
+		body     string
+		want     string
+	}{
+		{"signed", "sel", body, "pass"},
+		{"tampered body", "sel", strings.Replace(body, "bye", "buy", 1), "fail"},
+		{"relaxed whitespace", "sel", "Hello world\r\n\r\nbye  \r\n", "pass"},
+		{"no key", "missing", body, "permerror"},
+		{"lookup failure", "down", body, "temperror"},
+	} {
+		raw := signDKIM(t, key, c.selector, headers, body) + headers + "\r\n" + c.body
+
+		m, errs := Parse([]byte(raw))
+		if len(errs) > 0 {
+			t.Fatalf("%s: %v", c.name, errs)
+		}
+
+		results, err := m.VerifyDKIM(resolver)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("%s: %d results, want 1", c.name, len(results))
+		}
+
+		r := results[0]
+		if r.Result != c.want {
+			t.Errorf("%s: result %s (%v), want %s", c.name, r.Result, r.Err, c.want)
+		}
+		if r.Domain != "example.com" || r.Selector != c.selector {
+			t.Errorf("%s: signed by %s of %s", c.name, r.Selector, r.Domain)
+		}
+	}
+}
+
+func TestVerifyDKIMTamperedHeader(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := stubResolver{
+		"sel._domainkey.example.com": "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub),
+	}
+
+	headers := "From: alice@example.com\r\nTo: bob@example.com\r\nSubject: Hello\r\n"
+	raw := signDKIM(t, key, "sel", headers, "hi\r\n") +
+		strings.Replace(headers, "Hello", "Goodbye", 1) + "\r\nhi\r\n"
+
+	m, errs := Parse([]byte(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	results, err := m.VerifyDKIM(resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Result != "fail" {
+		t.Errorf("results %+v, want one fail", results)
+	}
+}
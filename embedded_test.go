@@ -0,0 +1,89 @@
+package eml
+
+import (
+	"reflect"
+	"testing"
+)
+
+// a message forwarding a message that forwards another one, each level
+// with an attachment of its own
+const forwardChainMessage = `From: carol@example.com
+Subject: Fwd: Fwd: report
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=outer
+
+--outer
+Content-Type: text/plain
+
+see below
+--outer
+Content-Type: message/rfc822
+
+From: bob@example.com
+Subject: Fwd: report
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=middle
+
+--middle
+Content-Type: text/plain
+
+forwarding
+--middle
+Content-Type: application/pdf
+Content-Disposition: attachment; filename="notes.pdf"
+
+%PDF
+--middle
+Content-Type: message/rfc822
+Content-Disposition: attachment; filename="report.eml"
+
+From: alice@example.com
+Subject: report
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=inner
+
+--inner
+Content-Type: text/plain
+
+the report
+--inner
+Content-Type: text/csv
+Content-Disposition: attachment; filename="report.csv"
+
+a,b
+--inner--
+--middle--
+--outer--
+`
+
+func TestEmbeddedForwardChain(t *testing.T) {
+	m, errs := Parse(crlf(forwardChainMessage))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if len(m.Embedded) != 1 {
+		t.Fatalf("%d embedded messages, want 1", len(m.Embedded))
+	}
+	fwd := m.Embedded[0]
+	if fwd.Subject != "Fwd: report" || fwd.Text != "forwarding" {
+		t.Errorf("forwarded message %q with text %q", fwd.Subject, fwd.Text)
+	}
+	if names, _ := attachmentNames(t, fwd); !reflect.DeepEqual(names, []string{"notes.pdf", "report.eml"}) {
+		t.Errorf("forwarded attachments %q", names)
+	}
+
+	if len(fwd.Embedded) != 1 {
+		t.Fatalf("%d messages embedded in the forward, want 1", len(fwd.Embedded))
+	}
+	orig := fwd.Embedded[0]
+	if orig.Subject != "report" || orig.Text != "the report" {
+		t.Errorf("original message %q with text %q", orig.Subject, orig.Text)
+	}
+	if names, _ := attachmentNames(t, orig); !reflect.DeepEqual(names, []string{"report.csv"}) {
+		t.Errorf("original attachments %q", names)
+	}
+	if len(orig.Embedded) != 0 {
+		t.Errorf("%d messages embedded in the original", len(orig.Embedded))
+	}
+}
@@ -0,0 +1,155 @@
+// Encoding of messages for serialization.
+
+package eml
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+	"unicode/utf8"
+)
+
+// line length limit recommended by RFC5322 when writing headers
+const maxLineLength = 78
+
+// fold a header field into lines of up to 78 characters, ended by a CRLF.
+// the lines are only broken at the whitespace between tokens, so addresses
+// in angle brackets, quoted strings and encoded-words are never split. a
+// token longer than the limit is kept whole on its own line
+func foldHeader(key, value string) string {
+	var b strings.Builder
+
+	b.WriteString(key)
+	b.WriteString(":")
+	line := len(key) + 1
+
+	for i, chunk := range splitFoldable(" " + value) {
+		if i > 0 && line+len(chunk) > maxLineLength {
+			b.WriteString("\r\n")
+			line = 0
+		}
+
+		b.WriteString(chunk)
+		line += len(chunk)
+	}
+
+	b.WriteString("\r\n")
+
+	return b.String()
+}
+
+// RFC2047 encode the words of a header value that are not plain ASCII.
+// consecutive non-ASCII words share an encoded-word and the ASCII ones are
+// kept as they are, so an address after a display name stays readable
+func encodeHeaderValue(v string) string {
+	if isASCII(v) {
+		return v
+	}
+
+	words := strings.Split(v, " ")
+	for i := 0; i < len(words); i++ {
+		if isASCII(words[i]) {
+			continue
+		}
+
+		j := i + 1
+		for j < len(words) && !isASCII(words[j]) {
+			j++
+		}
+
+		encoded := mime.QEncoding.Encode("utf-8", strings.Join(words[i:j], " "))
+		words = append(words[:i], append([]string{encoded}, words[j:]...)...)
+	}
+
+	return strings.Join(words, " ")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// write a header field, encoded and folded
+func writeHeader(w io.Writer, key, value string) error {
+	_, err := io.WriteString(w, foldHeader(key, encodeHeaderValue(value)))
+	return err
+}
+
+// split a header value on the points where it can be folded. each chunk
+// starts with the whitespace that precedes it, so writing a line break
+// before any chunk unfolds back to the original value
+func splitFoldable(s string) (chunks []string) {
+	quoted, escaped, angle := false, false, 0
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '<':
+			angle++
+		case c == '>' && angle > 0:
+			angle--
+		case angle == 0 && isWSP(c) && i > start && !isWSP(s[i-1]):
+			chunks = append(chunks, s[start:i])
+			start = i
+		}
+	}
+
+	return append(chunks, s[start:])
+}
+
+// EncodeQuotedPrintable encodes data as quoted-printable text. The lines are
+// soft wrapped at 76 characters, line breaks are written as CRLF and the
+// trailing whitespace of each line is encoded so it survives transport.
+func EncodeQuotedPrintable(data []byte) []byte {
+	var b bytes.Buffer
+
+	w := quotedprintable.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+
+	return b.Bytes()
+}
+
+// wraps the written data in lines of up to 76 characters, as required for
+// base64 encoded bodies
+type lineWrapper struct {
+	w    io.Writer
+	line int
+}
+
+func (l *lineWrapper) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if l.line == 76 {
+			if _, err = io.WriteString(l.w, "\r\n"); err != nil {
+				return
+			}
+			l.line = 0
+		}
+
+		k := min(76-l.line, len(p))
+		if _, err = l.w.Write(p[:k]); err != nil {
+			return
+		}
+
+		l.line += k
+		n += k
+		p = p[k:]
+	}
+
+	return
+}
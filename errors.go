@@ -0,0 +1,65 @@
+// Errors returned by the parsers.
+
+package eml
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnexpectedEOF is returned when the message ends within its headers
+	ErrUnexpectedEOF = errors.New("unexpected EOF")
+
+	// ErrNoBoundary is returned for a multipart without a boundary parameter
+	ErrNoBoundary = errors.New("multipart specified without boundary")
+
+	// ErrBadMediaType is returned for a Content-Type that can't be parsed
+	ErrBadMediaType = errors.New("bad media type")
+
+	// ErrUnknownCharset is returned for a text or an encoded-word in a
+	// charset that can't be decoded
+	ErrUnknownCharset = errors.New("unknown charset")
+)
+
+// AddressParseError is returned when an address or an address list can't be
+// parsed. It carries the token the parser stopped at and its byte offset in
+// the parsed value.
+type AddressParseError struct {
+	Reason string // what is wrong, e.g. "unbalanced comment"
+	Token  string // offending token
+	Pos    int    // byte offset of Token in the parsed value, -1 if unknown
+
+	tok token // the token as a slice of the parsed value, to locate it
+}
+
+func (e *AddressParseError) Error() string {
+	if e.Pos < 0 {
+		return fmt.Sprintf("%s: %q", e.Reason, e.Token)
+	}
+	return fmt.Sprintf("%s: %q at offset %d", e.Reason, e.Token, e.Pos)
+}
+
+// error for an address at token t, located later by locateAddressError
+func addressError(reason string, t token) *AddressParseError {
+	return &AddressParseError{Reason: reason, Token: string(t), Pos: -1, tok: t}
+}
+
+// set the position of an address error raised while parsing s
+func locateAddressError(s []byte, err error) error {
+	var ae *AddressParseError
+	if errors.As(err, &ae) && ae.Pos < 0 {
+		ae.Pos = tokenOffset(s, ae.tok)
+	}
+	return err
+}
+
+// offset of token t in s, when t is a slice of it, or -1. the tokens
+// inserted while parsing, which are not found in s, have no offset
+func tokenOffset(s []byte, t token) int {
+	off := cap(s) - cap(t)
+	if len(t) == 0 || off < 0 || off >= len(s) || &s[off] != &t[0] {
+		return -1
+	}
+	return off
+}
@@ -0,0 +1,58 @@
+package eml
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		raw  string
+		want error
+	}{
+		{"truncated headers", "From: a@example.com\r\nSubj", ErrUnexpectedEOF},
+		{"multipart without boundary", "Content-Type: multipart/mixed\r\n\r\nbody\r\n", ErrNoBoundary},
+		{"bad media type", "Content-Type: text/plain; =broken\r\n\r\nbody\r\n", ErrBadMediaType},
+		{"nested multipart without boundary", "Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\nContent-Type: multipart/alternative\r\n\r\nx\r\n--b--\r\n", ErrNoBoundary},
+	} {
+		_, errs := Parse([]byte(c.raw))
+
+		found := false
+		for _, err := range errs {
+			found = found || errors.Is(err, c.want)
+		}
+		if !found {
+			t.Errorf("%s: errors %v, want %v", c.name, errs, c.want)
+		}
+	}
+}
+
+func TestAddressParseError(t *testing.T) {
+	for _, c := range []struct {
+		in    string
+		token string
+		pos   int
+	}{
+		{"John (unclosed <john@example.com>", "(", 5},
+		{"john@example.com>", ">", 16},
+	} {
+		_, err := parseAddressList([]byte(c.in))
+
+		var ae *AddressParseError
+		if !errors.As(err, &ae) {
+			t.Errorf("%q: error %v, want an AddressParseError", c.in, err)
+			continue
+		}
+		if ae.Token != c.token || ae.Pos != c.pos {
+			t.Errorf("%q: token %q at %d, want %q at %d", c.in, ae.Token, ae.Pos, c.token, c.pos)
+		}
+	}
+}
+
+func TestUnknownCharsetError(t *testing.T) {
+	_, err := UTF8("x-no-such-charset", []byte("text"))
+	if !errors.Is(err, ErrUnknownCharset) {
+		t.Errorf("error %v, want ErrUnknownCharset", err)
+	}
+}
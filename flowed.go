@@ -0,0 +1,67 @@
+// Decoding of format=flowed text (RFC3676).
+
+package eml
+
+import (
+	"strings"
+)
+
+// join the soft broken lines of a format=flowed text. a line ending with a
+// space continues on the next line with the same quote depth; with DelSp,
+// that space was added by the sender and is removed when joining. the
+// signature separator "-- " is never flowed
+func decodeFlowed(text string, delSp bool) string {
+	nl := "\n"
+	if strings.Contains(text, "\r\n") {
+		nl = "\r\n"
+	}
+
+	var out []string
+	var para strings.Builder
+	open, openDepth := false, 0
+
+	flush := func() {
+		if open {
+			out = append(out, quotePrefix(openDepth)+para.String())
+			para.Reset()
+			open = false
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		depth := 0
+		for depth < len(line) && line[depth] == '>' {
+			depth++
+		}
+		line = line[depth:]
+
+		// space-stuffed line
+		line = strings.TrimPrefix(line, " ")
+
+		if open && depth != openDepth {
+			flush()
+		}
+
+		flowed := strings.HasSuffix(line, " ") && line != "-- "
+		if flowed && delSp {
+			line = line[:len(line)-1]
+		}
+
+		para.WriteString(line)
+		open, openDepth = true, depth
+
+		if !flowed {
+			flush()
+		}
+	}
+	flush()
+
+	return strings.Join(out, nl)
+}
+
+func quotePrefix(depth int) string {
+	if depth == 0 {
+		return ""
+	}
+	return strings.Repeat(">", depth) + " "
+}
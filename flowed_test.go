@@ -0,0 +1,36 @@
+package eml
+
+import "testing"
+
+func TestFlowedDelSp(t *testing.T) {
+	body := "Das ist ein sehr lan \ngerWort und ein \nSatz.\n> quoted \n> line\n-- \nsig\n"
+
+	for _, c := range []struct {
+		params, want string
+	}{
+		{"; format=flowed; delsp=yes", "Das ist ein sehr langerWort und einSatz.\r\n> quotedline\r\n-- \r\nsig\r\n"},
+		{"; format=flowed; delsp=no", "Das ist ein sehr lan gerWort und ein Satz.\r\n> quoted line\r\n-- \r\nsig\r\n"},
+		{"; format=flowed", "Das ist ein sehr lan gerWort und ein Satz.\r\n> quoted line\r\n-- \r\nsig\r\n"},
+		{"; format=Flowed; DelSp=Yes", "Das ist ein sehr langerWort und einSatz.\r\n> quotedline\r\n-- \r\nsig\r\n"},
+		{"; format=fixed; delsp=yes", "Das ist ein sehr lan \r\ngerWort und ein \r\nSatz.\r\n> quoted \r\n> line\r\n-- \r\nsig\r\n"},
+		{"", "Das ist ein sehr lan \r\ngerWort und ein \r\nSatz.\r\n> quoted \r\n> line\r\n-- \r\nsig\r\n"},
+	} {
+		m, errs := Parse(crlf("Content-Type: text/plain; charset=utf-8" + c.params + "\n\n" + body))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if m.Text != c.want {
+			t.Errorf("%q: %q, want %q", c.params, m.Text, c.want)
+		}
+	}
+}
+
+func TestFlowedQuoteDepth(t *testing.T) {
+	text := "> first \n>> nested \n>> end\n> back\n >not a quote \nlast\n"
+	want := "> first \n>> nested end\n> back\n>not a quote last\n"
+
+	if got := decodeFlowed(text, false); got != want {
+		t.Errorf("%q, want %q", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+// Detection of inline forwarded messages.
+
+package eml
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// lines introducing the header block of an inline forward, as written by:
+//   - Gmail:       ---------- Forwarded message ---------
+//   - Thunderbird: -------- Forwarded Message --------
+//   - Outlook:     -----Original Message----- (or a line of underscores)
+//   - Apple Mail:  Begin forwarded message:
+var forwardMarkerR = regexp.MustCompile(`(?i)^\s*(-+\s*(forwarded message|original message)\s*-+|_{10,}|begin forwarded message:)\s*$`)
+
+// layouts of the dates written on the forward header blocks, besides the
+// RFC5322 ones
+var forwardDateFormats = []string{
+	`Mon, Jan 2, 2006 at 3:04 PM`,
+	`Mon, Jan 2, 2006 at 15:04`,
+	`Monday, January 2, 2006 3:04 PM`,
+	`Monday, January 2, 2006 3:04:05 PM`,
+	`Monday, January 2, 2006 15:04`,
+	`January 2, 2006 at 3:04:05 PM MST`,
+	`January 2, 2006 at 3:04 PM MST`,
+	`2 January 2006 at 15:04:05 MST`,
+	`1/2/2006 3:04:05 PM`,
+	`1/2/2006 3:04 PM`,
+}
+
+func parseForwardDate(s string) time.Time {
+	if t, ok := parseDate(s); ok {
+		return t
+	}
+
+	s = strings.Join(strings.Fields(s), " ")
+	for _, f := range forwardDateFormats {
+		if t, err := time.Parse(f, s); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// ForwardedHeaders extracts the sender, subject and date of a message
+// forwarded inline, from the header block that the mail clients write on the
+// text body. The Gmail, Thunderbird, Outlook and Apple Mail formats are
+// recognized. ok is false when no block with a From line is found; the date
+// is the zero time when it is missing or written in an unknown layout.
+func (m Message) ForwardedHeaders() (from, subject string, date time.Time, ok bool) {
+	lines := strings.Split(strings.ReplaceAll(m.Text, "\r\n", "\n"), "\n")
+
+	for i, l := range lines {
+		if !forwardMarkerR.MatchString(l) {
+			continue
+		}
+
+		// read the header lines of the block, which ends on the first
+		// blank line after the headers or on a line that is not a header
+		for _, hl := range lines[i+1:] {
+			hl = strings.TrimSpace(strings.TrimLeft(hl, ">"))
+			if hl == "" {
+				if from == "" && subject == "" {
+					continue
+				}
+				break
+			}
+
+			kv := strings.SplitN(hl, ":", 2)
+			if len(kv) != 2 {
+				break
+			}
+
+			// Gmail writes the keys in bold when converting from HTML
+			value := strings.TrimSpace(strings.Trim(strings.TrimSpace(kv[1]), "*"))
+			switch strings.ToLower(strings.Trim(strings.TrimSpace(kv[0]), "*")) {
+			case "from":
+				from = value
+			case "subject":
+				subject = value
+			case "date", "sent":
+				date = parseForwardDate(value)
+			}
+		}
+
+		if from != "" {
+			return from, subject, date, true
+		}
+
+		from, subject, date = "", "", time.Time{}
+	}
+
+	return
+}
@@ -0,0 +1,94 @@
+package eml
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	for _, c := range []struct {
+		name, text    string
+		from, subject string
+		date          string
+	}{
+		{
+			"gmail",
+			"FYI\n\n---------- Forwarded message ---------\n" +
+				"*From:* Alice Doe <alice@example.com>\n" +
+				"*Date:* Mon, Oct 2, 2023 at 3:04 PM\n" +
+				"*Subject:* Quarterly report\n" +
+				"*To:* Bob <bob@example.com>\n\n" +
+				"Here it is.\n",
+			"Alice Doe <alice@example.com>", "Quarterly report", "2023-10-02T15:04:00Z",
+		},
+		{
+			"thunderbird",
+			"-------- Forwarded Message --------\n" +
+				"Subject: \tQuarterly report\n" +
+				"Date: \tMon, 2 Oct 2023 15:04:05 +0200\n" +
+				"From: \tAlice <alice@example.com>\n" +
+				"To: \tbob@example.com\n\nHere it is.\n",
+			"Alice <alice@example.com>", "Quarterly report", "2023-10-02T15:04:05+02:00",
+		},
+		{
+			"outlook",
+			"Please check.\n\n-----Original Message-----\n" +
+				"From: Alice <alice@example.com>\n" +
+				"Sent: Monday, October 2, 2023 3:04 PM\n" +
+				"To: Bob <bob@example.com>\n" +
+				"Subject: Quarterly report\n\nHere it is.\n",
+			"Alice <alice@example.com>", "Quarterly report", "2023-10-02T15:04:00Z",
+		},
+		{
+			"outlook underscores",
+			"________________________________\n" +
+				"From: Alice <alice@example.com>\n" +
+				"Sent: 10/2/2023 3:04 PM\n" +
+				"Subject: Quarterly report\n\nHere it is.\n",
+			"Alice <alice@example.com>", "Quarterly report", "2023-10-02T15:04:00Z",
+		},
+		{
+			"apple mail quoted",
+			"Begin forwarded message:\n\n" +
+				"> From: Alice <alice@example.com>\n" +
+				"> Subject: Quarterly report\n" +
+				"> Date: October 2, 2023 at 3:04:05 PM UTC\n" +
+				"> To: bob@example.com\n\n> Here it is.\n",
+			"Alice <alice@example.com>", "Quarterly report", "2023-10-02T15:04:05Z",
+		},
+		{
+			"unknown date layout",
+			"---------- Forwarded message ---------\n" +
+				"From: alice@example.com\n" +
+				"Date: yesterday\n" +
+				"Subject: Quarterly report\n\nHere it is.\n",
+			"alice@example.com", "Quarterly report", "0001-01-01T00:00:00Z",
+		},
+	} {
+		from, subject, date, ok := Message{Text: c.text}.ForwardedHeaders()
+		if !ok {
+			t.Errorf("%s: no forwarded headers", c.name)
+			continue
+		}
+
+		if from != c.from || subject != c.subject {
+			t.Errorf("%s: from %q, subject %q", c.name, from, subject)
+		}
+		if got := date.Format(time.RFC3339); got != c.date {
+			t.Errorf("%s: date %s, want %s", c.name, got, c.date)
+		}
+	}
+}
+
+func TestForwardedHeadersNone(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"Just a message.\nFrom: someone in the text\n",
+		"---------- Forwarded message ---------\nSubject: no sender\n\nbody\n",
+		"-----Original Message-----\nnot a header block\nFrom: alice@example.com\n",
+	} {
+		if from, _, _, ok := (Message{Text: text}).ForwardedHeaders(); ok {
+			t.Errorf("%q: from %q", text, from)
+		}
+	}
+}
@@ -3,8 +3,6 @@ module github.com/ncastellani/eml
 go 1.21.0
 
 require (
-	github.com/paulrosania/go-charset v0.0.0-20190326053356-55c9d7a5834c
 	golang.org/x/net v0.15.0
+	golang.org/x/text v0.13.0
 )
-
-require golang.org/x/text v0.13.0 // indirect
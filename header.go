@@ -4,14 +4,138 @@ package eml
 
 import (
 	"bytes"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
 )
 
-func split(ts []token, s token) [][]token {
+// get all the values of a header, ignoring the case of its key
+func (m Message) header(key string) (values []string) {
+	if m.fields == nil {
+		for k, v := range m.ParsedHeaders {
+			if strings.EqualFold(k, key) {
+				values = append(values, v...)
+			}
+		}
+		return
+	}
+
+	for _, f := range m.fields {
+		if strings.EqualFold(f[0], key) {
+			values = append(values, f[1])
+		}
+	}
+	return
+}
+
+// Header returns the values of the header named key, ignoring the case
+// (Received and received are the same header), in the order they appear
+// in the message.
+func (m Message) Header(key string) []string {
+	return m.header(key)
+}
+
+// HeaderKeys returns the names of the headers of the message in the order
+// they first appear, each listed once with the case of its first
+// occurrence.
+func (m Message) HeaderKeys() (keys []string) {
+	seen := make(map[string]bool)
+	for _, f := range m.fields {
+		if k := strings.ToLower(f[0]); !seen[k] {
+			seen[k] = true
+			keys = append(keys, f[0])
+		}
+	}
+	return
+}
+
+// HeadersByPrefix returns all the headers whose key starts with prefix,
+// ignoring the case (e.g. "X-Spam-" matches both X-Spam-Score and
+// x-spam-flag). The keys are kept as found in the message.
+func (m Message) HeadersByPrefix(prefix string) map[string][]string {
+	found := make(map[string][]string)
+	prefix = strings.ToLower(prefix)
+
+	for k, v := range m.ParsedHeaders {
+		if strings.HasPrefix(strings.ToLower(k), prefix) {
+			found[k] = append(found[k], v...)
+		}
+	}
+
+	return found
+}
+
+// NetMailHeader returns the headers of the message as a net/mail Header,
+// for code written against the standard library. The keys are canonical,
+// so Get works as with mail.ReadMessage, and the values are normalized
+// from this package parsers: the address lists are rewritten from the
+// parsed addresses, so AddressList accepts what net/mail alone would
+// reject, and the Date is written in the RFC5322 format.
+func (m Message) NetMailHeader() mail.Header {
+	h := make(mail.Header)
+
+	fields := m.fields
+	if fields == nil {
+		for k, vs := range m.ParsedHeaders {
+			for _, v := range vs {
+				fields = append(fields, [2]string{k, v})
+			}
+		}
+	}
+
+	for _, f := range fields {
+		key, v := textproto.CanonicalMIMEHeaderKey(f[0]), strings.TrimSpace(f[1])
+
+		switch {
+		case addressHeaders[strings.ToLower(key)]:
+			if al, err := parseAddressList(rawHeaderToUTF8([]byte(v), ParseOptions{})); err == nil {
+				v = formatAddressList(al)
+			}
+		case key == "Date" && !m.Date.IsZero():
+			v = m.Date.Format(time.RFC1123Z)
+		}
+
+		h[key] = append(h[key], v)
+	}
+
+	return h
+}
+
+// split the tokens of an address list on its commas. quoted strings and
+// comments are single tokens, so only the commas found inside a domain
+// literal ([...]) or an angle address (<...>) must be skipped, along with
+// the ones separating the mailboxes of a group (name: a@b, c@d;), which is
+// kept whole
+func split(ts []token) [][]token {
 	r, l := [][]token{}, 0
+	depth := 0
+	group := false
 	for i, t := range ts {
-		if string(t) == string(s) {
-			r = append(r, ts[l:i])
-			l = i + 1
+		switch string(t) {
+		case "[", "<":
+			depth++
+		case "]", ">":
+			if depth > 0 {
+				depth--
+			}
+		case ":":
+			if depth == 0 {
+				group = true
+			}
+		case ";":
+			if depth == 0 && group {
+				group = false
+				r = append(r, ts[l:i+1])
+				l = i + 1
+			}
+		case ",":
+			if depth == 0 && !group {
+				if i > l {
+					r = append(r, ts[l:i])
+				}
+				l = i + 1
+			}
 		}
 	}
 	if l != len(ts) {
@@ -20,51 +144,54 @@ func split(ts []token, s token) [][]token {
 	return r
 }
 
-// BUG: We don't currently support domain literals with commas.
-func parseAddressList(s []byte) ([]Address, error) {
-	al := []Address{}
+// check if the tokens are a group, ended by ";"
+func isGroup(ts []token) bool {
+	return len(ts) > 0 && string(ts[len(ts)-1]) == ";"
+}
 
-	// UTF8 decode the address list
-	dd, e := decodeRFC2047(s)
-	if e == nil {
-		s = []byte(dd)
+// check if any of the tokens has an "@"
+func hasAt(ts []token) bool {
+	for _, t := range ts {
+		if bytes.IndexByte(t, '@') >= 0 {
+			return true
+		}
 	}
+	return false
+}
 
+func parseAddressList(s []byte) ([]Address, error) {
+	al := []Address{}
+
+	// the encoded-words are decoded after the split, as they may hide
+	// commas and quotes
 	ts, e := tokenize(s)
 	if e != nil {
-		return al, e
+		return al, locateAddressError(s, e)
 	}
 
 	// split by groups (,)
-	stb := split(ts, []byte{','})
+	stb := split(ts)
 	var lsb []token
 	var vsb [][]token
 
 	for i, t := range stb {
-		var p []token
-		var fc []byte
-
-		for _, c := range t {
-			p = append(p, c)
-			fc = append(fc, c...)
-		}
+		at := hasAt(t) || isGroup(t)
 
-		lsb = append(lsb, p...)
-		if i != len(stb)-1 && !bytes.Contains(fc, []byte("@")) {
-			comma := []byte(",")
-			lsb = append(lsb, []token{comma}...)
+		lsb = append(lsb, t...)
+		if i != len(stb)-1 && !at {
+			lsb = append(lsb, token(","))
 		}
 
-		if bytes.Contains(fc, []byte("@")) || i == len(stb)-1 {
+		if at || i == len(stb)-1 {
 			vsb = append(vsb, lsb)
-			lsb = make([]token, 0)
+			lsb = nil
 		}
 	}
 
 	for _, ts := range vsb {
 		a, e := parseAddress(ts)
 		if e != nil {
-			return al, e
+			return al, locateAddressError(s, e)
 		}
 		al = append(al, a)
 	}
@@ -0,0 +1,317 @@
+package eml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAddressList(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want []string
+	}{
+		{`"Doe, John" <john@example.com>, jane@example.com`, []string{`"Doe, John" <john@example.com>`, "jane@example.com"}},
+		{`john@example.com (John, (the) Doe), jane@example.com`, []string{"john@example.com", "jane@example.com"}},
+		{`user@[192.168.0.1, 10.0.0.1], jane@example.com`, []string{"user@[192.168.0.1, 10.0.0.1]", "jane@example.com"}},
+		{`Managers: alice@x.com, bob@y.com;, carol@z.com`, []string{"Managers: alice@x.com, bob@y.com;", "carol@z.com"}},
+		{`undisclosed-recipients:;`, []string{"undisclosed-recipients:;"}},
+		{`=?utf-8?q?M=C3=BCller=2C_Hans?= <h@x.de>`, []string{"=?utf-8?b?TcO8bGxlciwgSGFucw==?= <h@x.de>"}},
+		{`müller@bücher.de, 用户@例子.公司`, []string{"müller@bücher.de", "用户@例子.公司"}},
+	} {
+		al, err := parseAddressList([]byte(c.in))
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+
+		var got []string
+		for _, a := range al {
+			got = append(got, a.String())
+		}
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("%q: got %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestGroupMailboxes(t *testing.T) {
+	al, err := parseAddressList([]byte("A:  a@x.com ,b@x.com ; , B: c@y.com;, empty:;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counts []int
+	for _, a := range al {
+		g, ok := a.(GroupAddr)
+		if !ok {
+			t.Fatalf("%q is not a group", a)
+		}
+		counts = append(counts, len(g.Mailboxes()))
+	}
+	if fmt.Sprint(counts) != "[2 1 0]" {
+		t.Errorf("group sizes %v", counts)
+	}
+}
+
+func TestAddressStringRoundTrip(t *testing.T) {
+	for _, in := range []string{
+		`"Doe, John" <john@example.com>`,
+		`Zoë Smith <zoe@example.com>`,
+		`"quoted \"name\"" <a@example.com>`,
+		`"first.last"@example.com`,
+		`plain@example.com`,
+	} {
+		a, err := ParseAddress([]byte(in))
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+
+		b, err := ParseAddress([]byte(a.String()))
+		if err != nil {
+			t.Errorf("%q: %v", a.String(), err)
+			continue
+		}
+		if a.String() != b.String() || a.Name() != b.Name() || a.Email() != b.Email() {
+			t.Errorf("%q: %q then %q", in, a.String(), b.String())
+		}
+	}
+}
+
+// a To header of 500 recipients, with quoted names, comments and
+// encoded-words
+func largeAddressList() []byte {
+	var b strings.Builder
+	for i := 0; i < 500; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&b, "user%d@example.com", i)
+		case 1:
+			fmt.Fprintf(&b, `"Doe, John %d" <john%d@example.com>`, i, i)
+		case 2:
+			fmt.Fprintf(&b, "=?utf-8?q?J=C3=BCrgen_%d?= <j%d@example.de>", i, i)
+		case 3:
+			fmt.Fprintf(&b, "Jane %d <jane%d@example.org> (work)", i, i)
+		}
+	}
+	return []byte(b.String())
+}
+
+func BenchmarkParseAddressList(b *testing.B) {
+	list := largeAddressList()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(list)))
+	for i := 0; i < b.N; i++ {
+		al, err := parseAddressList(list)
+		if err != nil || len(al) != 500 {
+			b.Fatalf("%d addresses: %v", len(al), err)
+		}
+	}
+}
+
+func TestAddressComments(t *testing.T) {
+	raw := "From: noreply@example.com (Automated System)\n" +
+		"To: (first) Bob <bob@example.com> (second), carol@example.com\n" +
+		"Cc: dave@example.com (=?utf-8?q?Zo=C3=AB?= (nested))\n\nhi\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	comments := func(a Address) []string {
+		return a.(MailboxAddr).Comments()
+	}
+
+	if len(m.From) != 1 || m.From[0].Email() != "noreply@example.com" {
+		t.Fatalf("From = %v", m.From)
+	}
+	if got := comments(m.From[0]); !reflect.DeepEqual(got, []string{"Automated System"}) {
+		t.Errorf("From comments %q", got)
+	}
+
+	if len(m.To) != 2 {
+		t.Fatalf("To = %v", m.To)
+	}
+	if got := comments(m.To[0]); !reflect.DeepEqual(got, []string{"first", "second"}) {
+		t.Errorf("To comments %q", got)
+	}
+	if m.To[0].Name() != "Bob" {
+		t.Errorf("To name %q", m.To[0].Name())
+	}
+	if got := comments(m.To[1]); len(got) != 0 {
+		t.Errorf("To comments %q", got)
+	}
+
+	if len(m.Cc) != 1 {
+		t.Fatalf("Cc = %v", m.Cc)
+	}
+	if got := comments(m.Cc[0]); !reflect.DeepEqual(got, []string{"Zoë (nested)"}) {
+		t.Errorf("Cc comments %q", got)
+	}
+}
+
+func TestHeadersByPrefix(t *testing.T) {
+	raw := "X-Spam-Score: 5.1\n" +
+		"x-spam-flag: YES\n" +
+		"X-SPAM-Status: Yes, score=5.1\n" +
+		"X-Spam-Flag: NO\n" +
+		"X-Spamd-Result: default\n" +
+		"X-Other: y\n" +
+		"Subject: X-Spam-Flag\n\nhi\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := map[string][]string{
+		"X-Spam-Score":  {"5.1"},
+		"x-spam-flag":   {"YES"},
+		"X-SPAM-Status": {"Yes, score=5.1"},
+		"X-Spam-Flag":   {"NO"},
+	}
+	for _, prefix := range []string{"X-Spam-", "x-spam-", "X-SPAM-"} {
+		if got := m.HeadersByPrefix(prefix); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: %q, want %q", prefix, got, want)
+		}
+	}
+
+	if got := m.HeadersByPrefix("X-Microsoft-"); len(got) != 0 {
+		t.Errorf("X-Microsoft-: %q", got)
+	}
+	if got := m.HeadersByPrefix(""); len(got) != 7 {
+		t.Errorf("empty prefix: %d headers", len(got))
+	}
+}
+
+func TestCommentsHeader(t *testing.T) {
+	raw := "Comments: =?utf-8?q?Caf=C3=A9?=\n" +
+		" =?utf-8?q?_au_lait?= reviewed\n" +
+		"\tby the team\n" +
+		"Comments: second comment\n\nhi\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := []string{"Café au lait reviewed by the team", "second comment"}
+	if !reflect.DeepEqual(m.Comments, want) {
+		t.Errorf("Comments = %q, want %q", m.Comments, want)
+	}
+}
+
+func TestHeaderOrder(t *testing.T) {
+	raw := "Received: from c by d;\n\tMon, 2 Oct 2023 10:00:02 +0000\n" +
+		"From: a@example.com\n" +
+		"received: from b by c; Mon, 2 Oct 2023 10:00:01 +0000\n" +
+		"Subject: a folded\n subject\n" +
+		"RECEIVED: from a by b; Mon, 2 Oct 2023 10:00:00 +0000\n" +
+		"X-Trace: one\n" +
+		"from: second@example.com\n" +
+		"X-Trace: two\n\nhi\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	keys := []string{"Received", "From", "Subject", "X-Trace"}
+	if got := m.HeaderKeys(); !reflect.DeepEqual(got, keys) {
+		t.Errorf("HeaderKeys = %q, want %q", got, keys)
+	}
+
+	received := []string{
+		"from c by d; Mon, 2 Oct 2023 10:00:02 +0000",
+		"from b by c; Mon, 2 Oct 2023 10:00:01 +0000",
+		"from a by b; Mon, 2 Oct 2023 10:00:00 +0000",
+	}
+	for _, key := range []string{"Received", "received", "RECEIVED", "ReCeIvEd"} {
+		if got := m.Header(key); !reflect.DeepEqual(got, received) {
+			t.Errorf("Header(%q) = %q", key, got)
+		}
+	}
+
+	if got := m.Header("x-trace"); !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("Header(x-trace) = %q", got)
+	}
+	if got := m.Header("Subject"); !reflect.DeepEqual(got, []string{"a folded subject"}) {
+		t.Errorf("Header(Subject) = %q", got)
+	}
+	if got := m.Header("FROM"); !reflect.DeepEqual(got, []string{"a@example.com", "second@example.com"}) {
+		t.Errorf("Header(FROM) = %q", got)
+	}
+	if got := m.Header("Missing"); got != nil {
+		t.Errorf("Header(Missing) = %q", got)
+	}
+}
+
+func TestNetMailHeader(t *testing.T) {
+	raw := "From: =?utf-8?q?Zo=C3=AB?= <zoe@example.com>\r\n" +
+		"To: \"Doe, John\" <john@example.com>, jane@example.com (Jane,\r\n (the) Doe),\r\n Team: alice@example.com, bob@example.com;\r\n" +
+		"cc: =?utf-8?q?M=C3=BCller=2C_Hans?= <h@example.de>\r\n" +
+		"Date: 2 Oct 2023 10:00 +0200\r\n" +
+		"subject: hello\r\n" +
+		"X-Tag: one\r\nX-Tag: two\r\n\r\nbody"
+
+	m, errs := Parse([]byte(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	h := m.NetMailHeader()
+	if h.Get("Subject") != "hello" || !reflect.DeepEqual(h["X-Tag"], []string{"one", "two"}) {
+		t.Errorf("Subject %q, X-Tag %q", h.Get("Subject"), h["X-Tag"])
+	}
+	if d, err := h.Date(); err != nil || !d.Equal(m.Date) {
+		t.Errorf("Date %v (%v), want %v", d, err, m.Date)
+	}
+
+	for _, c := range []struct {
+		key  string
+		want []Address
+		n    int
+	}{
+		{"From", m.From, 1},
+		{"To", m.To, 4},
+		{"Cc", m.Cc, 1},
+	} {
+		al, err := h.AddressList(c.key)
+		if err != nil || len(al) != c.n {
+			t.Errorf("%s: %d addresses (%v), want %d", c.key, len(al), err, c.n)
+			continue
+		}
+
+		// the groups are flattened by net/mail
+		var want []string
+		for _, a := range c.want {
+			if g, ok := a.(GroupAddr); ok {
+				for _, mb := range g.Mailboxes() {
+					want = append(want, mb.Name()+" <"+mb.Email()+">")
+				}
+				continue
+			}
+			want = append(want, a.Name()+" <"+a.Email()+">")
+		}
+
+		var got []string
+		for _, a := range al {
+			name := a.Name
+			if name == "" {
+				name = a.Address
+			}
+			got = append(got, name+" <"+a.Address+">")
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: AddressList %q, want %q", c.key, got, want)
+		}
+	}
+}
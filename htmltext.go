@@ -0,0 +1,180 @@
+// Plain text rendering of the HTML body.
+
+package eml
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// line breaks written around the block elements: 2 for a blank line
+var htmlBlockBreaks = map[string]int{
+	"p": 2, "h1": 2, "h2": 2, "h3": 2, "h4": 2, "h5": 2, "h6": 2,
+	"table": 2, "blockquote": 2, "pre": 2, "ul": 2, "ol": 2, "hr": 2,
+	"div": 1, "tr": 1, "li": 1, "dt": 1, "dd": 1, "section": 1,
+	"article": 1, "header": 1, "footer": 1, "center": 1,
+}
+
+// elements whose contents are not displayed
+var htmlHiddenElements = map[string]bool{
+	"script": true, "style": true, "head": true, "title": true, "noscript": true, "template": true,
+}
+
+// collapse the runs of whitespace of an HTML text to a single space, as
+// rendered by a browser
+func collapseSpaces(s string) string {
+	if s == "" {
+		return s
+	}
+
+	text := strings.Join(strings.Fields(s), " ")
+	if r, _ := utf8.DecodeRuneInString(s); unicode.IsSpace(r) {
+		text = " " + text
+	}
+	if r, _ := utf8.DecodeLastRuneInString(s); unicode.IsSpace(r) && text != " " {
+		text += " "
+	}
+
+	return text
+}
+
+// render an HTML document as plain text, as described by TextFromHTML
+func htmlToText(s string) string {
+	var b strings.Builder
+	skip, pre := 0, 0
+
+	// end the output with at least n line breaks, unless nothing was written
+	breakLine := func(n int) {
+		out := b.String()
+		if strings.TrimSpace(out) == "" {
+			return
+		}
+		for have := len(out) - len(strings.TrimRight(out, "\n")); have < n; have++ {
+			b.WriteByte('\n')
+		}
+	}
+
+	// the targets of the links being written, with the length of the output
+	// at their start to get their text
+	type link struct {
+		href  string
+		start int
+	}
+	var links []link
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		name, hasAttr := z.TagName()
+		tag := string(name)
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if htmlHiddenElements[tag] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+
+			switch tag {
+			case "br":
+				b.WriteByte('\n')
+			case "pre":
+				pre++
+			case "td", "th":
+				if out := b.String(); out != "" && !strings.HasSuffix(out, "\n") {
+					b.WriteByte('\t')
+				}
+			case "a":
+				href := ""
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					if string(k) == "href" {
+						href = strings.TrimSpace(string(v))
+					}
+				}
+				links = append(links, link{href, b.Len()})
+			}
+
+			breakLine(htmlBlockBreaks[tag])
+			if tag == "li" {
+				b.WriteString("- ")
+			}
+		case html.EndTagToken:
+			if htmlHiddenElements[tag] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+
+			switch tag {
+			case "pre":
+				if pre > 0 {
+					pre--
+				}
+			case "a":
+				if len(links) == 0 {
+					break
+				}
+				l := links[len(links)-1]
+				links = links[:len(links)-1]
+
+				// the target is only worth writing when the text doesn't
+				// already give it
+				text := strings.TrimSpace(b.String()[l.start:])
+				target := strings.TrimPrefix(l.href, "mailto:")
+				if l.href != "" && !strings.HasPrefix(l.href, "#") && !strings.HasPrefix(strings.ToLower(l.href), "javascript:") && text != target && text != l.href {
+					b.WriteString(" (" + l.href + ")")
+				}
+			}
+
+			breakLine(htmlBlockBreaks[tag])
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+
+			// the tokenizer decodes the entities
+			text := string(z.Text())
+			if pre == 0 {
+				text = collapseSpaces(text)
+				if out := b.String(); out == "" || strings.HasSuffix(out, "\n") || strings.HasSuffix(out, " ") || strings.HasSuffix(out, "\t") {
+					text = strings.TrimLeft(text, " ")
+				}
+			}
+			b.WriteString(text)
+		}
+	}
+
+	// trim the lines and keep a single blank line between paragraphs
+	var out []string
+	for _, l := range strings.Split(b.String(), "\n") {
+		l = strings.TrimRight(l, " \t")
+		if l == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+		out = append(out, l)
+	}
+
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// TextFromHTML returns the HTML body rendered as plain text, a readable
+// fallback for the messages without a text/plain part. Scripts, styles and
+// the head are left out, the entities are decoded, the whitespace is
+// collapsed as a browser would, the paragraphs, line breaks, table rows and
+// list items start new lines, and the links are written as "text (url)".
+// Html and Text are left untouched.
+func (m Message) TextFromHTML() string {
+	return htmlToText(m.Html)
+}
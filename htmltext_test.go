@@ -0,0 +1,45 @@
+package eml
+
+import (
+	"testing"
+)
+
+func TestTextFromHTML(t *testing.T) {
+	newsletter := `<!DOCTYPE html>
+<html><head><title>October news</title>
+<style>p { color: #333; }</style></head>
+<body><script>track();</script>
+<table width="100%"><tr><td>
+<h1>October   Newsletter</h1>
+<p>Hello <b>Alice</b>,<br>welcome to our
+ monthly update &amp; news.</p>
+<ul><li>New <i>features</i></li><li>Bug fixes</li></ul>
+<p>Read <a href="https://example.com/blog?a=1&amp;b=2">our blog</a> or visit <a href="https://example.com">https://example.com</a>.</p>
+<p><a href="mailto:info@example.com">info@example.com</a> | <a href="#top">Top</a></p>
+</td></tr></table></body></html>`
+
+	want := `October Newsletter
+
+Hello Alice,
+welcome to our monthly update & news.
+
+- New features
+- Bug fixes
+
+Read our blog (https://example.com/blog?a=1&b=2) or visit https://example.com.
+
+info@example.com | Top`
+
+	if got := (Message{Html: newsletter}).TextFromHTML(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDetectLanguageFromHTML(t *testing.T) {
+	m := Message{Html: `<html><head><style>body { font-family: the and of to }</style></head>
+<body><p>Hola, esta es la lista de los cambios que vamos a hacer para el proyecto con el equipo.</p></body></html>`}
+
+	if lang, _ := m.DetectLanguage(); lang != "es" {
+		t.Errorf("language %q, want es", lang)
+	}
+}
@@ -0,0 +1,51 @@
+// Body integrity checks.
+
+package eml
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"mime"
+	"strings"
+)
+
+// convert the line breaks of data to CRLF, the canonical form of text
+func canonicalLineBreaks(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// VerifyContentMD5 checks the message body against its Content-MD5 header
+// (RFC1864). The digest covers the body after the transfer decoding, in its
+// canonical form: the line breaks of text (and multipart) bodies are CRLF.
+// present is false when the message has no Content-MD5 header.
+func (m Message) VerifyContentMD5() (ok bool, present bool) {
+	v := m.header("Content-MD5")
+	if len(v) == 0 {
+		return false, false
+	}
+
+	want, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v[0]))
+	if err != nil || len(want) != md5.Size {
+		return false, true
+	}
+
+	body, _, err := decodeContentTransferEncoding(m.ParsedHeaders, nil, &m.Body)
+	if err != nil {
+		return false, true
+	}
+
+	mt := "text/plain"
+	if ct := m.header("Content-Type"); len(ct) > 0 {
+		mt, _, _ = mime.ParseMediaType(ct[0])
+	}
+
+	if strings.HasPrefix(mt, "text/") || strings.HasPrefix(mt, "multipart/") || strings.HasPrefix(mt, "message/") {
+		body = canonicalLineBreaks(body)
+	}
+
+	sum := md5.Sum(body)
+
+	return bytes.Equal(sum[:], want), true
+}
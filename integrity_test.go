@@ -0,0 +1,90 @@
+package eml
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"testing"
+)
+
+func contentMD5(data string) string {
+	sum := md5.Sum([]byte(data))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyContentMD5(t *testing.T) {
+	text := "hello\r\nworld\r\n"
+	binary := "\x00\x01\n\xff"
+
+	for _, c := range []struct {
+		name, raw   string
+		ok, present bool
+	}{
+		{
+			"text",
+			"Content-MD5: " + contentMD5(text) + "\r\n\r\n" + text,
+			true, true,
+		},
+		{
+			"text with bare line feeds",
+			"Content-Type: text/plain\nContent-MD5: " + contentMD5(text) + "\n\nhello\nworld\n",
+			true, true,
+		},
+		{
+			"base64 binary",
+			"Content-Type: application/octet-stream\r\nContent-Transfer-Encoding: base64\r\n" +
+				"Content-MD5: " + contentMD5(binary) + "\r\n\r\n" + base64.StdEncoding.EncodeToString([]byte(binary)) + "\r\n",
+			true, true,
+		},
+		{
+			"quoted-printable text",
+			"Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n" +
+				"Content-MD5: " + contentMD5("café\r\n") + "\r\n\r\ncaf=C3=A9\r\n",
+			true, true,
+		},
+		{
+			"mismatch",
+			"Content-MD5: " + contentMD5(text) + "\r\n\r\nhello\r\nWorld\r\n",
+			false, true,
+		},
+		{
+			"malformed",
+			"Content-MD5: not base64!\r\n\r\n" + text,
+			false, true,
+		},
+		{
+			"short digest",
+			"Content-MD5: " + base64.StdEncoding.EncodeToString([]byte("short")) + "\r\n\r\n" + text,
+			false, true,
+		},
+		{
+			"absent",
+			"Subject: hi\r\n\r\n" + text,
+			false, false,
+		},
+	} {
+		m, errs := Parse([]byte(c.raw))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		ok, present := m.VerifyContentMD5()
+		if ok != c.ok || present != c.present {
+			t.Errorf("%s: ok %v, present %v", c.name, ok, present)
+		}
+	}
+}
+
+func TestEncryptedHeader(t *testing.T) {
+	m, errs := Parse(crlf("Encrypted: PEM, MIC-CLEAR\n\nhi\n"))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if !m.Encrypted {
+		t.Error("Encrypted not set")
+	}
+
+	m, _ = Parse(crlf("Subject: hi\n\nhi\n"))
+	if m.Encrypted {
+		t.Error("Encrypted set without the header")
+	}
+}
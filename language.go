@@ -0,0 +1,121 @@
+// Language detection of the body text.
+
+package eml
+
+import (
+	"strings"
+	"unicode"
+)
+
+// most common words of the supported languages written in Latin script,
+// by ISO 639-1 code
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "you", "with", "this", "are", "be", "have", "not", "we", "your", "on", "will"},
+	"es": {"el", "la", "de", "que", "y", "en", "los", "las", "del", "por", "un", "una", "para", "con", "no", "es", "su", "al", "lo", "como"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ich", "sie", "es", "mit", "den", "ein", "eine", "zu", "auf", "für", "von", "sich", "dem", "wir"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "du", "que", "pour", "dans", "pas", "qui", "sur", "vous", "nous", "avec", "ce", "au"},
+	"it": {"il", "di", "che", "e", "la", "un", "una", "per", "non", "sono", "della", "con", "gli", "del", "le", "si", "è", "ho", "questo", "anche"},
+	"pt": {"o", "a", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "os", "as", "no", "na", "por", "se", "você"},
+	"nl": {"de", "het", "een", "en", "van", "ik", "te", "dat", "die", "niet", "is", "op", "zijn", "voor", "met", "je", "wij", "ook", "maar", "naar"},
+}
+
+// languages identified by their script alone
+var scriptLanguages = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"ru", unicode.Cyrillic},
+	{"el", unicode.Greek},
+	{"ar", unicode.Arabic},
+	{"he", unicode.Hebrew},
+	{"th", unicode.Thai},
+}
+
+// DetectLanguage estimates the language of the decoded text body, falling
+// back to the text of the HTML body, and returns its ISO 639-1 code with a
+// confidence between 0 and 1. Text written in a non-Latin script is
+// identified by the script (Japanese when kana are present, Chinese for Han
+// alone, Russian for any Cyrillic); Latin text is matched against the most
+// common words of English, Spanish, German, French, Italian, Portuguese and
+// Dutch. The guess is rough: short texts, mixed languages and quoted
+// replies lower its accuracy, and an empty lang is returned when nothing
+// matches.
+func (m Message) DetectLanguage() (lang string, confidence float64) {
+	text := m.Text
+	if strings.TrimSpace(text) == "" {
+		text = htmlToText(m.Html)
+	}
+
+	// count the letters of each script
+	letters := 0
+	scripts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.table, r) {
+				scripts[s.lang]++
+				break
+			}
+		}
+	}
+
+	if letters == 0 {
+		return "", 0
+	}
+
+	// kana are mixed with Han in Japanese
+	if scripts["ja"] > 0 {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+
+	for l, n := range scripts {
+		if n*2 > letters {
+			return l, float64(n) / float64(letters)
+		}
+	}
+
+	// count the stopwords of each language
+	hits := make(map[string]int)
+	total := 0
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for l, words := range stopwords {
+			for _, sw := range words {
+				if w == sw {
+					hits[l]++
+					total++
+					break
+				}
+			}
+		}
+	}
+
+	best := 0
+	for l, n := range hits {
+		if n > best || (n == best && l < lang) {
+			lang, best = l, n
+		}
+	}
+
+	if best == 0 {
+		return "", 0
+	}
+
+	// a handful of matches isn't enough to be confident
+	confidence = float64(best) / float64(total)
+	if best < 10 {
+		confidence *= float64(best) / 10
+	}
+
+	return lang, confidence
+}
@@ -0,0 +1,39 @@
+package eml
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		lang string
+	}{
+		{"english", Message{Text: "Hi Bob, thank you for the report. We have looked into it and the fix will be in the next release, so you do not need to do anything with your account."}, "en"},
+		{"spanish", Message{Text: "Hola Juan, gracias por el informe. Lo hemos revisado y la solución estará en la próxima versión, por lo que no es necesario que hagas nada con tu cuenta."}, "es"},
+		{"german", Message{Text: "Hallo Anna, danke für den Bericht. Wir haben uns das angesehen und die Korrektur ist in der nächsten Version, du musst also nichts mit deinem Konto machen, das ist nicht nötig."}, "de"},
+		{"cyrillic", Message{Text: "Спасибо за письмо, мы скоро ответим."}, "ru"},
+		{"empty", Message{}, ""},
+	}
+
+	for _, tt := range tests {
+		lang, confidence := tt.msg.DetectLanguage()
+		if lang != tt.lang {
+			t.Errorf("%s: lang = %q (%.2f), want %q", tt.name, lang, confidence, tt.lang)
+		}
+		if lang != "" && (confidence <= 0 || confidence > 1) {
+			t.Errorf("%s: confidence = %v", tt.name, confidence)
+		}
+	}
+}
+
+func TestDetectLanguageShortText(t *testing.T) {
+	long, c1 := Message{Text: "The report is in the folder and it is for you to review with the team, and the notes are in the document that we have on the drive."}.DetectLanguage()
+	short, c2 := Message{Text: "The report."}.DetectLanguage()
+
+	if long != "en" || short != "en" {
+		t.Fatalf("lang = %q, %q", long, short)
+	}
+	if c2 >= c1 {
+		t.Errorf("short text confidence %v >= long text confidence %v", c2, c1)
+	}
+}
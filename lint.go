@@ -0,0 +1,70 @@
+// Extra checks of the structure of a message.
+
+package eml
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// fields that may appear only once in a message (RFC5322 3.6)
+var singleFields = []string{
+	"Date", "From", "Sender", "Reply-To", "To", "Cc", "Bcc",
+	"Message-ID", "In-Reply-To", "References", "Subject",
+}
+
+// run the checks enabled by ParseOptions.CollectWarnings on a parsed
+// message: the duplicated fields, the MIME-Version, the multiparts whose
+// boundary can't be found and the texts whose charset looks wrong
+func (m Message) lint() (warnings []Warning) {
+	for _, k := range singleFields {
+		if n := len(m.header(k)); n > 1 {
+			warnings = append(warnings, Warning(fmt.Sprintf("duplicate %s header", k)))
+		}
+	}
+
+	version := m.header("MIME-Version")
+	switch {
+	case len(version) == 0 && (len(m.header("Content-Type")) > 0 || len(m.header("Content-Transfer-Encoding")) > 0):
+		warnings = append(warnings, Warning("MIME headers without MIME-Version header"))
+	case len(version) > 0 && strings.Join(strings.Fields(stripComments(version[0])), "") != "1.0":
+		warnings = append(warnings, Warning(fmt.Sprintf("unsupported MIME-Version %q", strings.TrimSpace(version[0]))))
+	}
+
+	m.WalkMIME(func(n *MIMENode, depth int) error {
+		switch {
+		case strings.HasPrefix(n.Type, "multipart/") && n.Params["boundary"] != "" && len(n.Children) == 0:
+			warnings = append(warnings, Warning(fmt.Sprintf("%s boundary %q not found in body", n.Type, n.Params["boundary"])))
+
+		// the mislabeled us-ascii and utf-8 texts are already reported when
+		// decoded, but a legacy charset can't be told wrong that way
+		case strings.HasPrefix(n.Type, "text/") && n.Charset != "":
+			switch cs := strings.ToLower(strings.TrimSpace(n.Charset)); {
+			case cs == "utf-8", cs == "utf8", isUnknownCharset(cs):
+			default:
+				if data := m.undecodedText(n, depth); !isASCII(string(data)) && utf8.Valid(data) {
+					warnings = append(warnings, Warning(fmt.Sprintf("declared charset %s but %s body is valid UTF-8", cs, n.Type)))
+				}
+			}
+		}
+		return nil
+	})
+
+	return
+}
+
+// get the text of a leaf of the MIME tree before its charset was decoded,
+// from its raw bytes, or from the body when the leaf is the message itself
+func (m Message) undecodedText(n *MIMENode, depth int) []byte {
+	if depth > 0 {
+		return rawPartData(n.Part)
+	}
+
+	data, _, err := decodeContentTransferEncoding(m.ParsedHeaders, n.Headers, &m.Body)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
@@ -0,0 +1,82 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectWarnings(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			"duplicate Date",
+			"Date: Mon, 2 Oct 2023 10:00:00 +0000\nDate: Tue, 3 Oct 2023 10:00:00 +0000\nSubject: hi\n\nbody\n",
+			"duplicate Date header",
+		},
+		{
+			"MIME headers without MIME-Version",
+			"Subject: hi\nContent-Type: text/plain\n\nbody\n",
+			"MIME headers without MIME-Version header",
+		},
+		{
+			"unsupported MIME-Version",
+			"MIME-Version: 2.0\nContent-Type: text/plain\n\nbody\n",
+			`unsupported MIME-Version "2.0"`,
+		},
+		{
+			"boundary not found",
+			"MIME-Version: 1.0\nContent-Type: multipart/mixed; boundary=sep\n\nno parts here\n",
+			`multipart/mixed boundary "sep" not found in body`,
+		},
+		{
+			"legacy charset with a UTF-8 body",
+			"MIME-Version: 1.0\nContent-Type: text/plain; charset=iso-8859-1\n\ncafé\n",
+			"declared charset iso-8859-1 but text/plain body is valid UTF-8",
+		},
+		{
+			"legacy charset in a part",
+			"MIME-Version: 1.0\nContent-Type: multipart/mixed; boundary=sep\n\n" +
+				"--sep\nContent-Type: text/plain; charset=windows-1252\n\ncafé\n--sep--\n",
+			"declared charset windows-1252 but text/plain body is valid UTF-8",
+		},
+	} {
+		m, _ := ParseWithOptions(crlf(c.raw), ParseOptions{CollectWarnings: true})
+
+		found := false
+		for _, w := range m.Warnings {
+			found = found || string(w) == c.want
+		}
+		if !found {
+			t.Errorf("%s: warnings %q, want %q", c.name, m.Warnings, c.want)
+		}
+	}
+}
+
+func TestCollectWarningsClean(t *testing.T) {
+	raw := "MIME-Version: 1.0\nDate: Mon, 2 Oct 2023 10:00:00 +0000\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\nContent-Transfer-Encoding: quoted-printable\n\ncaf=E9\n"
+
+	m, errs := ParseWithOptions(crlf(raw), ParseOptions{CollectWarnings: true})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(m.Warnings) > 0 {
+		t.Errorf("warnings %q for a well-formed message", m.Warnings)
+	}
+}
+
+func TestCollectWarningsDisabled(t *testing.T) {
+	raw := "Date: Mon, 2 Oct 2023 10:00:00 +0000\nDate: Tue, 3 Oct 2023 10:00:00 +0000\n" +
+		"MIME-Version: 2.0\nContent-Type: text/plain; charset=iso-8859-1\n\ncafé\n"
+
+	m, _ := Parse(crlf(raw))
+	for _, w := range m.Warnings {
+		if strings.HasPrefix(string(w), "duplicate") || strings.Contains(string(w), "MIME-Version") ||
+			strings.HasPrefix(string(w), "declared charset") {
+			t.Errorf("warning %q without CollectWarnings", w)
+		}
+	}
+}
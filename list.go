@@ -0,0 +1,70 @@
+// Mailing list headers.
+
+package eml
+
+import (
+	"net/url"
+	"strings"
+)
+
+// extract the URIs of a List-* header (RFC2369), written as a comma
+// separated list of <uri> entries
+func listURIs(v string) (uris []string) {
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if strings.HasPrefix(item, "<") && strings.HasSuffix(item, ">") {
+			uris = append(uris, strings.Join(strings.Fields(item[1:len(item)-1]), ""))
+		}
+	}
+	return
+}
+
+// OneClickUnsubscribe returns the HTTPS URL to POST to for a one-click
+// unsubscription. As required by RFC8058, it is only returned when the
+// List-Unsubscribe header has an HTTPS URI and a single List-Unsubscribe-Post
+// header holds exactly "List-Unsubscribe=One-Click".
+func (m Message) OneClickUnsubscribe() (string, bool) {
+	post := m.header("List-Unsubscribe-Post")
+	if len(post) != 1 || strings.TrimSpace(post[0]) != "List-Unsubscribe=One-Click" {
+		return "", false
+	}
+
+	for _, v := range m.header("List-Unsubscribe") {
+		for _, uri := range listURIs(v) {
+			u, err := url.Parse(uri)
+			if err == nil && strings.EqualFold(u.Scheme, "https") && u.Host != "" {
+				return uri, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// IsBulk reports whether the Precedence header marks the message as bulk,
+// list or junk mail, which must not get automatic replies (RFC3834)
+func (m Message) IsBulk() bool {
+	switch m.Precedence {
+	case "bulk", "list", "junk":
+		return true
+	}
+
+	return false
+}
+
+// FeedbackID returns the colon separated fields of the Feedback-ID header,
+// used by feedback loops to tie complaints to a campaign, such as
+// ["campaign", "customer", "mailtype", "senderid"]. The last field is the
+// sender id, which identifies the sender of the bulk mail.
+func (m Message) FeedbackID() (parts []string, ok bool) {
+	v := m.header("Feedback-ID")
+	if len(v) == 0 || strings.TrimSpace(v[0]) == "" {
+		return nil, false
+	}
+
+	for _, p := range strings.Split(strings.TrimSpace(v[0]), ":") {
+		parts = append(parts, strings.TrimSpace(p))
+	}
+
+	return parts, true
+}
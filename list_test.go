@@ -0,0 +1,98 @@
+package eml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOneClickUnsubscribe(t *testing.T) {
+	const post = "List-Unsubscribe-Post: List-Unsubscribe=One-Click\n"
+
+	for _, c := range []struct {
+		name, headers, url string
+	}{
+		{
+			"https and mailto",
+			"List-Unsubscribe: <mailto:unsub@example.com?subject=unsubscribe>, <https://example.com/unsub?id=42>\n" + post,
+			"https://example.com/unsub?id=42",
+		},
+		{
+			"folded uri",
+			"List-Unsubscribe: <https://example.com/\n unsub?id=42>\n" + post,
+			"https://example.com/unsub?id=42",
+		},
+		{"no post header", "List-Unsubscribe: <https://example.com/unsub>\n", ""},
+		{"two post headers", "List-Unsubscribe: <https://example.com/unsub>\n" + post + post, ""},
+		{"other post value", "List-Unsubscribe: <https://example.com/unsub>\nList-Unsubscribe-Post: List-Unsubscribe=Yes\n", ""},
+		{"http only", "List-Unsubscribe: <http://example.com/unsub>\n" + post, ""},
+		{"mailto only", "List-Unsubscribe: <mailto:unsub@example.com>\n" + post, ""},
+		{"no angle brackets", "List-Unsubscribe: https://example.com/unsub\n" + post, ""},
+		{"no host", "List-Unsubscribe: <https:///unsub>\n" + post, ""},
+	} {
+		m, errs := Parse(crlf("From: list@example.com\n" + c.headers + "\nhi\n"))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		url, ok := m.OneClickUnsubscribe()
+		if url != c.url || ok != (c.url != "") {
+			t.Errorf("%s: %q, %v", c.name, url, ok)
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	for _, c := range []struct {
+		value, precedence string
+		bulk              bool
+	}{
+		{"bulk", "bulk", true},
+		{"list", "list", true},
+		{"Junk", "junk", true},
+		{" LIST ", "list", true},
+		{"first-class", "first-class", false},
+		{"", "", false},
+	} {
+		raw := "Subject: hi\n"
+		if c.value != "" {
+			raw += "Precedence: " + c.value + "\n"
+		}
+
+		m, errs := Parse(crlf(raw + "\nhi\n"))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if m.Precedence != c.precedence || m.IsBulk() != c.bulk {
+			t.Errorf("%q: precedence %q, bulk %v", c.value, m.Precedence, m.IsBulk())
+		}
+	}
+}
+
+func TestFeedbackID(t *testing.T) {
+	for _, c := range []struct {
+		value string
+		want  []string
+	}{
+		{"CampaignIDX:CustomerID2:MailTypeID3:SenderId", []string{"CampaignIDX", "CustomerID2", "MailTypeID3", "SenderId"}},
+		{" a1 : b2:c3 ", []string{"a1", "b2", "c3"}},
+		{"::newsletter:esp", []string{"", "", "newsletter", "esp"}},
+		{"senderonly", []string{"senderonly"}},
+		{"  ", nil},
+	} {
+		m, errs := Parse(crlf("Feedback-ID: " + c.value + "\n\nhi\n"))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		parts, ok := m.FeedbackID()
+		if ok != (c.want != nil) || !reflect.DeepEqual(parts, c.want) {
+			t.Errorf("%q: %q, %v", c.value, parts, ok)
+		}
+	}
+
+	m, _ := Parse(crlf("Subject: hi\n\nhi\n"))
+	if _, ok := m.FeedbackID(); ok {
+		t.Error("Feedback-ID found on a message without it")
+	}
+}
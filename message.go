@@ -7,17 +7,19 @@ import (
 	"io"
 	"mime/quotedprintable"
 	"net/textproto"
-	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type Message struct {
-	Headers []byte // full message headers
-	Body    []byte // message body separated from headers
+	Headers  []byte // full message headers
+	Body     []byte // message body separated from headers
+	MboxFrom string // mbox envelope line found before the headers, if any
 
 	// from headers
 	ParsedHeaders map[string][]string // all headers
+	fields        [][2]string         // all headers, key and value, in order
 
 	MessageID   string
 	Date        time.Time
@@ -27,64 +29,210 @@ type Message struct {
 	To          []Address
 	Cc          []Address
 	Bcc         []Address
+	OriginalTo  []Address
 	Subject     string
 	ContentType string
 	Comments    []string
 	Keywords    []string
 	InReply     []string
 	References  []string
+	Sensitivity Sensitivity
+	Encrypted   bool   // obsolete Encrypted header (RFC822) is present
+	Precedence  string // Precedence header, lowercased (e.g. bulk or list)
 
 	// from body
 	Text        string
 	Html        string
+	TextCharset string // charset Text was decoded from, see Part.DecodedCharset
+	HtmlCharset string // charset Html was decoded from
 	Attachments []Attachment
+	Inlines     []InlineAttachment
 	Parts       []Part
+	preferred   int // index in Parts of the preferred body, see PreferredBody
+
+	isAttachment func(Part) bool // ParseOptions.IsAttachment, for WalkAttachments
+	tree         *MIMENode       // MIME tree of the body, see WalkMIME
+
+	// messages found as message/rfc822 parts, such as forwarded emails,
+	// in the order of the parts
+	Embedded []Message
+
+	// delivery status of a bounce (multipart/report, RFC3464), nil when the
+	// message has no message/delivery-status part
+	DeliveryStatus *DSN
+
+	// message found base64-encoded as the body, see UnwrapBase64Messages
+	Unwrapped *Message
+
+	// irregularities found and recovered from while parsing
+	Warnings []Warning
 }
 
+// Warning describes a non-fatal irregularity that the parser recovered from
+type Warning string
+
 type Attachment struct {
 	Filename string
-	Data     []byte
+	MIMEType string // declared media type, lowercased and without parameters
+	Size     int    // decoded length, also set when Data is skipped
+	SHA256   string // hex digest of the decoded data, to find duplicates
+	Data     []byte // nil with ParseOptions.SkipAttachmentData
+}
+
+// BodyReader returns a reader of the raw body of the message, as found after
+// the headers
+func (m Message) BodyReader() io.Reader {
+	return bytes.NewReader(m.Body)
+}
+
+// TextReader returns a reader of the decoded text body of the message
+func (m Message) TextReader() io.Reader {
+	return strings.NewReader(m.Text)
+}
+
+// PreferredBody returns the body to show to a reader with its media type,
+// text/html or text/plain: the last text of the first alternative, as it
+// is the richest one (RFC2046 5.1.4), or the first text of the message
+// when it has no alternative. Texts of other types, such as text/calendar
+// or text/watch-html, are not considered.
+func (m Message) PreferredBody() (mime string, data []byte) {
+	if m.preferred >= 0 && m.preferred < len(m.Parts) && strings.Contains(m.Parts[m.preferred].Type, "text/html") {
+		return "text/html", []byte(m.Html)
+	}
+
+	return "text/plain", []byte(m.Text)
+}
+
+// InlineAttachment is a part shown within the HTML body, such as an image
+// referenced by a cid: URL
+type InlineAttachment struct {
+	ContentID string // Content-ID, without its angle brackets
+	Filename  string // may be empty, inline parts often have no name
+	MIMEType  string // declared media type, lowercased and without parameters
+	Data      []byte
+}
+
+// tell if a part is an attachment when ParseOptions.IsAttachment is not
+// set: its Content-Disposition says so
+func defaultIsAttachment(part Part) bool {
+	cd, ok := part.Headers["Content-Disposition"]
+	return ok && strings.Contains(cd[0], "attachment")
+}
+
+// get the name of an inline part, as found by partFilename, or an empty
+// one, as inline parts often have no name
+func inlineFilename(part Part, opts ParseOptions) string {
+	name, _ := partFilename(part)
+	d, _ := Decode(rawHeaderToUTF8([]byte(name), opts))
+
+	return string(d)
 }
 
 func Parse(data []byte) (msg Message, errors []error) {
+	return ParseWithOptions(data, ParseOptions{})
+}
+
+// ParseReader reads the message from r and parses it as Parse does. An
+// error reading r is returned alone, without parsing what was read.
+func ParseReader(r io.Reader) (msg Message, errors []error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("read: %v", err))
+		return
+	}
+
+	return Parse(data)
+}
+
+func ParseWithOptions(data []byte, opts ParseOptions) (msg Message, errors []error) {
+	if opts.Stats != nil {
+		defer opts.Stats.record(time.Now(), &msg)
+	}
 
 	// treat the raw data
 	raw, err := ParseRaw(data)
 	if err != nil {
-		errors = append(errors, fmt.Errorf("raw parsing: %v", err))
+		errors = append(errors, fmt.Errorf("raw parsing: %w", err))
 		return
 	}
 
+	if opts.Stats != nil {
+		opts.Stats.Headers = len(raw.RawHeaders)
+	}
+
 	// proccess the message headers and body parts
-	msg, errors = handleMessage(raw)
+	msg, errors = handleMessage(raw, opts)
+
+	// the mbox envelope line is not part of the message headers
+	if raw.MboxFrom != nil {
+		msg.MboxFrom = string(raw.MboxFrom)
+		data = data[bytes.IndexByte(data, '\n')+1:]
+	}
 
 	// append the body and headers at the message
 	msg.Body = raw.Body
 	msg.Headers = extractHeaders(&raw.Body, &data)
 
+	if opts.CollectWarnings {
+		msg.Warnings = append(msg.Warnings, msg.lint()...)
+	}
+
+	if opts.UnwrapBase64Messages {
+		if data, ok := unwrapBase64Message(msg); ok {
+			// the figures are the ones of the wrapper
+			inner := opts
+			inner.Stats = nil
+
+			unwrapped, errs := ParseWithOptions(data, inner)
+			msg.Unwrapped = &unwrapped
+			msg.Warnings = append(msg.Warnings, Warning("body is a base64-wrapped message"))
+			errors = append(errors, errs...)
+		}
+	}
+
 	return
 }
 
 // extract the data from each header and parse the body contents
-func handleMessage(r RawMessage) (msg Message, errors []error) {
+func handleMessage(r RawMessage, opts ParseOptions) (msg Message, errors []error) {
 
 	// proccess and append the headers parameters
 	msg.ParsedHeaders = make(map[string][]string)
 	for _, rh := range r.RawHeaders {
 
+		// deal with control characters smuggled in the value
+		if opts.HeaderControlChars != ControlCharsKeep {
+			v, found := stripHeaderControls(rh.Value)
+			if found && opts.HeaderControlChars == ControlCharsReject {
+				errors = append(errors, fmt.Errorf("header parser: control character in %s header", rh.Key))
+				continue
+			}
+
+			if found {
+				msg.Warnings = append(msg.Warnings, Warning(fmt.Sprintf("control characters removed from %s header", rh.Key)))
+				rh.Value = v
+			}
+		}
+
 		// add this header to the parsed headers map
 		if _, ok := msg.ParsedHeaders[string(rh.Key)]; !ok {
 			msg.ParsedHeaders[string(rh.Key)] = []string{}
 		}
 
 		msg.ParsedHeaders[string(rh.Key)] = append(msg.ParsedHeaders[string(rh.Key)], string(rh.Value))
+		msg.fields = append(msg.fields, [2]string{string(rh.Key), string(rh.Value)})
 
 		// handle key headers
 		var err error
 
+		// display names sent as raw 8-bit text in an unknown charset
+		if addressHeaders[strings.ToLower(string(rh.Key))] {
+			rh.Value = rawHeaderToUTF8(rh.Value, opts)
+		}
+
 		switch strings.ToLower(string(rh.Key)) {
 		case `content-type`:
-			msg.ContentType = string(rh.Value)
+			msg.ContentType = string(bytes.TrimSpace(rh.Value))
 		case `message-id`:
 			v := bytes.TrimSpace(rh.Value)
 			v = bytes.Trim(rh.Value, `<>`)
@@ -100,7 +248,7 @@ func handleMessage(r RawMessage) (msg Message, errors []error) {
 				msg.References = append(msg.References, strings.Trim(id, `<> `))
 			}
 		case `date`:
-			msg.Date = ParseDate(string(rh.Value))
+			msg.Date, err = ParseDateErr(string(rh.Value))
 		case `from`:
 			msg.From, err = parseAddressList(rh.Value)
 		case `sender`:
@@ -113,12 +261,25 @@ func handleMessage(r RawMessage) (msg Message, errors []error) {
 			msg.Cc, err = parseAddressList(rh.Value)
 		case `bcc`:
 			msg.Bcc, err = parseAddressList(rh.Value)
+		case `x-original-to`:
+			var al []Address
+			al, err = parseAddressList(rh.Value)
+			msg.OriginalTo = append(msg.OriginalTo, al...)
 		case `subject`:
 			subject, e := Decode(rh.Value)
 			err = e
 			msg.Subject = string(subject)
 		case `comments`:
-			msg.Comments = append(msg.Comments, string(rh.Value))
+			// unstructured text, which may carry encoded-words
+			comment, e := Decode(rh.Value)
+			err = e
+			msg.Comments = append(msg.Comments, strings.TrimSpace(string(comment)))
+		case `sensitivity`:
+			msg.Sensitivity = parseSensitivity(string(rh.Value))
+		case `encrypted`:
+			msg.Encrypted = true
+		case `precedence`:
+			msg.Precedence = strings.ToLower(strings.TrimSpace(string(rh.Value)))
 		case `keywords`:
 			ks := strings.Split(string(rh.Value), ",")
 			for _, k := range ks {
@@ -127,7 +288,7 @@ func handleMessage(r RawMessage) (msg Message, errors []error) {
 		}
 
 		if err != nil {
-			errors = append(errors, fmt.Errorf("header parser: %v", err))
+			errors = append(errors, fmt.Errorf("header parser: %w", err))
 			err = nil
 		}
 	}
@@ -141,133 +302,508 @@ func handleMessage(r RawMessage) (msg Message, errors []error) {
 	if msg.ContentType != `` {
 
 		// try to parse the body contents with the passed content type
-		parts, e := parseBody(msg.ContentType, r.Body, textproto.MIMEHeader{})
+		// multiparts and messages can't be transfer encoded, so the parts
+		// never inherit the transfer encoding of the message
+		msgHeaders := msg.ParsedHeaders
+		if isCompositeType(msg.ContentType) {
+			if v := msg.header("Content-Transfer-Encoding"); len(v) > 0 && !isIdentityEncoding(v[0]) {
+				msg.Warnings = append(msg.Warnings, illegalEncodingWarning(msg.ContentType, v[0]))
+			}
+			msgHeaders = nil
+		}
+
+		tree, parts, ws, e := parseBody(msg.ContentType, r.Body, textproto.MIMEHeader{})
+		msg.Warnings = append(msg.Warnings, ws...)
 		if e != nil {
 			msg.Text = string(r.Body) // set the whole message body as the message text
-			errors = append(errors, fmt.Errorf("body parser: %v", e))
+			msg.tree = bodyNode(msg.ContentType, r.Body, msg.ParsedHeaders)
+			errors = append(errors, fmt.Errorf("body parser: %w", e))
 			return
 		}
 
+		if opts.MaxParts > 0 && len(parts) > opts.MaxParts {
+			errors = append(errors, fmt.Errorf("body parser: %d parts found, the ones over the limit of %d are dropped", len(parts), opts.MaxParts))
+			parts = parts[:opts.MaxParts]
+		}
+
+		textPart, htmlPart, preferredPart := bodyParts(parts)
+		attachments := attachmentParts(parts, opts.IsAttachment)
+		msg.isAttachment = opts.IsAttachment
+		decodedTotal := 0
+
 		// handle each message part
 		for k, part := range parts {
+			// forwarded messages are parsed in turn, whether they are
+			// attachments or not
+			if isEmbeddedMessage(part.Type) {
+				inner := opts
+				inner.Stats = nil
+
+				embedded, errs := ParseWithOptions(part.Data, inner)
+				for _, e := range errs {
+					errors = append(errors, fmt.Errorf("embedded message: %w", e))
+				}
+				msg.Embedded = append(msg.Embedded, embedded)
+			}
+
 			switch {
+			case attachments[k] > 0:
+				filename := attachmentFilename(part, attachments[k])
+
+				// raw 8-bit filenames are taken in the default charset
+				dfilename, e := Decode(rawHeaderToUTF8([]byte(filename), opts))
+				if e != nil {
+					errors = append(errors, fmt.Errorf("body parser: failed decode filename of attachment [msg: %w]", e))
+				}
+				filename = string(dfilename)
+
+				if e := checkDecodedSize(part, opts, &decodedTotal); e != nil {
+					errors = append(errors, fmt.Errorf("body parser: attachment %q skipped: %v", filename, e))
+					break
+				}
+
+				var w Warning
+				part.Data, w, e = decodeContentTransferEncoding(msgHeaders, part.Headers, &part.Data)
+				if w != "" {
+					msg.Warnings = append(msg.Warnings, w)
+				}
+
+				if e != nil {
+					errors = append(errors, e)
+				}
+
+				a := Attachment{
+					Filename: filename,
+					MIMEType: strings.ToLower(strings.TrimSpace(strings.Split(part.Type, ";")[0])),
+					Size:     len(part.Data),
+					SHA256:   sha256Hex(part.Data),
+					Data:     part.Data,
+				}
+				if opts.SkipAttachmentData {
+					a.Data = nil
+				}
+				msg.Attachments = append(msg.Attachments, a)
+
+				//
 			case strings.Contains(part.Type, "text/plain"):
-				part.Data, e = decodeContentTransferEncoding(msg.ParsedHeaders, part.Headers, &part.Data)
+				var w Warning
+				part.Data, w, e = decodeContentTransferEncoding(msgHeaders, part.Headers, &part.Data)
+				if w != "" {
+					msg.Warnings = append(msg.Warnings, w)
+				}
+
 				if e != nil {
 					errors = append(errors, e)
 				}
+				parts[k].Data = part.Data
+
+				data, used, w, e := decodeCharset(part.Charset, part.Data, opts)
+				if w != "" {
+					msg.Warnings = append(msg.Warnings, w)
+				}
 
-				data, e := UTF8(part.Charset, part.Data)
 				if e != nil {
-					msg.Text = string(part.Data)
-				} else {
+					data = part.Data
+				}
+
+				// join the soft line breaks of format=flowed text
+				if strings.EqualFold(part.Params["format"], "flowed") {
+					data = []byte(decodeFlowed(string(data), strings.EqualFold(part.Params["delsp"], "yes")))
+				}
+
+				if k == textPart {
 					msg.Text = string(data)
+				}
+				if e == nil {
 					parts[k].Data = data
+					parts[k].DecodedCharset = used
+					if k == textPart {
+						msg.TextCharset = used
+					}
 				}
 
 				//
 			case strings.Contains(part.Type, "text/html"):
-				part.Data, e = decodeContentTransferEncoding(msg.ParsedHeaders, part.Headers, &part.Data)
+				var w Warning
+				part.Data, w, e = decodeContentTransferEncoding(msgHeaders, part.Headers, &part.Data)
+				if w != "" {
+					msg.Warnings = append(msg.Warnings, w)
+				}
+
 				if e != nil {
 					errors = append(errors, e)
 				}
+				parts[k].Data = part.Data
+
+				data, used, w, e := decodeCharset(part.Charset, part.Data, opts)
+				if w != "" {
+					msg.Warnings = append(msg.Warnings, w)
+				}
 
-				data, e := UTF8(part.Charset, part.Data)
 				if e != nil {
-					msg.Html = string(part.Data)
+					data = part.Data
 				} else {
-					msg.Html = string(data)
 					parts[k].Data = data
+					parts[k].DecodedCharset = used
+				}
+
+				if k == htmlPart {
+					msg.Html = string(data)
+					if e == nil {
+						msg.HtmlCharset = used
+					}
 				}
 
 				//
 			default:
-				if cd, ok := part.Headers["Content-Disposition"]; ok {
-					if strings.Contains(cd[0], "attachment") {
-						filename := regexp.MustCompile("(?msi)name=\"(.*?)\"").FindStringSubmatch(cd[0]) //.FindString(cd[0])
-						if len(filename) < 2 {
-							errors = append(errors, fmt.Errorf("body parser: failed get filename from header Content-Disposition"))
-							break
-						}
-
-						dfilename, e := Decode([]byte(filename[1]))
-						if e != nil {
-							errors = append(errors, fmt.Errorf("body parser: failed decode filename of attachment [msg: %v]", e))
-						} else {
-							filename[1] = string(dfilename)
-						}
-
-						part.Data, e = decodeContentTransferEncoding(msg.ParsedHeaders, part.Headers, &part.Data)
-						if e != nil {
-							errors = append(errors, e)
-						}
-
-						msg.Attachments = append(msg.Attachments, Attachment{filename[1], part.Data})
+				// parts shown within the HTML, referenced by their Content-ID
+				cd := strings.ToLower(strings.TrimSpace(textproto.MIMEHeader(part.Headers).Get("Content-Disposition")))
+				cid := strings.Trim(strings.TrimSpace(textproto.MIMEHeader(part.Headers).Get("Content-Id")), "<>")
+				if cid != "" || strings.HasPrefix(cd, "inline") {
+					if e := checkDecodedSize(part, opts, &decodedTotal); e != nil {
+						errors = append(errors, fmt.Errorf("body parser: inline part <%s> skipped: %v", cid, e))
+						break
 					}
+
+					var w Warning
+					part.Data, w, e = decodeContentTransferEncoding(msgHeaders, part.Headers, &part.Data)
+					if w != "" {
+						msg.Warnings = append(msg.Warnings, w)
+					}
+
+					if e != nil {
+						errors = append(errors, e)
+					}
+
+					msg.Inlines = append(msg.Inlines, InlineAttachment{
+						ContentID: cid,
+						Filename:  inlineFilename(part, opts),
+						MIMEType:  strings.ToLower(strings.TrimSpace(strings.Split(part.Type, ";")[0])),
+						Data:      part.Data,
+					})
 				}
 			}
 		}
 
 		msg.Parts = parts
-		msg.ContentType = parts[0].Type
-		msg.Text = string(parts[0].Data)
+		msg.preferred = preferredPart
+		msg.DeliveryStatus = parseDSN(parts)
+
+		// the leaves of the tree get the parts as decoded above
+		next := 0
+		tree.fillLeaves(parts, &next)
+		if !tree.leaf {
+			tree.Headers = msg.ParsedHeaders
+		}
+		msg.tree = tree
+		if len(parts) > 0 {
+			msg.ContentType = parts[0].Type
+		}
 	} else {
 		msg.Text = string(r.Body)
+		msg.tree = bodyNode("", r.Body, msg.ParsedHeaders)
 	}
 
 	return
 }
 
-// get the headers from the full message and sanitize its suffix
-func extractHeaders(body *[]byte, data *[]byte) []byte {
+// headers holding address lists
+var addressHeaders = map[string]bool{
+	"from":          true,
+	"sender":        true,
+	"reply-to":      true,
+	"to":            true,
+	"cc":            true,
+	"bcc":           true,
+	"x-original-to": true,
+}
+
+// convert a header value carrying raw 8-bit text that is not UTF-8 (thus not
+// RFC2047 encoded nor RFC6532) with the default charset, or a sniffed one
+func rawHeaderToUTF8(v []byte, opts ParseOptions) []byte {
+	if utf8.Valid(v) {
+		return v
+	}
+
+	decoded, _, err := decodeUnknownCharset(opts.DefaultCharset, v)
+	if err != nil {
+		return v
+	}
+
+	return decoded
+}
+
+// check if data can't be in the declared charset: 8-bit bytes in a
+// us-ascii text, or invalid sequences in a utf-8 one, as sent by clients
+// that label any text with a default charset
+func mislabeledCharset(cs string, data []byte) bool {
+	switch strings.ToLower(strings.TrimSpace(cs)) {
+	case "us-ascii", "ascii":
+		return !isASCII(string(data))
+	case "utf-8", "utf8":
+		return !utf8.Valid(data)
+	}
+	return false
+}
+
+// convert a text part to UTF-8, returning the charset used. pseudo-charsets
+// left by gateways that could not tell the real charset are replaced by the
+// default charset, or sniffed, as are the missing, unknown and mislabeled
+// charsets when the text is not plain ASCII
+func decodeCharset(cs string, data []byte, opts ParseOptions) (decoded []byte, used string, w Warning, err error) {
+	if isUnknownCharset(cs) {
+		decoded, used, err = decodeUnknownCharset(opts.DefaultCharset, data)
+		w = Warning(fmt.Sprintf("pseudo-charset %q decoded as %s", cs, used))
+		return
+	}
+
+	if strings.TrimSpace(cs) == "" {
+		if isASCII(string(data)) {
+			return data, "us-ascii", "", nil
+		}
+
+		decoded, used, err = decodeUnknownCharset(opts.DefaultCharset, data)
+		w = Warning(fmt.Sprintf("undeclared charset decoded as %s", used))
+		return
+	}
+
+	if !mislabeledCharset(cs, data) {
+		if decoded, err = UTF8(cs, data); err == nil {
+			return decoded, cs, "", nil
+		}
+	}
+
+	decoded, used, err = decodeUnknownCharset(opts.DefaultCharset, data)
+	w = Warning(fmt.Sprintf("text declared as %q decoded as %s", cs, used))
 
-	// replace the body from the full message to get just the headers
-	headers := bytes.Replace(*data, *body, nil, 1)
+	return
+}
+
+// check if a part content type is a message of its own
+func isEmbeddedMessage(ct string) bool {
+	mt := strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
+	return mt == "message/rfc822" || mt == "message/global"
+}
 
-	// define a list of CF + LF variations at the headers end
-	trimOut := [][]byte{
-		[]byte("\n\r\n"),
-		[]byte("\r\n\n"),
-		[]byte("\r\n"),
-		[]byte("\n\r"),
-		[]byte("\n"),
-		[]byte("\r"),
+// check if data looks like a message: header lines with proper field
+// names, ended by a blank line
+func looksLikeMessage(data []byte) bool {
+	if !bytes.Contains(data, []byte("\n\n")) && !bytes.Contains(data, []byte("\n\r\n")) {
+		return false
 	}
 
-	// trum each item of the list above from the headers suffix
-	for _, i := range trimOut {
-		headers = bytes.TrimSuffix(headers, i)
+	r, err := ParseRaw(data)
+	if err != nil || len(r.RawHeaders) == 0 || r.MboxFrom != nil {
+		return false
+	}
+
+	for _, h := range r.RawHeaders {
+		if len(h.Key) == 0 {
+			return false
+		}
+		for _, c := range h.Key {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// get the message wrapped in base64 by a broken gateway as the body of a
+// text/plain or application/octet-stream message, whether the body is
+// declared as base64 or not
+func unwrapBase64Message(msg Message) ([]byte, bool) {
+	ct := "text/plain"
+	if v := msg.header("Content-Type"); len(v) > 0 {
+		ct = strings.ToLower(strings.TrimSpace(strings.Split(v[0], ";")[0]))
+	}
+
+	if ct != "text/plain" && ct != "application/octet-stream" {
+		return nil, false
+	}
+
+	decoded, _, err := decodeBase64(bytes.Join(bytes.Fields(msg.Body), nil))
+	if err != nil {
+		return nil, false
+	}
+
+	// the body was declared as base64, the message may be wrapped once more
+	if !looksLikeMessage(decoded) {
+		decoded, _, err = decodeBase64(bytes.Join(bytes.Fields(decoded), nil))
+		if err != nil || !looksLikeMessage(decoded) {
+			return nil, false
+		}
+	}
+
+	return decoded, true
+}
+
+// check the size limits of the options before decoding an attachment or
+// an inline part, adding its size to the total when it fits. the size is an
+// upper bound known without decoding the data
+func checkDecodedSize(part Part, opts ParseOptions, total *int) error {
+	size := len(part.Data)
+	if strings.EqualFold(strings.TrimSpace(textproto.MIMEHeader(part.Headers).Get("Content-Transfer-Encoding")), "base64") {
+		size = size * 3 / 4
 	}
 
+	if opts.MaxAttachmentBytes > 0 && size > opts.MaxAttachmentBytes {
+		return fmt.Errorf("%d bytes over the limit of %d", size, opts.MaxAttachmentBytes)
+	}
+
+	if opts.MaxTotalBytes > 0 && *total+size > opts.MaxTotalBytes {
+		return fmt.Errorf("%d bytes take the total over the limit of %d", size, opts.MaxTotalBytes)
+	}
+
+	*total += size
+
+	return nil
+}
+
+// get the headers from the full message and sanitize its suffix. the body
+// found by ParseRaw is always the end of the data, so the headers are what
+// precedes it, whatever the body contains
+func extractHeaders(body *[]byte, data *[]byte) []byte {
+	headers := (*data)[:len(*data)-len(*body)]
+
+	// the line break ending the last header and the blank line separating
+	// the body may each be a CRLF or a bare LF, in any combination
+	headers = bytes.TrimRight(headers, "\r\n")
+
 	return headers
 }
 
-// generic function to handle content encoding
-func decodeContentTransferEncoding(msgHeaders, partHeaders map[string][]string, toDecode *[]byte) (decoded []byte, err error) {
-	decoded = *toDecode
+// get the transfer encoding of a part, lowercased, from its headers or else
+// from the message headers. composite entities are never decoded, RFC2045
+// forbids encoding them, so their encoding is taken as the identity
+func transferEncoding(msgHeaders, partHeaders map[string][]string) string {
+	if ct, ok := partHeaders["Content-Type"]; ok && isCompositeType(ct[0]) {
+		return ""
+	}
 
-	// read the encoding from the part headers
-	// if it does not exists in that map, use the message headers
-	encoding := ""
+	if v, ok := partHeaders["Content-Transfer-Encoding"]; ok {
+		return strings.ToLower(strings.TrimSpace(v[0]))
+	}
 
-	if headerEncoding, ok := partHeaders["Content-Transfer-Encoding"]; ok {
-		encoding = strings.ToLower(headerEncoding[0])
-	} else {
-		if headerEncoding, ok := msgHeaders["Content-Transfer-Encoding"]; ok {
-			encoding = strings.ToLower(headerEncoding[0])
+	// the message headers are kept with the case they were sent
+	encoding := ""
+	for k, v := range msgHeaders {
+		if strings.EqualFold(k, "Content-Transfer-Encoding") && len(v) > 0 {
+			encoding = strings.ToLower(strings.TrimSpace(v[0]))
 		}
 	}
 
+	return encoding
+}
+
+// get a reader decoding data from a transfer encoding. base64 data is read
+// with the first alphabet of base64Encodings it is valid in, whose name is
+// returned
+func transferDecoder(encoding string, data []byte) (r io.Reader, alphabet string, err error) {
+	switch encoding {
+	case "base64":
+		i := base64Alphabet(data)
+		return base64.NewDecoder(base64Encodings[i].enc, bytes.NewReader(data)), base64Encodings[i].name, nil
+	case "quoted-printable":
+		return quotedprintable.NewReader(bytes.NewReader(data)), "", nil
+	case "x-uuencode", "x-uue", "uuencode", "uue":
+		return newUUReader(bytes.NewReader(data)), "", nil
+	case "", "7bit", "8bit", "binary":
+		// identity encodings, the data is as sent
+		return bytes.NewReader(data), "", nil
+	}
+
+	return nil, "", fmt.Errorf("unknown transfer encoding %q", encoding)
+}
+
+// generic function to handle content encoding
+func decodeContentTransferEncoding(msgHeaders, partHeaders map[string][]string, toDecode *[]byte) (decoded []byte, w Warning, err error) {
+	encoding := transferEncoding(msgHeaders, partHeaders)
+
+	r, alphabet, err := transferDecoder(encoding, *toDecode)
+	if err != nil {
+		return *toDecode, w, fmt.Errorf("body parser: %w", err)
+	}
+
 	// parse the transfer encoding
-	switch strings.ToLower(encoding) {
+	switch encoding {
 	case "base64":
-		decoded, err = base64.StdEncoding.DecodeString(string(*toDecode))
+		decoded, err = io.ReadAll(r)
 		if err != nil {
-			return decoded, fmt.Errorf("body parser: failed decode base64 [msg: %v]", err)
+			return decoded, w, fmt.Errorf("body parser: failed decode base64 [msg: %v]", err)
+		}
+
+		if alphabet != "standard" {
+			w = Warning(fmt.Sprintf("base64 data decoded with the %s alphabet", alphabet))
 		}
 	case "quoted-printable":
-		decoded, _ = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(*toDecode)))
+		decoded, _ = io.ReadAll(r)
+	case "x-uuencode", "x-uue", "uuencode", "uue":
+		decoded, err = io.ReadAll(r)
+		if err != nil {
+			return *toDecode, w, fmt.Errorf("body parser: failed decode uuencode [msg: %v]", err)
+		}
+	default:
+		decoded = *toDecode
 	}
 
 	return
 }
+
+// check if a content type is a composite one, a multipart or a message
+func isCompositeType(ct string) bool {
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	return strings.HasPrefix(ct, "multipart/") || strings.HasPrefix(ct, "message/")
+}
+
+// check if a transfer encoding leaves the data untouched, the only ones
+// allowed on composite entities
+func isIdentityEncoding(cte string) bool {
+	switch strings.ToLower(strings.TrimSpace(cte)) {
+	case "", "7bit", "8bit", "binary":
+		return true
+	}
+	return false
+}
+
+// warn about a transfer encoding declared on a composite entity, which is
+// ignored
+func illegalEncodingWarning(ct, cte string) Warning {
+	mt := strings.TrimSpace(strings.Split(ct, ";")[0])
+	return Warning(fmt.Sprintf("%s transfer encoding on a %s entity ignored", strings.ToLower(strings.TrimSpace(cte)), strings.ToLower(mt)))
+}
+
+// alternative base64 alphabets tried, in order, when the data does not decode
+// with the standard one
+var base64Encodings = []struct {
+	name string
+	enc  *base64.Encoding
+}{
+	{"standard", base64.StdEncoding},
+	{"unpadded standard", base64.RawStdEncoding},
+	{"URL-safe", base64.URLEncoding},
+	{"unpadded URL-safe", base64.RawURLEncoding},
+}
+
+// decode base64 data, falling back to the URL-safe alphabet used by some
+// misbehaving generators. returns the name of the alphabet that succeeded
+func decodeBase64(data []byte) (decoded []byte, alphabet string, err error) {
+	i := base64Alphabet(data)
+	decoded, err = io.ReadAll(base64.NewDecoder(base64Encodings[i].enc, bytes.NewReader(data)))
+	return decoded, base64Encodings[i].name, err
+}
+
+// get the index of the first alphabet of base64Encodings data is valid in,
+// the standard one when there is none. the data is read through without
+// being kept
+func base64Alphabet(data []byte) int {
+	for i, b := range base64Encodings {
+		if _, err := io.Copy(io.Discard, base64.NewDecoder(b.enc, bytes.NewReader(data))); err == nil {
+			return i
+		}
+	}
+
+	return 0
+}
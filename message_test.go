@@ -0,0 +1,493 @@
+package eml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// the canonical API of the package, defined once
+var (
+	_ func([]byte) (Message, []error)  = Parse
+	_ func([]byte) (RawMessage, error) = ParseRaw
+	_ map[string][]string              = Message{}.ParsedHeaders
+	_ []Attachment                     = Message{}.Attachments
+	_ []RawHeader                      = RawMessage{}.RawHeaders
+)
+
+func TestParse(t *testing.T) {
+	raw := "From: Alice <alice@example.com>\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: =?utf-8?q?caf=C3=A9?=\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		"hello\r\n"
+
+	m, errs := Parse([]byte(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.Subject != "café" {
+		t.Errorf("Subject = %q", m.Subject)
+	}
+	if len(m.From) != 1 || m.From[0].Email() != "alice@example.com" {
+		t.Errorf("From = %v", m.From)
+	}
+	if len(m.To) != 1 || m.To[0].Email() != "bob@example.com" {
+		t.Errorf("To = %v", m.To)
+	}
+	if got := m.ParsedHeaders["Subject"]; len(got) != 1 {
+		t.Errorf("ParsedHeaders[Subject] = %q", got)
+	}
+	if m.Text != "hello\r\n" {
+		t.Errorf("Text = %q", m.Text)
+	}
+}
+
+// the text part must not be replaced by the first part when that is HTML
+func TestParseAlternativeHTMLFirst(t *testing.T) {
+	raw := "From: a@example.com\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+		"<p>hello</p>\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"aGVsbG8=\r\n" +
+		"--b--\r\n"
+
+	m, errs := Parse([]byte(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.Text != "hello" {
+		t.Errorf("Text = %q", m.Text)
+	}
+	if m.Html != "<p>hello</p>" {
+		t.Errorf("Html = %q", m.Html)
+	}
+}
+
+// the folded parameters of a single part message keep the space of the fold
+func TestParseFoldedContentType(t *testing.T) {
+	raw := "Content-Type: text/plain;\n charset=iso-8859-1;\n\tname=\"a\n b.txt\"\n" +
+		"Content-Disposition: inline;\n filename=\"my\n report.txt\"\n\n" +
+		"caf\xe9\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.Text != "café\r\n" || m.TextCharset != "iso-8859-1" {
+		t.Errorf("Text = %q in %q", m.Text, m.TextCharset)
+	}
+	if got := m.ParsedHeaders["Content-Type"]; len(got) != 1 || got[0] != `text/plain; charset=iso-8859-1; name="a b.txt"` {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := m.ParsedHeaders["Content-Disposition"]; len(got) != 1 || got[0] != `inline; filename="my report.txt"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+}
+
+func TestParseMissingPartContentType(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\n\n" +
+		"--b\nContent-Transfer-Encoding: 7bit\n\nno type at all\n" +
+		"--b\n\nno headers either\n" +
+		"--b\nContent-Type: application/octet-stream\nContent-Disposition: attachment; filename=a.bin\n\ndata\n" +
+		"--b--\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.Text != "no type at all" {
+		t.Errorf("Text = %q", m.Text)
+	}
+	if len(m.Parts) != 3 {
+		t.Fatalf("%d parts", len(m.Parts))
+	}
+	for _, p := range m.Parts[:2] {
+		if p.Type != "text/plain" || p.Charset != "us-ascii" {
+			t.Errorf("part %q in %q", p.Type, p.Charset)
+		}
+	}
+	if string(m.Parts[1].Data) != "no headers either" {
+		t.Errorf("part data %q", m.Parts[1].Data)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Filename != "a.bin" {
+		t.Errorf("attachments %v", m.Attachments)
+	}
+}
+
+func TestParseEmptyPartContentType(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\n\n" +
+		"--b\nContent-Type:\n\nhello\n" +
+		"--b\nContent-Type: \t\nContent-Disposition: attachment; filename=notes.txt\n\nnotes\n" +
+		"--b--\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.Text != "hello" {
+		t.Errorf("Text = %q", m.Text)
+	}
+	for _, p := range m.Parts {
+		if p.Type != "text/plain" {
+			t.Errorf("part type %q", p.Type)
+		}
+	}
+	if len(m.Attachments) != 1 || string(m.Attachments[0].Data) != "notes" {
+		t.Errorf("attachments %v", m.Attachments)
+	}
+
+	warned := 0
+	for _, w := range m.Warnings {
+		if strings.Contains(string(w), "empty Content-Type") {
+			warned++
+		}
+	}
+	if warned != 2 {
+		t.Errorf("warnings %q", m.Warnings)
+	}
+}
+
+func TestParseIllegalCompositeEncoding(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=outer\n" +
+		"Content-Transfer-Encoding: base64\n\n" +
+		"--outer\nContent-Type: multipart/alternative; boundary=inner\n" +
+		"Content-Transfer-Encoding: Quoted-Printable\n\n" +
+		"--inner\nContent-Type: text/plain\n\nplain=3D\n" +
+		"--inner\nContent-Type: text/html\n\n<p>html</p>\n" +
+		"--inner--\n" +
+		"--outer\nContent-Type: application/octet-stream\n" +
+		"Content-Disposition: attachment; filename=a.bin\n" +
+		"Content-Transfer-Encoding: base64\n\nZGF0YQ==\n" +
+		"--outer--\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.Text != "plain=3D" || m.Html != "<p>html</p>" {
+		t.Errorf("Text = %q, Html = %q", m.Text, m.Html)
+	}
+	if len(m.Attachments) != 1 || string(m.Attachments[0].Data) != "data" {
+		t.Errorf("attachments %v", m.Attachments)
+	}
+
+	want := []Warning{
+		"base64 transfer encoding on a multipart/mixed entity ignored",
+		"quoted-printable transfer encoding on a multipart/alternative entity ignored",
+	}
+	for _, w := range want {
+		found := false
+		for _, got := range m.Warnings {
+			found = found || got == w
+		}
+		if !found {
+			t.Errorf("warning %q missing from %q", w, m.Warnings)
+		}
+	}
+}
+
+func TestBodyReader(t *testing.T) {
+	raw := "Content-Type: text/plain; charset=iso-8859-1\n" +
+		"Content-Transfer-Encoding: quoted-printable\n\n" +
+		"caf=E9\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	body, err := io.ReadAll(m.BodyReader())
+	if err != nil || string(body) != "caf=E9\r\n" {
+		t.Errorf("BodyReader = %q, %v", body, err)
+	}
+
+	// each call starts from the beginning
+	again, _ := io.ReadAll(m.BodyReader())
+	if !bytes.Equal(again, body) {
+		t.Errorf("second BodyReader = %q", again)
+	}
+
+	text, err := io.ReadAll(m.TextReader())
+	if err != nil || string(text) != "café\r\n" {
+		t.Errorf("TextReader = %q, %v", text, err)
+	}
+}
+
+func TestParseTextTransferEncoding(t *testing.T) {
+	qp := "Content-Type: text/plain; charset=utf-8\n" +
+		"Content-Transfer-Encoding: quoted-printable\n\n" +
+		"Une phrase assez longue pour =C3=AAtre coup=C3=A9e par une fin de ligne =\n" +
+		"douce, caf=C3=A9 cr=C3=A8me.\n"
+	latin1 := base64.StdEncoding.EncodeToString([]byte("Gr\xfc\xdfe aus M\xfcnchen\r\n"))
+
+	for _, c := range []struct {
+		name, raw, text, html string
+	}{
+		{
+			"quoted-printable with soft line breaks",
+			qp,
+			"Une phrase assez longue pour être coupée par une fin de ligne douce, café crème.\r\n", "",
+		},
+		{
+			"base64 latin-1",
+			"Content-Type: text/plain; charset=iso-8859-1\nContent-Transfer-Encoding: BASE64\n\n" + latin1 + "\n",
+			"Grüße aus München\r\n", "",
+		},
+		{
+			"parts",
+			"Content-Type: multipart/alternative; boundary=b\n\n" +
+				"--b\nContent-Type: text/plain; charset=iso-8859-1\nContent-Transfer-Encoding: base64\n\n" + latin1 + "\n" +
+				"--b\nContent-Type: text/html; charset=utf-8\nContent-Transfer-Encoding: Quoted-Printable\n\n" +
+				"<p>caf=C3=A9 =\ncr=C3=A8me</p>\n" +
+				"--b--\n",
+			"Grüße aus München\r\n", "<p>café crème</p>",
+		},
+		{
+			"8bit",
+			"Content-Type: text/plain; charset=utf-8\nContent-Transfer-Encoding: 8bit\n\ncafé =C3=A9\n",
+			"café =C3=A9\r\n", "",
+		},
+	} {
+		m, errs := Parse(crlf(c.raw))
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", c.name, errs)
+			continue
+		}
+
+		if m.Text != c.text || m.Html != c.html {
+			t.Errorf("%s: Text = %q, Html = %q", c.name, m.Text, m.Html)
+		}
+	}
+}
+
+func TestPreferredBody(t *testing.T) {
+	alternative := func(boundary string, parts ...string) string {
+		s := "Content-Type: multipart/alternative; boundary=" + boundary + "\n\n"
+		for _, p := range parts {
+			s += "--" + boundary + "\n" + p + "\n"
+		}
+		return s + "--" + boundary + "--\n"
+	}
+	mixed := func(parts ...string) string {
+		s := "Content-Type: multipart/mixed; boundary=m\n\n"
+		for _, p := range parts {
+			s += "--m\n" + p
+		}
+		return s + "--m--\n"
+	}
+
+	const (
+		plain    = "Content-Type: text/plain\n\nplain"
+		html     = "Content-Type: text/html\n\n<p>html</p>"
+		watch    = "Content-Type: text/watch-html\n\n<b>watch</b>"
+		calendar = "Content-Type: text/calendar\n\nBEGIN:VCALENDAR"
+	)
+
+	for _, c := range []struct {
+		name, raw        string
+		text, html, mime string
+	}{
+		{"plain and html", alternative("a", plain, html), "plain", "<p>html</p>", "text/html"},
+		{"html and plain", alternative("a", html, plain), "plain", "<p>html</p>", "text/plain"},
+		{"watch-html last", alternative("a", plain, html, watch), "plain", "<p>html</p>", "text/html"},
+		{"calendar", alternative("a", plain, calendar), "plain", "", "text/plain"},
+		{
+			"nested in mixed",
+			mixed(alternative("a", plain, html), "Content-Type: application/pdf\nContent-Disposition: attachment\n\nPDF\n"),
+			"plain", "<p>html</p>", "text/html",
+		},
+		{
+			"first of two alternatives",
+			mixed(alternative("a", plain, html), alternative("b", "Content-Type: text/plain\n\nsecond", "Content-Type: text/html\n\n<p>second</p>")),
+			"plain", "<p>html</p>", "text/html",
+		},
+		{
+			"alternative after a text",
+			mixed("Content-Type: text/plain\n\nintro\n", alternative("a", plain, html)),
+			"plain", "<p>html</p>", "text/html",
+		},
+		{"no alternative", mixed("Content-Type: text/plain\n\nintro\n", "Content-Type: text/html\n\n<p>later</p>\n"), "intro", "<p>later</p>", "text/plain"},
+		{"html only", "Content-Type: text/html\n\n<p>html</p>", "", "<p>html</p>", "text/html"},
+		{"plain only", "Content-Type: text/plain\n\nplain", "plain", "", "text/plain"},
+	} {
+		m, errs := Parse(crlf(c.raw))
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", c.name, errs)
+			continue
+		}
+
+		if m.Text != c.text || m.Html != c.html {
+			t.Errorf("%s: Text = %q, Html = %q", c.name, m.Text, m.Html)
+		}
+
+		want := c.text
+		if c.mime == "text/html" {
+			want = c.html
+		}
+		if mt, data := m.PreferredBody(); mt != c.mime || string(data) != want {
+			t.Errorf("%s: PreferredBody = %s %q, want %s %q", c.name, mt, data, c.mime, want)
+		}
+	}
+}
+
+func TestParseDoesNotPrint(t *testing.T) {
+	raw := "From: a@example.com\r\n" +
+		"Subject: =?x-unknown?B?aGVsbG8=?= =?utf-8?B?!!!?=\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--b\r\nContent-Type: application/octet-stream; name=\"=?utf-8?Q?bad=ZZ?=\"\r\n" +
+		"Content-Disposition: attachment\r\n\r\ndata\r\n" +
+		"--b--\r\n"
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	Parse([]byte(raw))
+	os.Stdout = stdout
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > 0 {
+		t.Errorf("parsing printed %q", out)
+	}
+}
+
+func TestParseStats(t *testing.T) {
+	var stats ParseStats
+	m, errs := ParseWithOptions(crlf(nestedMessage), ParseOptions{Stats: &stats})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := ParseStats{
+		Headers:      2,
+		Parts:        3,
+		Attachments:  1,
+		DecodedBytes: len("café") + len("<p>café</p>") + len("%PDF-1.4"),
+	}
+	if stats.Elapsed < 0 {
+		t.Errorf("Stats.Elapsed = %v", stats.Elapsed)
+	}
+	stats.Elapsed = 0
+	if stats != want {
+		t.Errorf("Stats = %+v, want %+v", stats, want)
+	}
+	if m.Text != "café" || len(m.Attachments) != 1 || m.Attachments[0].Size != len("%PDF-1.4") {
+		t.Errorf("Text %q, attachments %v", m.Text, m.Attachments)
+	}
+
+	// the figures are replaced on each parse
+	if _, errs := ParseWithOptions(crlf("Subject: hi\n\nhello\n"), ParseOptions{Stats: &stats}); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if stats.Headers != 1 || stats.Parts != 0 || stats.Attachments != 0 || stats.DecodedBytes != len("hello\r\n") {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
+
+func TestUnwrapBase64MessageStats(t *testing.T) {
+	inner := "Subject: inner\r\nFrom: a@example.com\r\n\r\nhello from the inner message\r\n"
+	raw := "From: gateway@example.com\r\n" +
+		"To: b@example.com\r\n" +
+		"Subject: wrapper\r\n" +
+		"Date: Mon, 2 Oct 2023 10:00:00 +0000\r\n" +
+		"Content-Type: text/plain\r\n\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(inner)) + "\r\n"
+
+	var stats ParseStats
+	m, errs := ParseWithOptions([]byte(raw), ParseOptions{UnwrapBase64Messages: true, Stats: &stats})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.Unwrapped == nil || m.Unwrapped.Subject != "inner" {
+		t.Fatalf("unwrapped %+v", m.Unwrapped)
+	}
+	if stats.Headers != 5 {
+		t.Errorf("Stats.Headers = %d, want 5", stats.Headers)
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	raw := crlf(nestedMessage)
+	want, errs := Parse(raw)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	for _, c := range []struct {
+		name string
+		r    io.Reader
+	}{
+		{"bytes.Reader", bytes.NewReader(raw)},
+		{"io.LimitedReader", &io.LimitedReader{R: bytes.NewReader(append(raw, "trailing garbage"...)), N: int64(len(raw))}},
+		{"one byte at a time", iotest.OneByteReader(bytes.NewReader(raw))},
+		{"small chunks", iotest.HalfReader(bytes.NewReader(raw))},
+	} {
+		m, errs := ParseReader(c.r)
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", c.name, errs)
+			continue
+		}
+
+		if m.Text != want.Text || m.Html != want.Html || len(m.Attachments) != len(want.Attachments) {
+			t.Errorf("%s: Text %q, Html %q, %d attachments", c.name, m.Text, m.Html, len(m.Attachments))
+		}
+		if !bytes.Equal(m.Body, want.Body) {
+			t.Errorf("%s: body differs", c.name)
+		}
+	}
+}
+
+func TestParseReaderError(t *testing.T) {
+	r := io.MultiReader(bytes.NewReader(crlf(nestedMessage)), iotest.ErrReader(errors.New("connection reset")))
+
+	_, errs := ParseReader(r)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "connection reset") {
+		t.Errorf("errors %v, want the read error", errs)
+	}
+}
+
+func TestParseHeaderBlock(t *testing.T) {
+	for _, c := range []struct {
+		name, raw, headers, text string
+	}{
+		{"empty body", "From: a@example.com\r\nSubject: hello\r\n\r\n", "From: a@example.com\r\nSubject: hello", ""},
+		{"no body", "From: a@example.com\r\nSubject: hello", "From: a@example.com\r\nSubject: hello", ""},
+		{"body in a header", "Subject: hello\r\nX-Note: hello\r\n\r\nhello", "Subject: hello\r\nX-Note: hello", "hello"},
+		{"body in the first header", "From: a@example.com\r\nTo: b@example.com\r\n\r\nFrom", "From: a@example.com\r\nTo: b@example.com", "From"},
+	} {
+		m, errs := Parse([]byte(c.raw))
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", c.name, errs)
+			continue
+		}
+
+		if string(m.Headers) != c.headers {
+			t.Errorf("%s: headers %q, want %q", c.name, m.Headers, c.headers)
+		}
+		if m.Text != c.text {
+			t.Errorf("%s: text %q, want %q", c.name, m.Text, c.text)
+		}
+	}
+}
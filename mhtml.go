@@ -0,0 +1,112 @@
+// Resolution of the resources of HTML parts (MHTML).
+
+package eml
+
+import (
+	"encoding/base64"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// clean an URL header value, which may be quoted and folded anywhere as
+// stated by RFC2557
+func partURL(v string) string {
+	return strings.Trim(strings.Join(strings.Fields(v), ""), `"`)
+}
+
+// get the absolute location of a part, resolving its Content-Location
+// against its Content-Base or, if missing, against the given base
+func partLocation(p Part, base string) *url.URL {
+	if p.Location == "" {
+		return nil
+	}
+
+	loc, err := url.Parse(p.Location)
+	if err != nil {
+		return nil
+	}
+
+	if p.Base != "" {
+		base = p.Base
+	}
+	if b, err := url.Parse(base); err == nil && base != "" {
+		loc = b.ResolveReference(loc)
+	}
+
+	return loc
+}
+
+// ResolveResource finds the part of the message referenced by ref, a
+// resource URL (such as an img src) found in the HTML part from. Relative
+// references are resolved against the Content-Location of from, as in
+// MHTML archives, and cid: references are matched with the Content-ID of
+// the parts.
+func (m Message) ResolveResource(from Part, ref string) (Part, bool) {
+	ref = strings.TrimSpace(ref)
+
+	if strings.HasPrefix(strings.ToLower(ref), "cid:") {
+		id, err := url.PathUnescape(ref[len("cid:"):])
+		if err != nil {
+			id = ref[len("cid:"):]
+		}
+
+		for _, p := range m.Parts {
+			cid := textproto.MIMEHeader(p.Headers).Get("Content-Id")
+			if strings.Trim(strings.TrimSpace(cid), "<>") == id {
+				return p, true
+			}
+		}
+
+		return Part{}, false
+	}
+
+	// the Content-Base of the message is the default base of its parts
+	base := ""
+	if v := m.header("Content-Base"); len(v) > 0 {
+		base = partURL(v[0])
+	}
+
+	target, err := url.Parse(ref)
+	if err != nil {
+		return Part{}, false
+	}
+
+	if loc := partLocation(from, base); loc != nil {
+		target = loc.ResolveReference(target)
+	} else if b, err := url.Parse(base); err == nil && base != "" {
+		target = b.ResolveReference(target)
+	}
+
+	for _, p := range m.Parts {
+		if loc := partLocation(p, base); loc != nil && loc.String() == target.String() {
+			return p, true
+		}
+	}
+
+	return Part{}, false
+}
+
+// cid: URLs of an HTML document
+var cidURLR = regexp.MustCompile(`(?i)cid:[^"'\s)>]+`)
+
+// HTMLWithDataURIs returns the HTML body with its cid: references to inline
+// parts replaced by data: URIs holding the parts, so it can be rendered
+// without the message. References to missing parts are left as they are.
+func (m Message) HTMLWithDataURIs() string {
+	return cidURLR.ReplaceAllStringFunc(m.Html, func(ref string) string {
+		id, err := url.PathUnescape(ref[len("cid:"):])
+		if err != nil {
+			id = ref[len("cid:"):]
+		}
+
+		for _, in := range m.Inlines {
+			if in.ContentID == id {
+				return "data:" + in.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(in.Data)
+			}
+		}
+
+		return ref
+	})
+}
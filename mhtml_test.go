@@ -0,0 +1,74 @@
+package eml
+
+import "testing"
+
+const mhtmlMessage = `From: a@example.com
+Content-Base: "http://example.com/
+ site/"
+Content-Type: multipart/related; boundary=b
+
+--b
+Content-Type: text/html
+Content-Location: page/index.html
+
+<img src="img/logo.png"><img src="../style/bg.png"><img src="cid:chart@x">
+--b
+Content-Type: image/png
+Content-Location: http://example.com/site/page/img/logo.png
+
+LOGO
+--b
+Content-Type: image/png
+Content-Base: http://example.com/site/style/
+Content-Location: bg.png
+
+BG
+--b
+Content-Type: image/png
+Content-ID: <chart@x>
+
+CHART
+--b--
+`
+
+func TestPartLocation(t *testing.T) {
+	m, errs := Parse(crlf(mhtmlMessage))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if len(m.Parts) != 4 {
+		t.Fatalf("%d parts", len(m.Parts))
+	}
+	if p := m.Parts[0]; p.Location != "page/index.html" || p.Base != "" {
+		t.Errorf("html location %q, base %q", p.Location, p.Base)
+	}
+	if p := m.Parts[2]; p.Location != "bg.png" || p.Base != "http://example.com/site/style/" {
+		t.Errorf("image location %q, base %q", p.Location, p.Base)
+	}
+}
+
+func TestResolveResource(t *testing.T) {
+	m, errs := Parse(crlf(mhtmlMessage))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	html := m.Parts[0]
+
+	for _, c := range []struct {
+		ref, want string
+	}{
+		{"img/logo.png", "LOGO"},
+		{"../style/bg.png", "BG"},
+		{"http://example.com/site/page/img/logo.png", "LOGO"},
+		{"cid:chart@x", "CHART"},
+		{"CID:chart%40x", "CHART"},
+		{"img/missing.png", ""},
+		{"cid:missing@x", ""},
+	} {
+		p, ok := m.ResolveResource(html, c.ref)
+		if ok != (c.want != "") || ok && string(p.Data) != c.want {
+			t.Errorf("%q: %q, %v, want %q", c.ref, p.Data, ok, c.want)
+		}
+	}
+}
@@ -4,7 +4,7 @@ package eml
 
 import (
 	"bytes"
-	"errors"
+	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
@@ -16,25 +16,45 @@ import (
 
 type Part struct {
 	Type    string
-	Charset string
+	Charset string // charset declared by the Content-Type
+
+	// charset the text was decoded from, which differs from Charset when it
+	// was missing, unknown or wrong and the charset was sniffed. empty for
+	// the parts that are not decoded texts
+	DecodedCharset string
+
+	Params  map[string]string // Content-Type parameters
 	Data    []byte
 	Headers map[string][]string
+
+	// exact bytes of the part as found in the message: its headers, the
+	// blank line and its body, without the line break belonging to the
+	// boundary delimiter. nil for the body of a message that is not a
+	// multipart, which is the message itself
+	Raw []byte
+
+	Location string // Content-Location, as defined by RFC2557
+	Base     string // Content-Base, as defined by RFC2110
+
+	alternative int // multipart/alternative holding the part, 0 for none
 }
 
 // Parse the body of a message, using the given content-type. If the content
 // type is multipart, the parts slice will contain an entry for each part
 // present; otherwise, it will contain a single entry, with the entire (raw)
-// message contents.
-func parseBody(ct string, body []byte, ph textproto.MIMEHeader) (parts []Part, err error) {
+// message contents. The MIME tree of the body is returned too, its leaves
+// standing for the parts, in the same order. Recoverable oddities of the
+// parts are reported as warnings.
+func parseBody(ct string, body []byte, ph textproto.MIMEHeader) (node *MIMENode, parts []Part, warnings []Warning, err error) {
 	mt, ps, err := mime.ParseMediaType(ct)
 	if err != nil {
-		return
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrBadMediaType, err)
 	}
 
 	boundary, ok := ps["boundary"]
 	if !ok {
 		if strings.HasPrefix(mt, "multipart") {
-			return nil, errors.New("multipart specified without boundary")
+			return nil, nil, nil, ErrNoBoundary
 		}
 
 		// must add the CRLF at the body before calling the mail.readmessage
@@ -43,7 +63,7 @@ func parseBody(ct string, body []byte, ph textproto.MIMEHeader) (parts []Part, e
 
 		m, err := mail.ReadMessage(r)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 
 		// generate the list of headers by joining the found headers
@@ -61,39 +81,121 @@ func parseBody(ct string, body []byte, ph textproto.MIMEHeader) (parts []Part, e
 		parts = append(parts, Part{
 			Type:    mt,
 			Charset: ps["charset"],
+			Params:  ps,
 			Data:    body,
 			Headers: headers,
+
+			Location: partURL(textproto.MIMEHeader(headers).Get("Content-Location")),
+			Base:     partURL(textproto.MIMEHeader(headers).Get("Content-Base")),
 		})
 
-		return parts, err
+		return &MIMENode{leaf: true}, parts, nil, err
 	}
 
+	// read the raw parts, the transfer encodings are decoded later and
+	// must not be applied to composite parts. the reader doesn't tell where
+	// the parts are, so their bytes are found by splitting the body too
+	_, raws, _ := splitMultipart(body, boundary)
+	node = &MIMENode{Part: Part{Type: mt, Params: ps, Data: body, Headers: ph}}
 	r := multipart.NewReader(bytes.NewReader(body), boundary)
-	p, err := r.NextPart()
-	for err == nil {
-		// check if this multipart part is empty
-		if len(p.Header.Values("Content-Type")) == 0 {
-			p, err = r.NextPart()
-			continue
+	p, err := r.NextRawPart()
+	groups := 0
+	for n := 0; err == nil; n++ {
+		var raw []byte
+		if n < len(raws) {
+			raw = raws[n]
+		}
+
+		// a part without Content-Type gets the default of RFC2045, or the
+		// one of the digests (RFC2046 5.1.5)
+		ct := "text/plain; charset=us-ascii"
+		if mt == "multipart/digest" {
+			ct = "message/rfc822"
+		}
+
+		// a blank Content-Type is no media type at all, so the default
+		// applies too
+		if v := p.Header.Values("Content-Type"); len(v) > 0 {
+			if strings.TrimSpace(v[0]) != "" {
+				ct = v[0]
+			} else {
+				ct = "text/plain"
+				warnings = append(warnings, Warning("empty Content-Type in a part, assumed text/plain"))
+			}
+		}
+
+		if cte := p.Header.Get("Content-Transfer-Encoding"); isCompositeType(ct) && !isIdentityEncoding(cte) {
+			warnings = append(warnings, illegalEncodingWarning(ct, cte))
 		}
 
 		data, _ := io.ReadAll(p) // ignore error
+
+		// use the same bytes in the body, so the parts nested in this one
+		// are slices of the input too
+		if n := len(raw) - len(data); n >= 0 && bytes.Equal(raw[n:], data) {
+			data = raw[n:]
+		}
+
+		var subnode *MIMENode
 		var subparts []Part
-		subparts, err = parseBody(p.Header["Content-Type"][0], data, p.Header)
+		var subwarnings []Warning
+		subnode, subparts, subwarnings, err = parseBody(ct, data, p.Header)
+		warnings = append(warnings, subwarnings...)
+
+		// a multipart that can't be read is malformed, only the leaves
+		// with an unparsable Content-Type are kept as they are
+		if err != nil && strings.HasPrefix(strings.ToLower(strings.TrimSpace(ct)), "multipart/") {
+			return nil, nil, warnings, fmt.Errorf("nested %s: %w", strings.TrimSpace(strings.Split(ct, ";")[0]), err)
+		}
+
+		// a leaf is the part itself, the parts of a multipart got theirs
+		// while it was parsed
+		if err == nil && subnode.leaf {
+			subparts[0].Raw = raw
+		}
+
+		if err != nil {
+			subnode = &MIMENode{leaf: true}
+		} else if !subnode.leaf {
+			subnode.Raw = raw
+		}
+		node.Children = append(node.Children, subnode)
 
 		if err == nil {
+			// number the alternatives of the subparts after the ones
+			// already found
+			n := groups
+			for i := range subparts {
+				if subparts[i].alternative != 0 {
+					subparts[i].alternative += groups
+					n = max(n, subparts[i].alternative)
+				}
+			}
+			groups = n
+
 			parts = append(parts, subparts...)
 		} else {
-			contenttype := regexp.MustCompile("(?is)charset=(.*)").FindStringSubmatch(p.Header["Content-Type"][0])
+			contenttype := regexp.MustCompile("(?is)charset=(.*)").FindStringSubmatch(ct)
 			charset := "UTF-8"
 			if len(contenttype) > 1 {
 				charset = contenttype[1]
 			}
-			part := Part{p.Header["Content-Type"][0], charset, data, p.Header}
+			_, params, _ := mime.ParseMediaType(ct)
+			part := Part{
+				Type:    ct,
+				Charset: charset,
+				Params:  params,
+				Data:    data,
+				Headers: p.Header,
+				Raw:     raw,
+
+				Location: partURL(p.Header.Get("Content-Location")),
+				Base:     partURL(p.Header.Get("Content-Base")),
+			}
 			parts = append(parts, part)
 		}
 
-		p, err = r.NextPart()
+		p, err = r.NextRawPart()
 	}
 
 	if err == io.EOF {
@@ -102,5 +204,74 @@ func parseBody(ct string, body []byte, ph textproto.MIMEHeader) (parts []Part, e
 		err = nil
 	}
 
+	// the parts of an alternative not nested in another one belong to it
+	if mt == "multipart/alternative" {
+		for i := range parts {
+			if parts[i].alternative == 0 {
+				parts[i].alternative = groups + 1
+			}
+		}
+	}
+
+	return
+}
+
+// check if a part is an attachment, by its Content-Disposition
+func isAttachmentPart(p Part) bool {
+	cd := textproto.MIMEHeader(p.Headers).Get("Content-Disposition")
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(cd)), "attachment")
+}
+
+// choose the parts giving the text and HTML bodies of the message, and the
+// preferred body: they come from the first alternative holding such a text,
+// or else from the first part outside of any alternative. as stated by
+// RFC2046, the last part of an alternative is the preferred one. -1 means
+// none
+func bodyParts(parts []Part) (text, html, preferred int) {
+	text, html, preferred = -1, -1, -1
+
+	// the alternatives are searched first, then the other parts
+	for _, inAlternative := range []bool{true, false} {
+		for k := 0; k < len(parts); k++ {
+			end := k + 1
+			if g := parts[k].alternative; g != 0 {
+				for end < len(parts) && parts[end].alternative == g {
+					end++
+				}
+			}
+
+			if (parts[k].alternative != 0) != inAlternative {
+				k = end - 1
+				continue
+			}
+
+			t, h, p := -1, -1, -1
+			for i := k; i < end; i++ {
+				if isAttachmentPart(parts[i]) {
+					continue
+				}
+
+				switch {
+				case strings.Contains(parts[i].Type, "text/plain"):
+					t, p = i, i
+				case strings.Contains(parts[i].Type, "text/html"):
+					h, p = i, i
+				}
+			}
+
+			if text == -1 {
+				text = t
+			}
+			if html == -1 {
+				html = h
+			}
+			if preferred == -1 {
+				preferred = p
+			}
+
+			k = end - 1
+		}
+	}
+
 	return
 }
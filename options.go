@@ -0,0 +1,97 @@
+package eml
+
+import (
+	"time"
+)
+
+// ControlCharPolicy tells what to do with the control characters (NUL, a
+// lone CR...) found in header values, which may be smuggling attempts
+type ControlCharPolicy int
+
+const (
+	ControlCharsKeep   ControlCharPolicy = iota // keep the value untouched
+	ControlCharsStrip                           // remove them, with a warning
+	ControlCharsReject                          // drop the header, with an error
+)
+
+// RawOptions changes how a message is split by ParseRawWithOptions. The
+// zero value gives the same result as ParseRaw.
+type RawOptions struct {
+	// record the byte span of each header field in the input, for the
+	// tools that need the exact bytes of the fields, such as DKIM
+	HeaderSpans bool
+}
+
+// ParseOptions changes how a message is parsed by ParseWithOptions. The zero
+// value gives the same result as Parse.
+type ParseOptions struct {
+	// charset used to decode text declared with a pseudo-charset (such as
+	// unknown-8bit or x-unknown) and address display names sent as raw
+	// 8-bit text that is not UTF-8. when empty, the charset is sniffed from
+	// the contents
+	DefaultCharset string
+
+	// handling of the control characters in header values. tabs and the
+	// line breaks of folded lines are never considered control characters
+	HeaderControlChars ControlCharPolicy
+
+	// recover messages that a broken gateway encoded in base64 as a whole,
+	// headers included, and sent as the body of a text/plain or
+	// application/octet-stream message. the body is parsed into Unwrapped
+	// when it decodes to something that looks like a message. this is a
+	// heuristic, which may be fooled by a base64 body holding header lines
+	UnwrapBase64Messages bool
+
+	// limits on untrusted messages, 0 means no limit. the attachments and
+	// inline parts that would decode to more than MaxAttachmentBytes, or
+	// take the decoded size of all of them over MaxTotalBytes, are skipped
+	// without being decoded, with an error. the parts beyond MaxParts are
+	// dropped, with an error
+	MaxAttachmentBytes int
+	MaxTotalBytes      int
+	MaxParts           int
+
+	// record only the metadata of the attachments, for indexing: their
+	// Data is left nil once decoded, Size still gives their decoded length.
+	// the encoded data is kept in Parts, a slice of the parsed input, so
+	// WalkAttachments still streams them
+	SkipAttachmentData bool
+
+	// tell which parts, besides the texts giving the body, are attachments.
+	// the others are kept as inline parts when they have a Content-ID or an
+	// inline disposition, and dropped otherwise. when nil, a part is an
+	// attachment when its Content-Disposition says so
+	IsAttachment func(part Part) bool
+
+	// run extra checks on the message, adding to Warnings the oddities that
+	// don't stop the parse but may flag suspicious mail: duplicated fields
+	// such as Date, a missing or unknown MIME-Version, a multipart whose
+	// boundary can't be found in its body and a text whose declared legacy
+	// charset is belied by a valid UTF-8 body
+	CollectWarnings bool
+
+	// when set, filled with the figures of the parse
+	Stats *ParseStats
+}
+
+// ParseStats holds the figures of a parse, for monitoring
+type ParseStats struct {
+	Headers      int           // header fields of the message
+	Parts        int           // MIME parts found in the body
+	Attachments  int           // attachments found in the body
+	DecodedBytes int           // size of the decoded text, HTML and attachments
+	Elapsed      time.Duration // time spent parsing
+}
+
+// fill the figures of the parsed message, started at start
+func (s *ParseStats) record(start time.Time, msg *Message) {
+	s.Parts = len(msg.Parts)
+	s.Attachments = len(msg.Attachments)
+
+	s.DecodedBytes = len(msg.Text) + len(msg.Html)
+	for _, a := range msg.Attachments {
+		s.DecodedBytes += a.Size
+	}
+
+	s.Elapsed = time.Since(start)
+}
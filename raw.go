@@ -2,23 +2,145 @@ package eml
 
 import (
 	"bytes"
-	"errors"
 )
 
 type RawHeader struct {
 	Key, Value []byte
 }
 
+// HeaderSpan is the [Start,End) byte range of a header field in the parsed
+// input, covering its folded lines and the terminating line break
+type HeaderSpan struct {
+	Key        string
+	Start, End int
+}
+
 type RawMessage struct {
-	RawHeaders []RawHeader
-	Body       []byte
+	RawHeaders  []RawHeader
+	HeaderSpans []HeaderSpan // one for each of the RawHeaders, with RawOptions.HeaderSpans
+	Body        []byte
+	MboxFrom    []byte // leading mbox envelope line ("From sender date"), if any
 }
 
 func isWSP(b byte) bool {
 	return b == ' ' || b == '\t'
 }
 
+// check if the data starts with a mbox envelope line ("From sender date").
+// obsolete syntax allows whitespace before the colon of a header, so a line
+// like "From : someone" is still handled as a header
+func isMboxFrom(s []byte) bool {
+	if !bytes.HasPrefix(s, []byte("From ")) {
+		return false
+	}
+
+	for _, b := range s[4:] {
+		if !isWSP(b) {
+			return b != ':' && b != '\r' && b != '\n'
+		}
+	}
+
+	return false
+}
+
+// length of the fold starting at i of a header value: a line break (CRLF or
+// a bare LF) followed by whitespace, 0 if there is none
+func foldLen(v []byte, i int) int {
+	n := i
+	if n < len(v) && v[n] == '\r' {
+		n++
+	}
+	if n >= len(v) || v[n] != '\n' || n+1 >= len(v) || !isWSP(v[n+1]) {
+		return 0
+	}
+
+	n++
+	for n < len(v) && isWSP(v[n]) {
+		n++
+	}
+
+	return n - i
+}
+
+// unfold a header value by replacing each fold (a CRLF or a bare LF line
+// break with the whitespace starting the continuation line) by a single
+// space, so the folded words remain separated. consecutive folds, around
+// lines holding only whitespace, make a single space, and a value starting
+// on a continuation line loses its leading fold
+func unfold(v []byte) []byte {
+	if bytes.IndexByte(v, '\n') < 0 {
+		return v
+	}
+
+	u := make([]byte, 0, len(v))
+	for i := 0; i < len(v); i++ {
+		if n := foldLen(v, i); n > 0 {
+			for n > 0 {
+				i += n
+				n = foldLen(v, i)
+			}
+			i--
+
+			if len(u) > 0 {
+				u = append(u, ' ')
+			}
+			continue
+		}
+
+		u = append(u, v[i])
+	}
+
+	return u
+}
+
+// check if the byte at i of a header value is a control character. tabs
+// and the line breaks of folded lines are allowed
+func isHeaderControl(v []byte, i int) bool {
+	b := v[i]
+
+	switch {
+	case b == '\t':
+		return false
+	case b == '\n':
+		return i+1 >= len(v) || !isWSP(v[i+1])
+	case b == '\r':
+		return !(i+2 < len(v) && v[i+1] == '\n' && isWSP(v[i+2]))
+	}
+
+	return b < 0x20 || b == 0x7f
+}
+
+// remove the control characters from a header value. the value is copied
+// only when something is removed
+func stripHeaderControls(v []byte) (stripped []byte, found bool) {
+	for i := range v {
+		if !isHeaderControl(v, i) {
+			if found {
+				stripped = append(stripped, v[i])
+			}
+			continue
+		}
+
+		if !found {
+			stripped = append([]byte{}, v[:i]...)
+			found = true
+		}
+	}
+
+	if !found {
+		stripped = v
+	}
+
+	return
+}
+
 func ParseRaw(s []byte) (m RawMessage, e error) {
+	return ParseRawWithOptions(s, RawOptions{})
+}
+
+// ParseRawWithOptions splits a message into its raw header fields and body
+// as ParseRaw does, tuned by opts.
+func ParseRawWithOptions(s []byte, opts RawOptions) (m RawMessage, e error) {
 	// parser states
 	const (
 		READY = iota
@@ -32,15 +154,22 @@ func ParseRaw(s []byte) (m RawMessage, e error) {
 		LF = '\n'
 	)
 
-	CRLF := []byte{CR, LF}
-
 	state := READY
 	kstart, kend, vstart := 0, 0, 0
 	done := false
 
 	m.RawHeaders = []RawHeader{}
 
-	for i := 0; i < len(s); i++ {
+	// skip the mbox envelope line left by mailbox extractors
+	start := 0
+	if isMboxFrom(s) {
+		if n := bytes.IndexByte(s, LF); n >= 0 {
+			m.MboxFrom = bytes.TrimSuffix(s[:n], []byte{CR})
+			start = n + 1
+		}
+	}
+
+	for i := start; i < len(s); i++ {
 		b := s[i]
 		switch state {
 		case READY:
@@ -68,25 +197,55 @@ func ParseRaw(s []byte) (m RawMessage, e error) {
 			if !isWSP(b) {
 				vstart = i
 				state = HVAL
+
+				// an empty value, let HVAL handle the line break as the
+				// header terminator
+				if b == CR || b == LF {
+					i--
+				}
 			}
 		case HVAL:
 			if b == CR && i < len(s)-2 && s[i+1] == LF && !isWSP(s[i+2]) {
-				v := bytes.Replace(s[vstart:i], CRLF, nil, -1)
+				v := unfold(s[vstart:i])
 				hdr := RawHeader{s[kstart:kend], v}
 				m.RawHeaders = append(m.RawHeaders, hdr)
+				if opts.HeaderSpans {
+					m.HeaderSpans = append(m.HeaderSpans, HeaderSpan{string(hdr.Key), kstart, i + 2})
+				}
 				state = READY
 				i++
 			} else if b == LF && i < len(s)-1 && !isWSP(s[i+1]) {
-				v := bytes.Replace(s[vstart:i], CRLF, nil, -1)
+				v := unfold(s[vstart:i])
 				hdr := RawHeader{s[kstart:kend], v}
 				m.RawHeaders = append(m.RawHeaders, hdr)
+				if opts.HeaderSpans {
+					m.HeaderSpans = append(m.HeaderSpans, HeaderSpan{string(hdr.Key), kstart, i + 1})
+				}
 				state = READY
 			}
 		}
 	}
+
+	// the body is optional, so the message may end right after a header
+	if state == HVWS || state == HVAL {
+		if state == HVWS {
+			vstart = len(s)
+		}
+
+		v := bytes.TrimSuffix(bytes.TrimSuffix(s[vstart:], []byte{LF}), []byte{CR})
+		v = unfold(v)
+		hdr := RawHeader{s[kstart:kend], v}
+		m.RawHeaders = append(m.RawHeaders, hdr)
+		if opts.HeaderSpans {
+			m.HeaderSpans = append(m.HeaderSpans, HeaderSpan{string(hdr.Key), kstart, len(s)})
+		}
+		m.Body = s[len(s):]
+		done = true
+	}
+
 Done:
 	if !done {
-		e = errors.New("unexpected EOF")
+		e = ErrUnexpectedEOF
 	}
 	return
 }
@@ -0,0 +1,275 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeaderSpans(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		raw    string
+		fields []string
+	}{
+		{
+			"CRLF",
+			"From: a@example.com\r\nSubject: folded\r\n\tover two lines\r\nX-Empty:\r\n\r\nbody\r\n",
+			[]string{"From: a@example.com\r\n", "Subject: folded\r\n\tover two lines\r\n", "X-Empty:\r\n"},
+		},
+		{
+			"LF",
+			"From: a@example.com\nSubject: folded\n over two lines\n\nbody\n",
+			[]string{"From: a@example.com\n", "Subject: folded\n over two lines\n"},
+		},
+		{
+			"mbox envelope",
+			"From sender@example.com Mon Oct  2 10:00:00 2023\nTo: b@example.com\n\nbody\n",
+			[]string{"To: b@example.com\n"},
+		},
+		{
+			"last header at the end of the input",
+			"From: a@example.com\r\nSubject: no body",
+			[]string{"From: a@example.com\r\n", "Subject: no body"},
+		},
+	} {
+		r, err := ParseRawWithOptions([]byte(c.raw), RawOptions{HeaderSpans: true})
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if len(r.HeaderSpans) != len(c.fields) || len(r.HeaderSpans) != len(r.RawHeaders) {
+			t.Errorf("%s: %d spans for %d headers, want %d", c.name, len(r.HeaderSpans), len(r.RawHeaders), len(c.fields))
+			continue
+		}
+
+		for i, s := range r.HeaderSpans {
+			if got := c.raw[s.Start:s.End]; got != c.fields[i] {
+				t.Errorf("%s: span %d is %q, want %q", c.name, i, got, c.fields[i])
+			}
+			if s.Key != string(r.RawHeaders[i].Key) {
+				t.Errorf("%s: span %d of %q, header %q", c.name, i, s.Key, r.RawHeaders[i].Key)
+			}
+		}
+
+		// the spans cover the header block with no gap
+		if len(r.HeaderSpans) > 1 {
+			for i := 1; i < len(r.HeaderSpans); i++ {
+				if r.HeaderSpans[i].Start != r.HeaderSpans[i-1].End {
+					t.Errorf("%s: gap before span %d", c.name, i)
+				}
+			}
+		}
+	}
+}
+
+func TestHeaderSpansOptional(t *testing.T) {
+	r, err := ParseRaw([]byte("From: a@example.com\r\nTo: b@example.com\r\n\r\nbody\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.RawHeaders) != 2 || r.HeaderSpans != nil {
+		t.Errorf("%d headers, spans %v without the option", len(r.RawHeaders), r.HeaderSpans)
+	}
+}
+
+func TestMboxFrom(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		raw      string
+		envelope string
+		first    string
+	}{
+		{"envelope", "From sender@example.com Mon Oct  2 10:00:00 2023\nFrom: a@example.com\n\nbody\n", "From sender@example.com Mon Oct  2 10:00:00 2023", "From"},
+		{"CRLF envelope", "From MAILER-DAEMON Mon Oct  2 10:00:00 2023\r\nSubject: hi\r\n\r\nbody\r\n", "From MAILER-DAEMON Mon Oct  2 10:00:00 2023", "Subject"},
+		{"header", "From: a@example.com\n\nbody\n", "", "From"},
+		{"obsolete header", "From : a@example.com\n\nbody\n", "", "From "},
+		{"obsolete header with tab", "From \t: a@example.com\n\nbody\n", "", "From \t"},
+	} {
+		r, err := ParseRaw([]byte(c.raw))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if string(r.MboxFrom) != c.envelope {
+			t.Errorf("%s: envelope %q, want %q", c.name, r.MboxFrom, c.envelope)
+		}
+		if len(r.RawHeaders) != 1 || string(r.RawHeaders[0].Key) != c.first {
+			t.Errorf("%s: headers %q", c.name, r.RawHeaders)
+		}
+		if string(r.Body) != "body\n" && string(r.Body) != "body\r\n" {
+			t.Errorf("%s: body %q", c.name, r.Body)
+		}
+	}
+}
+
+func TestParseMboxMessage(t *testing.T) {
+	raw := "From sender@example.com Mon Oct  2 10:00:00 2023\r\n" +
+		"From: Alice <alice@example.com>\r\nSubject: from an mbox\r\n\r\nbody\r\n"
+
+	m, errs := Parse([]byte(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if m.Subject != "from an mbox" || len(m.From) != 1 || m.From[0].Email() != "alice@example.com" {
+		t.Errorf("Subject %q, From %v", m.Subject, m.From)
+	}
+	if m.Text != "body\r\n" {
+		t.Errorf("Text %q", m.Text)
+	}
+}
+
+func TestLastHeader(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		raw   string
+		last  string
+		value string
+		body  string
+	}{
+		{"CRLF separator", "A: 1\r\nB: 2\r\n\r\nbody", "B", "2", "body"},
+		{"LF separator", "A: 1\nB: 2\n\nbody", "B", "2", "body"},
+		{"CRLF header, LF separator", "A: 1\r\nB: 2\r\n\nbody", "B", "2", "body"},
+		{"LF header, CRLF separator", "A: 1\nB: 2\n\r\nbody", "B", "2", "body"},
+		{"folded last header", "A: 1\r\nB: 2\r\n 3\r\n\r\nbody", "B", "2 3", "body"},
+		{"empty body", "A: 1\r\nB: 2\r\n\r\n", "B", "2", ""},
+		{"end of input", "A: 1\r\nB: 2", "B", "2", ""},
+		{"end of input after CRLF", "A: 1\r\nB: 2\r\n", "B", "2", ""},
+		{"end of input after LF", "A: 1\nB: 2\n", "B", "2", ""},
+		{"empty value", "A: 1\r\nB:\r\n\r\nbody", "B", "", "body"},
+		{"empty value with spaces", "A: 1\nB:   \n\nbody", "B", "", "body"},
+		{"empty value at the end of input", "A: 1\r\nB:", "B", "", ""},
+		{"empty value at the end of input after CRLF", "A: 1\r\nB:\r\n", "B", "", ""},
+	} {
+		r, err := ParseRaw([]byte(c.raw))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if len(r.RawHeaders) != 2 {
+			t.Errorf("%s: headers %q, want 2", c.name, r.RawHeaders)
+			continue
+		}
+		if h := r.RawHeaders[1]; string(h.Key) != c.last || string(h.Value) != c.value {
+			t.Errorf("%s: last header %q: %q, want %q: %q", c.name, h.Key, h.Value, c.last, c.value)
+		}
+		if string(r.Body) != c.body {
+			t.Errorf("%s: body %q, want %q", c.name, r.Body, c.body)
+		}
+	}
+}
+
+func TestHeaderControlChars(t *testing.T) {
+	raw := "From: a@example.com\r\n" +
+		"Subject: hello\x00 world\r\n" +
+		"X-Smuggled: a\rBcc: victim@example.com\r\n" +
+		"X-Folded: one\r\n\ttwo\x7f\r\n" +
+		"X-Clean: tab\there\r\n" +
+		"\r\nhi\r\n"
+
+	for _, c := range []struct {
+		policy   ControlCharPolicy
+		headers  map[string]string
+		warnings int
+		errors   int
+	}{
+		{ControlCharsKeep, map[string]string{
+			"Subject":    "hello\x00 world",
+			"X-Smuggled": "a\rBcc: victim@example.com",
+			"X-Folded":   "one two\x7f",
+			"X-Clean":    "tab\there",
+		}, 0, 0},
+		{ControlCharsStrip, map[string]string{
+			"Subject":    "hello world",
+			"X-Smuggled": "aBcc: victim@example.com",
+			"X-Folded":   "one two",
+			"X-Clean":    "tab\there",
+		}, 3, 0},
+		{ControlCharsReject, map[string]string{
+			"X-Clean": "tab\there",
+		}, 0, 3},
+	} {
+		m, errs := ParseWithOptions([]byte(raw), ParseOptions{HeaderControlChars: c.policy})
+
+		if len(errs) != c.errors {
+			t.Errorf("policy %d: errors %v", c.policy, errs)
+		}
+		if len(m.Warnings) != c.warnings {
+			t.Errorf("policy %d: warnings %q", c.policy, m.Warnings)
+		}
+
+		for _, k := range []string{"Subject", "X-Smuggled", "X-Folded", "X-Clean"} {
+			want, ok := c.headers[k]
+			got := m.ParsedHeaders[k]
+			if !ok && len(got) > 0 || ok && (len(got) != 1 || got[0] != want) {
+				t.Errorf("policy %d: %s = %q, want %q", c.policy, k, got, want)
+			}
+		}
+
+		if c.policy == ControlCharsReject && m.Subject != "" {
+			t.Errorf("policy %d: subject %q", c.policy, m.Subject)
+		}
+		if c.policy == ControlCharsStrip && strings.ContainsAny(m.Subject, "\x00") {
+			t.Errorf("policy %d: subject %q", c.policy, m.Subject)
+		}
+	}
+}
+
+func TestUnfoldHeaderValues(t *testing.T) {
+	for _, c := range []struct {
+		name, raw, want string
+	}{
+		{"CRLF", "Subject: one\r\n two\r\n three\r\n\r\nbody", "one two three"},
+		{"LF", "Subject: one\n two\n three\n\nbody", "one two three"},
+		{"mixed", "Subject: one\n two\r\n three\n\nbody", "one two three"},
+		{"tabs", "Subject: one\r\n\ttwo\r\n\t\tthree\r\n\r\nbody", "one two three"},
+		{"long runs", "Subject: one\n \t  two\r\n\t \t three\n\nbody", "one two three"},
+		{"blank continuation line", "Subject: one\r\n \r\n two\r\n\r\nbody", "one two"},
+		{"value on the next line", "Subject:\r\n one two\r\n\r\nbody", "one two"},
+	} {
+		r, err := ParseRaw([]byte(c.raw))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if len(r.RawHeaders) != 1 || string(r.RawHeaders[0].Value) != c.want {
+			t.Errorf("%s: headers %q, want %q", c.name, r.RawHeaders, c.want)
+		}
+		if string(r.Body) != "body" {
+			t.Errorf("%s: body %q", c.name, r.Body)
+		}
+	}
+}
+
+func TestHeaderBodySeparator(t *testing.T) {
+	for _, c := range []struct {
+		name, sep string
+	}{
+		{"CRLF CRLF", "\r\n\r\n"},
+		{"LF LF", "\n\n"},
+		{"CRLF LF", "\r\n\n"},
+		{"LF CRLF", "\n\r\n"},
+	} {
+		raw := "From: a@example.com\r\nSubject: hello" + c.sep + "body\nline"
+
+		r, err := ParseRaw([]byte(raw))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(r.RawHeaders) != 2 || string(r.Body) != "body\nline" {
+			t.Errorf("%s: %d headers, body %q", c.name, len(r.RawHeaders), r.Body)
+		}
+
+		m, errs := Parse([]byte(raw))
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", c.name, errs)
+		}
+		if string(m.Headers) != "From: a@example.com\r\nSubject: hello" || m.Subject != "hello" {
+			t.Errorf("%s: headers %q, subject %q", c.name, m.Headers, m.Subject)
+		}
+	}
+}
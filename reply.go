@@ -0,0 +1,149 @@
+// Helpers to compose replies.
+
+package eml
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ReplyOptions changes how Reply composes the reply
+type ReplyOptions struct {
+	Quote             bool   // quote the original text, after an attribution line
+	AttributionLayout string // layout of the attribution line, see AttributionLine
+}
+
+// subjects that are already a reply
+var replySubjectR = regexp.MustCompile(`(?i)^\s*re\s*:`)
+
+// default layout of AttributionLine
+const DefaultAttributionLayout = "On Mon, Jan 2, 2006 at 15:04, {from} wrote:"
+
+// DisplaySender returns the name to show for the author of the message: the
+// display name of the first From address, or its email when it has no name.
+// The Sender is used when there is no From.
+func (m Message) DisplaySender() string {
+	if len(m.From) > 0 {
+		return m.From[0].Name()
+	}
+
+	if m.Sender != nil {
+		return m.Sender.Name()
+	}
+
+	return ""
+}
+
+// AttributionLine returns the line introducing the quoted message on a reply,
+// such as "On Mon, Jan 2, 2006 at 15:04, Alice wrote:". The layout is a time
+// layout (see the time package) used to format the message date, in which
+// "{from}" is replaced by DisplaySender. Its literal text can be translated,
+// as long as it does not contain time layout elements; an empty layout uses
+// DefaultAttributionLayout.
+func (m Message) AttributionLine(layout string) string {
+	if layout == "" {
+		layout = DefaultAttributionLayout
+	}
+
+	return strings.ReplaceAll(m.Date.Format(layout), "{from}", m.DisplaySender())
+}
+
+// Reply starts the composition of a reply to the message. The recipient is
+// the Reply-To address (or the From when there is none), the subject gets a
+// "Re: " prefix when it has none, and In-Reply-To and References point to
+// the message, so the reply is threaded with it.
+func (m Message) Reply(opts ReplyOptions) *Builder {
+	b := &Builder{}
+
+	if len(m.ReplyTo) > 0 {
+		b.AddTo(m.ReplyTo...)
+	} else {
+		b.AddTo(m.From...)
+	}
+
+	subject := m.Subject
+	if !replySubjectR.MatchString(subject) {
+		subject = "Re: " + subject
+	}
+	b.SetSubject(subject)
+
+	// the references of the parent are its References, or its single
+	// In-Reply-To id when it has none (RFC5322 3.6.4)
+	refs := m.References
+	if len(refs) == 0 && len(m.InReply) == 1 {
+		refs = m.InReply
+	}
+
+	if m.MessageID != "" {
+		b.SetHeader("In-Reply-To", "<"+m.MessageID+">")
+		refs = append(append([]string{}, refs...), m.MessageID)
+	}
+
+	if len(refs) > 0 {
+		b.SetHeader("References", "<"+strings.Join(refs, "> <")+">")
+	}
+
+	if opts.Quote {
+		var quoted strings.Builder
+
+		quoted.WriteString("\n\n" + m.AttributionLine(opts.AttributionLayout) + "\n")
+		for _, l := range strings.Split(strings.TrimRight(strings.ReplaceAll(m.Text, "\r\n", "\n"), "\n"), "\n") {
+			if strings.HasPrefix(l, ">") {
+				quoted.WriteString(">" + l + "\n")
+			} else {
+				quoted.WriteString("> " + l + "\n")
+			}
+		}
+
+		b.SetText(quoted.String())
+	}
+
+	return b
+}
+
+// ReplyAllRecipients computes the recipients of a reply to all. The author
+// (the Reply-To addresses, or the From when there are none) goes to to, and
+// the other To and Cc recipients go to cc. Addresses are compared without
+// regard to case, so each mailbox is listed once, and the addresses of self
+// (the mailboxes of the user replying) are left out. When the user replies
+// to their own message, the original To recipients are used as to.
+func (m Message) ReplyAllRecipients(self []string) (to []Address, cc []Address) {
+	seen := make(map[string]bool)
+	for _, s := range self {
+		seen[strings.ToLower(strings.TrimSpace(s))] = true
+	}
+
+	// add the mailboxes of list not seen yet
+	add := func(dst []Address, list []Address) []Address {
+		for _, ma := range mailboxes(list) {
+			key := canonicalMailbox(ma).Email()
+			if ma.local == "" || seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			dst = append(dst, ma)
+		}
+		return dst
+	}
+
+	author := m.ReplyTo
+	if len(author) == 0 {
+		author = m.From
+	}
+
+	to = add(to, author)
+	if len(to) == 0 {
+		to = add(to, m.To)
+	}
+
+	// the author is not copied, even when replies go to the Reply-To
+	for _, ma := range mailboxes(m.From) {
+		seen[canonicalMailbox(ma).Email()] = true
+	}
+
+	cc = add(cc, m.To)
+	cc = add(cc, m.Cc)
+
+	return
+}
@@ -0,0 +1,210 @@
+package eml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parse the message of a header block and build a reply to it
+func buildReply(t *testing.T, headers string, opts ReplyOptions) Message {
+	t.Helper()
+
+	m, errs := Parse(crlf(headers + "\n\nhi\n> earlier\n"))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	r, err := m.Reply(opts).SetFrom(mustParseAddress(t, "me@example.com")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestReplySubject(t *testing.T) {
+	for _, c := range []struct{ subject, want string }{
+		{"Hello", "Re: Hello"},
+		{"Re: Hello", "Re: Hello"},
+		{"RE:Hello", "RE:Hello"},
+		{"re : Hello", "re : Hello"},
+		{"Fwd: Hello", "Re: Fwd: Hello"},
+		{"Report of Re: Hello", "Re: Report of Re: Hello"},
+		{"=?utf-8?q?Re=3A_caf=C3=A9?=", "Re: café"},
+	} {
+		r := buildReply(t, "From: alice@example.com\nSubject: "+c.subject, ReplyOptions{})
+		if r.Subject != c.want {
+			t.Errorf("reply to %q: subject %q, want %q", c.subject, r.Subject, c.want)
+		}
+	}
+}
+
+func TestReplyThreading(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		headers string
+		inReply []string
+		refs    []string
+	}{
+		{
+			"first reply",
+			"Message-ID: <a@example.com>",
+			[]string{"a@example.com"},
+			[]string{"a@example.com"},
+		},
+		{
+			"references chained",
+			"Message-ID: <c@example.com>\nIn-Reply-To: <b@example.com>\nReferences: <a@example.com> <b@example.com>",
+			[]string{"c@example.com"},
+			[]string{"a@example.com", "b@example.com", "c@example.com"},
+		},
+		{
+			"in-reply-to without references",
+			"Message-ID: <b@example.com>\nIn-Reply-To: <a@example.com>",
+			[]string{"b@example.com"},
+			[]string{"a@example.com", "b@example.com"},
+		},
+		{
+			"several in-reply-to ids",
+			"Message-ID: <c@example.com>\nIn-Reply-To: <a@example.com> <b@example.com>",
+			[]string{"c@example.com"},
+			[]string{"c@example.com"},
+		},
+		{
+			"no message-id",
+			"References: <a@example.com>",
+			nil,
+			[]string{"a@example.com"},
+		},
+	} {
+		r := buildReply(t, "From: alice@example.com\nSubject: x\n"+c.headers, ReplyOptions{})
+
+		if !reflect.DeepEqual(r.InReply, c.inReply) {
+			t.Errorf("%s: In-Reply-To %q, want %q", c.name, r.InReply, c.inReply)
+		}
+		if !reflect.DeepEqual(r.References, c.refs) {
+			t.Errorf("%s: References %q, want %q", c.name, r.References, c.refs)
+		}
+	}
+}
+
+func TestReplyRecipient(t *testing.T) {
+	for _, c := range []struct {
+		name, headers, want string
+	}{
+		{"from", "From: Alice <alice@example.com>", "alice@example.com"},
+		{"reply-to", "From: alice@example.com\nReply-To: list@example.com", "list@example.com"},
+	} {
+		r := buildReply(t, c.headers+"\nTo: me@example.com, bob@example.com\nCc: carol@example.com", ReplyOptions{})
+
+		if len(r.To) != 1 || r.To[0].Email() != c.want {
+			t.Errorf("%s: To %v, want %s", c.name, r.To, c.want)
+		}
+		if len(r.Cc) != 0 {
+			t.Errorf("%s: Cc %v", c.name, r.Cc)
+		}
+	}
+}
+
+func TestReplyQuote(t *testing.T) {
+	r := buildReply(t, "From: Alice <alice@example.com>\nDate: Mon, 2 Jan 2006 15:04:05 +0000", ReplyOptions{Quote: true})
+
+	want := "On Mon, Jan 2, 2006 at 15:04, Alice wrote:\n> hi\n>> earlier\n"
+	if got := strings.ReplaceAll(r.Text, "\r\n", "\n"); !strings.HasSuffix(got, want) {
+		t.Errorf("Text = %q, want suffix %q", got, want)
+	}
+
+	if r := buildReply(t, "From: alice@example.com", ReplyOptions{}); r.Text != "" {
+		t.Errorf("Text = %q without quoting", r.Text)
+	}
+}
+
+func TestAttributionLine(t *testing.T) {
+	date := "Date: Tue, 3 Feb 2009 08:05:00 -0500\n"
+
+	for _, c := range []struct {
+		name, headers, layout, want string
+	}{
+		{"display name", "From: \"Doe, Jane\" <jane@example.com>\n" + date, "", "On Tue, Feb 3, 2009 at 08:05, Doe, Jane wrote:"},
+		{"email only", "From: jane@example.com\n" + date, "", "On Tue, Feb 3, 2009 at 08:05, jane@example.com wrote:"},
+		{"encoded name", "From: =?utf-8?q?Zo=C3=AB?= <zoe@example.com>\n" + date, "", "On Tue, Feb 3, 2009 at 08:05, Zoë wrote:"},
+		{"sender", "Sender: Bot <bot@example.com>\n" + date, "", "On Tue, Feb 3, 2009 at 08:05, Bot wrote:"},
+		{"localized", "From: Jane <jane@example.com>\n" + date, "El 02/01/2006 a las 15:04, {from} escribió:", "El 03/02/2009 a las 08:05, Jane escribió:"},
+		{"offset kept", "From: Jane <jane@example.com>\n" + date, "2006-01-02 15:04 -0700 {from}", "2009-02-03 08:05 -0500 Jane"},
+	} {
+		m, errs := Parse(crlf(c.headers + "\nhi\n"))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if got := m.AttributionLine(c.layout); got != c.want {
+			t.Errorf("%s: %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestReplyAllRecipients(t *testing.T) {
+	emails := func(list []Address) (s []string) {
+		for _, a := range list {
+			s = append(s, a.(MailboxAddr).Email())
+		}
+		return
+	}
+
+	for _, c := range []struct {
+		name    string
+		headers string
+		self    []string
+		to, cc  []string
+	}{
+		{
+			"from",
+			"From: Alice <alice@example.com>\nTo: me@example.com, bob@example.com\nCc: Carol@Example.com",
+			[]string{"me@example.com"},
+			[]string{"alice@example.com"},
+			[]string{"bob@example.com", "Carol@Example.com"},
+		},
+		{
+			"reply-to with the author in cc",
+			"From: alice@example.com\nReply-To: list@example.com\nTo: me@example.com\nCc: alice@example.com, bob@example.com",
+			[]string{"me@example.com"},
+			[]string{"list@example.com"},
+			[]string{"bob@example.com"},
+		},
+		{
+			"self in another case",
+			"From: alice@example.com\nTo: Me@Example.COM, bob@example.com\nCc: me@example.com",
+			[]string{"me@example.com"},
+			[]string{"alice@example.com"},
+			[]string{"bob@example.com"},
+		},
+		{
+			"duplicates",
+			"From: alice@example.com\nTo: bob@example.com, Bob <BOB@example.com>\nCc: bob@example.com, alice@example.com",
+			[]string{"me@example.com"},
+			[]string{"alice@example.com"},
+			[]string{"bob@example.com"},
+		},
+		{
+			"own message",
+			"From: me@example.com\nTo: bob@example.com\nCc: carol@example.com",
+			[]string{"me@example.com"},
+			[]string{"bob@example.com"},
+			[]string{"carol@example.com"},
+		},
+	} {
+		m, errs := Parse(crlf(c.headers + "\n\nhi\n"))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		to, cc := m.ReplyAllRecipients(c.self)
+		if got := emails(to); !reflect.DeepEqual(got, c.to) {
+			t.Errorf("%s: to %q, want %q", c.name, got, c.to)
+		}
+		if got := emails(cc); !reflect.DeepEqual(got, c.cc) {
+			t.Errorf("%s: cc %q, want %q", c.name, got, c.cc)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Delivery status (DSN) and disposition (MDN) reports.
+
+package eml
+
+import (
+	"bytes"
+	"net/textproto"
+	"strings"
+)
+
+// get the first value of a field of a report part, written as a header
+// block (such as message/disposition-notification or text/rfc822-headers)
+func reportField(p Part, key string) (string, bool) {
+	data, _, err := decodeContentTransferEncoding(nil, p.Headers, &p.Data)
+	if err != nil {
+		data = p.Data
+	}
+
+	r, err := ParseRaw(data)
+	if err != nil {
+		return "", false
+	}
+
+	v := rawHeaderValue(r.RawHeaders, key)
+	if v == "" {
+		return "", false
+	}
+
+	return strings.Trim(strings.TrimSpace(v), "<>"), true
+}
+
+// OriginalMessageID returns the Message-ID of the message a report is
+// about: the Original-Message-ID field of a disposition notification
+// (MDN, RFC8098), or the Message-ID of the headers returned with a
+// delivery status notification (DSN, RFC3464). It lets the sender tie the
+// report to the message it sent.
+func (m Message) OriginalMessageID() (string, bool) {
+	for _, p := range m.Parts {
+		if strings.HasPrefix(strings.ToLower(p.Type), "message/disposition-notification") {
+			if id, ok := reportField(p, "Original-Message-ID"); ok {
+				return id, true
+			}
+		}
+	}
+
+	for _, p := range m.Parts {
+		switch t := strings.ToLower(p.Type); {
+		case strings.HasPrefix(t, "message/rfc822"), strings.HasPrefix(t, "text/rfc822-headers"):
+			if id, ok := reportField(p, "Message-ID"); ok {
+				return id, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// DSN is a delivery status notification (RFC3464), the report sent back
+// when a message could not be delivered, or was delayed or relayed
+type DSN struct {
+	ReportingMTA string         // MTA that wrote the report, without its type
+	Recipients   []DSNRecipient // one per recipient the report is about
+
+	// headers of the message the report is about, from the
+	// text/rfc822-headers or message/rfc822 part, keyed in canonical form.
+	// nil when it wasn't returned
+	OriginalHeaders map[string][]string
+}
+
+// DSNRecipient is the delivery status of a recipient of a DSN. The
+// addresses and the diagnostic are given without their type, such as
+// rfc822, dns or smtp.
+type DSNRecipient struct {
+	FinalRecipient    string
+	OriginalRecipient string // as given by the sender, when it differs
+	Action            string // failed, delayed, delivered, relayed or expanded, lowercased
+	Status            string // RFC3463 status code, such as 5.1.1
+	DiagnosticCode    string // such as "550 5.1.1 User unknown"
+	RemoteMTA         string // MTA that reported the failure
+}
+
+// get the value of a DSN field without its type, such as the rfc822 of
+// "rfc822; user@example.com"
+func dsnValue(hs []RawHeader, key string) string {
+	v := strings.TrimSpace(rawHeaderValue(hs, key))
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		v = strings.TrimSpace(v[i+1:])
+	}
+	return v
+}
+
+// read the field groups of a message/delivery-status part: the fields about
+// the message, then the fields of each recipient, separated by blank lines
+func dsnGroups(p Part) (groups [][]RawHeader) {
+	data, _, err := decodeContentTransferEncoding(nil, p.Headers, &p.Data)
+	if err != nil {
+		data = p.Data
+	}
+
+	for _, block := range bytes.Split(canonicalLineBreaks(data), []byte("\r\n\r\n")) {
+		if len(bytes.TrimSpace(block)) == 0 {
+			continue
+		}
+
+		r, err := ParseRaw(append(block, "\r\n\r\n"...))
+		if err != nil || len(r.RawHeaders) == 0 {
+			continue
+		}
+
+		groups = append(groups, r.RawHeaders)
+	}
+
+	return
+}
+
+// parse the delivery status of a report from its parts, nil when there is
+// no message/delivery-status part
+func parseDSN(parts []Part) *DSN {
+	mediaType := func(p Part) string {
+		return strings.ToLower(strings.TrimSpace(strings.Split(p.Type, ";")[0]))
+	}
+
+	var dsn *DSN
+	for _, p := range parts {
+		if t := mediaType(p); t != "message/delivery-status" && t != "message/global-delivery-status" {
+			continue
+		}
+
+		dsn = &DSN{}
+		groups := dsnGroups(p)
+		if len(groups) == 0 {
+			break
+		}
+
+		dsn.ReportingMTA = dsnValue(groups[0], "Reporting-MTA")
+		for _, g := range groups[1:] {
+			r := DSNRecipient{
+				FinalRecipient:    strings.Trim(dsnValue(g, "Final-Recipient"), "<>"),
+				OriginalRecipient: strings.Trim(dsnValue(g, "Original-Recipient"), "<>"),
+				Action:            strings.ToLower(dsnValue(g, "Action")),
+				DiagnosticCode:    dsnValue(g, "Diagnostic-Code"),
+				RemoteMTA:         dsnValue(g, "Remote-MTA"),
+			}
+
+			// the status may be followed by a comment, or be missing
+			if f := strings.Fields(dsnValue(g, "Status")); len(f) > 0 {
+				r.Status = f[0]
+			}
+
+			dsn.Recipients = append(dsn.Recipients, r)
+		}
+		break
+	}
+
+	if dsn == nil {
+		return nil
+	}
+
+	// the returned headers may come alone or with the whole message
+	for _, p := range parts {
+		switch mediaType(p) {
+		case "text/rfc822-headers", "message/rfc822-headers", "message/global-headers", "message/rfc822", "message/global":
+		default:
+			continue
+		}
+
+		data, _, err := decodeContentTransferEncoding(nil, p.Headers, &p.Data)
+		if err != nil {
+			data = p.Data
+		}
+
+		// a header block alone has no blank line to end it
+		r, err := ParseRaw(append(append([]byte{}, data...), "\r\n\r\n"...))
+		if err != nil {
+			continue
+		}
+
+		dsn.OriginalHeaders = make(map[string][]string)
+		for _, h := range r.RawHeaders {
+			k := textproto.CanonicalMIMEHeaderKey(string(h.Key))
+			dsn.OriginalHeaders[k] = append(dsn.OriginalHeaders[k], strings.TrimSpace(string(h.Value)))
+		}
+		break
+	}
+
+	return dsn
+}
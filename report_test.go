@@ -0,0 +1,198 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+// a Postfix bounce for two recipients, with the headers of the original
+// message returned
+const bounceMessage = `From: MAILER-DAEMON@mx.example.org (Mail Delivery System)
+To: sender@example.com
+Subject: Undelivered Mail Returned to Sender
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status;
+	boundary="3F2A1.1696240800/mx.example.org"
+
+--3F2A1.1696240800/mx.example.org
+Content-Type: text/plain; charset=us-ascii
+
+I'm sorry to have to inform you that your message could not
+be delivered to one or more recipients.
+
+--3F2A1.1696240800/mx.example.org
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.org
+X-Postfix-Queue-ID: 3F2A1
+Arrival-Date: Mon,  2 Oct 2023 10:00:00 +0000 (UTC)
+
+Final-Recipient: rfc822; bob@example.net
+Original-Recipient: rfc822;bob@example.net
+Action: failed
+Status: 5.1.1
+Remote-MTA: dns; mail.example.net
+Diagnostic-Code: smtp; 550 5.1.1 <bob@example.net>: Recipient address
+    rejected: User unknown
+
+Final-Recipient: rfc822; carol@example.net
+Action: delayed
+Status: 4.4.1 (connection timed out)
+Remote-MTA: dns; mail.example.net
+
+--3F2A1.1696240800/mx.example.org
+Content-Type: text/rfc822-headers
+
+From: sender@example.com
+To: bob@example.net, carol@example.net
+Message-ID: <abc@example.com>
+Subject: hi
+
+--3F2A1.1696240800/mx.example.org--
+`
+
+func crlf(s string) []byte {
+	return []byte(strings.ReplaceAll(s, "\n", "\r\n"))
+}
+
+func TestDeliveryStatus(t *testing.T) {
+	m, errs := Parse(crlf(bounceMessage))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	dsn := m.DeliveryStatus
+	if dsn == nil {
+		t.Fatal("no delivery status")
+	}
+
+	if dsn.ReportingMTA != "mx.example.org" {
+		t.Errorf("reporting MTA %q", dsn.ReportingMTA)
+	}
+
+	want := []DSNRecipient{
+		{
+			FinalRecipient:    "bob@example.net",
+			OriginalRecipient: "bob@example.net",
+			Action:            "failed",
+			Status:            "5.1.1",
+			DiagnosticCode:    "550 5.1.1 <bob@example.net>: Recipient address rejected: User unknown",
+			RemoteMTA:         "mail.example.net",
+		},
+		{
+			FinalRecipient: "carol@example.net",
+			Action:         "delayed",
+			Status:         "4.4.1",
+			RemoteMTA:      "mail.example.net",
+		},
+	}
+	if len(dsn.Recipients) != len(want) {
+		t.Fatalf("got %d recipients, want %d", len(dsn.Recipients), len(want))
+	}
+	for i, r := range dsn.Recipients {
+		if r != want[i] {
+			t.Errorf("recipient %d: got %+v, want %+v", i, r, want[i])
+		}
+	}
+
+	if got := dsn.OriginalHeaders["Message-Id"]; len(got) != 1 || got[0] != "<abc@example.com>" {
+		t.Errorf("original Message-ID %q", got)
+	}
+}
+
+func TestDeliveryStatusWithoutStatus(t *testing.T) {
+	raw := `Content-Type: multipart/report; report-type=delivery-status; boundary=b
+
+--b
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.org
+
+Final-Recipient: rfc822; bob@example.net
+Action: failed
+
+--b--
+`
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.DeliveryStatus == nil || len(m.DeliveryStatus.Recipients) != 1 {
+		t.Fatalf("delivery status %+v", m.DeliveryStatus)
+	}
+	if r := m.DeliveryStatus.Recipients[0]; r.FinalRecipient != "bob@example.net" || r.Status != "" {
+		t.Errorf("recipient %+v", r)
+	}
+}
+
+func TestNoDeliveryStatus(t *testing.T) {
+	m, _ := Parse(crlf("Subject: hi\n\nhello\n"))
+	if m.DeliveryStatus != nil {
+		t.Errorf("delivery status %+v", m.DeliveryStatus)
+	}
+}
+
+func TestOriginalMessageID(t *testing.T) {
+	mdn := `From: bob@example.net
+To: sender@example.com
+Subject: Read: hi
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=disposition-notification; boundary=r
+
+--r
+Content-Type: text/plain
+
+The message was displayed.
+--r
+Content-Type: message/disposition-notification
+
+Reporting-UA: mail.example.net; Webmail
+Final-Recipient: rfc822; bob@example.net
+Original-Message-ID: <mdn-original@example.com>
+Disposition: manual-action/MDN-sent-manually; displayed
+--r--
+`
+
+	returned := `From: MAILER-DAEMON@mx.example.org
+Content-Type: multipart/report; report-type=delivery-status; boundary=r
+
+--r
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.org
+
+Final-Recipient: rfc822; bob@example.net
+Action: failed
+Status: 5.1.1
+--r
+Content-Type: message/rfc822
+
+From: sender@example.com
+Message-ID: <returned@example.com>
+Subject: hi
+
+the whole message
+--r--
+`
+
+	for _, c := range []struct {
+		name, raw, want string
+	}{
+		{"dsn with headers", bounceMessage, "abc@example.com"},
+		{"dsn with the message", returned, "returned@example.com"},
+		{"mdn", mdn, "mdn-original@example.com"},
+		{"not a report", "From: a@example.com\nMessage-ID: <own@example.com>\n\nhi\n", ""},
+	} {
+		m, errs := Parse(crlf(c.raw))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		id, ok := m.OriginalMessageID()
+		if id != c.want || ok != (c.want != "") {
+			t.Errorf("%s: %q, %v, want %q", c.name, id, ok, c.want)
+		}
+	}
+}
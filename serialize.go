@@ -0,0 +1,270 @@
+// Serialization of parsed messages.
+
+package eml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// headers describing the body, written from the body being rendered
+// instead of the parsed values
+var bodyHeaders = map[string]bool{
+	"mime-version":              true,
+	"content-type":              true,
+	"content-transfer-encoding": true,
+	"content-disposition":       true,
+}
+
+// counts the bytes written, for WriteTo
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return
+}
+
+// WriteTo writes the message to w in the RFC5322 format. The headers are
+// taken from ParsedHeaders, so the ones added, changed or removed there are
+// written, kept in the order they were found in the message and followed
+// by the new ones. Non-ASCII values are RFC2047 encoded and long lines are
+// folded at 78 columns.
+//
+// The body of a parsed message is written as it was found, along with its
+// Content-Type and Content-Transfer-Encoding, so its MIME tree is kept
+// whole: every part, embedded messages, reports and signed parts included.
+// Changes to Text, Html, Inlines or Attachments are not written then. The
+// body of a message that was not parsed, such as a Message literal, is
+// built from them: a multipart/alternative when there are both texts,
+// within a multipart/mixed along with the base64 encoded attachments.
+func (m Message) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	// the tree is only known for the parsed messages
+	parsed := m.tree != nil
+
+	for _, h := range m.writtenHeaders(parsed) {
+		if err := writeRawHeader(cw, h[0], h[1]); err != nil {
+			return cw.n, err
+		}
+	}
+
+	var err error
+	if parsed {
+		err = m.writeParsedBody(cw)
+	} else {
+		err = m.writeBody(cw)
+	}
+
+	return cw.n, err
+}
+
+// Bytes returns the message in the RFC5322 format, as written by WriteTo
+func (m Message) Bytes() []byte {
+	var buf bytes.Buffer
+
+	// writes to a bytes.Buffer can't fail
+	m.WriteTo(&buf)
+
+	return buf.Bytes()
+}
+
+// list the headers to write: the values of ParsedHeaders in the order of
+// the parsed fields, then the values added to ParsedHeaders, by key. the
+// ones describing the body are left out, unless withBody is set
+func (m Message) writtenHeaders(withBody bool) (headers [][2]string) {
+	used := make(map[string]int)
+
+	for _, f := range m.fields {
+		vs := m.ParsedHeaders[f[0]]
+		if !withBody && bodyHeaders[strings.ToLower(f[0])] || used[f[0]] >= len(vs) {
+			continue
+		}
+
+		headers = append(headers, [2]string{f[0], vs[used[f[0]]]})
+		used[f[0]]++
+	}
+
+	keys := make([]string, 0, len(m.ParsedHeaders))
+	for k := range m.ParsedHeaders {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !withBody && bodyHeaders[strings.ToLower(k)] {
+			continue
+		}
+
+		for _, v := range m.ParsedHeaders[k][used[k]:] {
+			headers = append(headers, [2]string{k, v})
+		}
+	}
+
+	return
+}
+
+// write a header field as found in a message. the address lists are
+// rewritten from the parsed addresses, as the encoded-words of their
+// display names must not split a quoted-string. values that are not valid
+// UTF-8, such as raw 8-bit text in another charset, can't be RFC2047
+// encoded and are only folded, as are the addresses of a UTF-8 mailbox
+// (RFC6532)
+func writeRawHeader(w io.Writer, key, value string) error {
+	value = strings.TrimSpace(value)
+
+	if addressHeaders[strings.ToLower(key)] {
+		if al, err := parseAddressList(rawHeaderToUTF8([]byte(value), ParseOptions{})); err == nil && len(al) > 0 {
+			return writeAddressHeader(w, key, al)
+		}
+	}
+
+	if !utf8.ValidString(value) {
+		_, err := io.WriteString(w, foldHeader(key, value))
+		return err
+	}
+
+	return writeHeader(w, key, value)
+}
+
+// write the body of a parsed message as it was found, after the blank line
+// ending the headers
+func (m Message) writeParsedBody(w io.Writer) error {
+	if _, err := io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+
+	_, err := w.Write(m.Body)
+
+	return err
+}
+
+// write the body headers and the body, as described by WriteTo. the
+// multiparts are rendered in memory, their writes can't fail
+func (m Message) writeBody(w io.Writer) error {
+	if err := writeHeader(w, "MIME-Version", "1.0"); err != nil {
+		return err
+	}
+
+	th, tb := renderTexts(m.Text, m.Html)
+	if len(m.Attachments) == 0 && len(m.Inlines) == 0 {
+		return writeEntity(w, th, tb)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	if m.Text != "" || m.Html != "" {
+		pw, _ := mw.CreatePart(th)
+		pw.Write(tb)
+	}
+
+	for _, a := range m.Inlines {
+		h := attachmentHeader(a.Filename, a.MIMEType, "inline")
+		if a.ContentID != "" {
+			h.Set("Content-Id", "<"+a.ContentID+">")
+		}
+		writeBase64Part(mw, h, a.Data)
+	}
+
+	for _, a := range m.Attachments {
+		writeBase64Part(mw, attachmentHeader(a.Filename, a.MIMEType, "attachment"), a.Data)
+	}
+	mw.Close()
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+
+	return writeEntity(w, h, body.Bytes())
+}
+
+// write the Content-* headers of an entity and its body
+func writeEntity(w io.Writer, h textproto.MIMEHeader, body []byte) error {
+	for _, k := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if v := h.Get(k); v != "" {
+			if err := writeHeader(w, k, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+
+	_, err := w.Write(body)
+
+	return err
+}
+
+// render the texts of a message, quoted-printable encoded: a single
+// text/plain or text/html when there is only one of them, else a
+// multipart/alternative. writes to a bytes.Buffer can't fail
+func renderTexts(text, html string) (textproto.MIMEHeader, []byte) {
+	textHeader := func(ct string) textproto.MIMEHeader {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", ct+"; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		return h
+	}
+
+	if text == "" || html == "" {
+		if html != "" {
+			return textHeader("text/html"), EncodeQuotedPrintable([]byte(html))
+		}
+		return textHeader("text/plain"), EncodeQuotedPrintable([]byte(text))
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for _, t := range [][2]string{{"text/plain", text}, {"text/html", html}} {
+		pw, _ := mw.CreatePart(textHeader(t[0]))
+		pw.Write(EncodeQuotedPrintable([]byte(t[1])))
+	}
+	mw.Close()
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+
+	return h, body.Bytes()
+}
+
+// the headers of an attachment part, base64 encoded
+func attachmentHeader(filename, mimeType, disposition string) textproto.MIMEHeader {
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	ctParams, cdParams := map[string]string{}, map[string]string{}
+	if filename != "" {
+		ctParams["name"], cdParams["filename"] = filename, filename
+	}
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(mimeType, ctParams))
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, cdParams))
+	h.Set("Content-Transfer-Encoding", "base64")
+
+	return h
+}
+
+// write a part with its data base64 encoded in lines of 76 characters
+func writeBase64Part(mw *multipart.Writer, h textproto.MIMEHeader, data []byte) {
+	pw, _ := mw.CreatePart(h)
+
+	enc := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: pw})
+	enc.Write(data)
+	enc.Close()
+}
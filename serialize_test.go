@@ -0,0 +1,291 @@
+package eml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteToRoundTrip(t *testing.T) {
+	raw := "From: \"Müller, Hans\" <h@x.de>\n" +
+		"To: Zoë <zoe@example.com>, \"Doe, John\" <john@example.com>\n" +
+		"Cc: team: ann@example.com, bob@example.com;\n" +
+		"Subject: Grüße aus Köln\n" +
+		"Message-ID: <1@x.de>\n" +
+		"Content-Type: text/plain; charset=utf-8\n" +
+		"Content-Transfer-Encoding: 8bit\n\n" +
+		"Hallo!\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	out := m.Bytes()
+	if !isASCII(string(bytes.SplitN(out, []byte("\r\n\r\n"), 2)[0])) {
+		t.Errorf("non-ASCII headers written:\n%s", out)
+	}
+
+	r, errs := Parse(out)
+	if len(errs) > 0 {
+		t.Fatalf("%v, parsing:\n%s", errs, out)
+	}
+
+	addrs := func(list []Address) (s []string) {
+		for _, a := range list {
+			s = append(s, a.String())
+		}
+		return
+	}
+
+	for _, c := range []struct {
+		name      string
+		got, want []Address
+	}{
+		{"From", r.From, m.From},
+		{"To", r.To, m.To},
+		{"Cc", r.Cc, m.Cc},
+	} {
+		got, want := addrs(c.got), addrs(c.want)
+		if len(got) != len(want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, want)
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %q, want %q", c.name, got, want)
+			}
+		}
+	}
+
+	if name := r.From[0].Name(); name != "Müller, Hans" {
+		t.Errorf("From name %q", name)
+	}
+	if r.Subject != m.Subject {
+		t.Errorf("Subject %q, want %q", r.Subject, m.Subject)
+	}
+	if r.MessageID != m.MessageID {
+		t.Errorf("Message-ID %q, want %q", r.MessageID, m.MessageID)
+	}
+	if r.Text != m.Text {
+		t.Errorf("Text %q, want %q", r.Text, m.Text)
+	}
+}
+
+func TestWriteToKeepsStructure(t *testing.T) {
+	signed := "From: a@example.com\n" +
+		"Content-Type: multipart/signed; protocol=\"application/pgp-signature\"; micalg=pgp-sha256; boundary=out\n\n" +
+		"--out\nContent-Type: multipart/related; boundary=rel\n\n" +
+		"--rel\nContent-Type: text/html\n\n<img src=\"cid:logo\">\n" +
+		"--rel\nContent-Type: image/png\nContent-ID: <logo>\nContent-Transfer-Encoding: base64\n\niVBORw0K\n--rel--\n" +
+		"--out\nContent-Type: application/pgp-signature\n\nsignature\n--out--\n"
+
+	for _, c := range []struct {
+		name string
+		raw  string
+	}{
+		{"bounce", bounceMessage},
+		{"forward chain", forwardChainMessage},
+		{"nested", nestedMessage},
+		{"signed related", signed},
+	} {
+		m, errs := Parse(crlf(c.raw))
+		if len(errs) > 0 {
+			t.Fatalf("%s: %v", c.name, errs)
+		}
+		m.ParsedHeaders["X-Spam-Score"] = []string{"0.1"}
+
+		out := m.Bytes()
+		r, errs := Parse(out)
+		if len(errs) > 0 {
+			t.Fatalf("%s: %v, parsing:\n%s", c.name, errs, out)
+		}
+
+		if r.StructureFingerprint() != m.StructureFingerprint() {
+			t.Errorf("%s: structure changed:\n%s", c.name, out)
+		}
+		if len(r.Parts) != len(m.Parts) || len(r.Embedded) != len(m.Embedded) || len(r.Attachments) != len(m.Attachments) {
+			t.Errorf("%s: %d parts, %d embedded, %d attachments, want %d, %d, %d", c.name,
+				len(r.Parts), len(r.Embedded), len(r.Attachments), len(m.Parts), len(m.Embedded), len(m.Attachments))
+		}
+		for i := range m.Parts {
+			if i < len(r.Parts) && !bytes.Equal(r.Parts[i].Raw, m.Parts[i].Raw) {
+				t.Errorf("%s: part %d\n%q\nwant\n%q", c.name, i, r.Parts[i].Raw, m.Parts[i].Raw)
+			}
+		}
+		if !bytes.Equal(r.Body, m.Body) {
+			t.Errorf("%s: body changed", c.name)
+		}
+		if got := r.ParsedHeaders["X-Spam-Score"]; len(got) != 1 || got[0] != "0.1" {
+			t.Errorf("%s: X-Spam-Score %q", c.name, got)
+		}
+	}
+}
+
+func TestWriteToComposed(t *testing.T) {
+	m := Message{
+		ParsedHeaders: map[string][]string{"Subject": {"composed"}},
+		Text:          "plain",
+		Html:          "<p>html</p>",
+		Attachments:   []Attachment{{Filename: "a.bin", MIMEType: "application/octet-stream", Data: []byte{0, 1, 2}}},
+	}
+
+	r, errs := Parse(m.Bytes())
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if r.Subject != "composed" || r.Text != "plain" || r.Html != "<p>html</p>" {
+		t.Errorf("Subject %q, Text %q, Html %q", r.Subject, r.Text, r.Html)
+	}
+	if len(r.Attachments) != 1 || r.Attachments[0].Filename != "a.bin" || !bytes.Equal(r.Attachments[0].Data, []byte{0, 1, 2}) {
+		t.Errorf("Attachments %+v", r.Attachments)
+	}
+}
+
+// check that a folded field has lines of up to 78 characters, but for
+// the ones holding a single longer token, and return its unfolded value
+func checkFolded(t *testing.T, field string) string {
+	t.Helper()
+
+	if !strings.HasSuffix(field, "\r\n") {
+		t.Errorf("field not ended by CRLF: %q", field)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(field, "\r\n"), "\r\n")
+	for i, l := range lines {
+		if i > 0 && (l == "" || !isWSP(l[0])) {
+			t.Errorf("line %d does not start with whitespace: %q", i, l)
+		}
+		if len(l) > maxLineLength && len(strings.Fields(l)) > 1 {
+			t.Errorf("line %d of %d characters: %q", i, len(l), l)
+		}
+	}
+
+	_, v, _ := strings.Cut(strings.Join(lines, ""), ":")
+	return strings.TrimPrefix(v, " ")
+}
+
+func TestFoldReferences(t *testing.T) {
+	ids := make([]string, 50)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("<%d.%x@mail.example.com>", i, i*7919)
+	}
+	value := strings.Join(ids, " ")
+
+	field := foldHeader("References", value)
+	if got := checkFolded(t, field); got != value {
+		t.Errorf("unfolded to %q", got)
+	}
+
+	// the folds are only before an id
+	for _, l := range strings.Split(strings.TrimSuffix(field, "\r\n"), "\r\n")[1:] {
+		if !strings.HasPrefix(l, " <") || !strings.HasSuffix(l, ">") {
+			t.Errorf("fold inside an id: %q", l)
+		}
+	}
+	if n := strings.Count(field, "\r\n"); n < 10 {
+		t.Errorf("%d lines for 50 ids", n)
+	}
+}
+
+func TestFoldLongToken(t *testing.T) {
+	token := strings.Repeat("x", 120)
+	value := "short " + token + " tail"
+
+	field := foldHeader("X-Token", value)
+	if got := checkFolded(t, field); got != value {
+		t.Errorf("unfolded to %q", got)
+	}
+	if !strings.Contains(field, "\r\n "+token+"\r\n") {
+		t.Errorf("long token not on its own line:\n%s", field)
+	}
+
+	// a value of a single token is not folded at all
+	if field := foldHeader("X-Token", token); strings.Count(field, "\r\n") != 1 {
+		t.Errorf("single token folded:\n%s", field)
+	}
+}
+
+func TestFoldAddresses(t *testing.T) {
+	value := `"Doe, John Jacob Jingleheimer" <john.jacob.jingleheimer.doe@example.com>, ` +
+		`"Smith, Ann Marie" <ann.marie.smith@example.com>, bob@example.com, ` +
+		`Carol Christine Carter <carol.christine.carter@example.com>`
+
+	field := foldHeader("To", value)
+	if got := checkFolded(t, field); got != value {
+		t.Errorf("unfolded to %q", got)
+	}
+
+	al, err := parseAddressList([]byte(checkFolded(t, field)))
+	if err != nil || len(al) != 4 {
+		t.Fatalf("%v, %d addresses", err, len(al))
+	}
+	for _, l := range strings.Split(field, "\r\n") {
+		if strings.Count(l, "<") != strings.Count(l, ">") || strings.Count(l, `"`)%2 != 0 {
+			t.Errorf("fold inside an address or a quoted string: %q", l)
+		}
+	}
+}
+
+func TestFoldEncodedWords(t *testing.T) {
+	subject := strings.Repeat("Grüße aus Köln und Düsseldorf, ", 5) + "bis bald"
+
+	var b bytes.Buffer
+	if err := writeHeader(&b, "Subject", subject); err != nil {
+		t.Fatal(err)
+	}
+	field := b.String()
+	checkFolded(t, field)
+
+	// every encoded-word is whole on its line
+	for _, l := range strings.Split(strings.TrimSuffix(field, "\r\n"), "\r\n") {
+		if strings.Count(l, "=?") != strings.Count(l, "?=") {
+			t.Errorf("encoded-word split: %q", l)
+		}
+		if len(l) > maxLineLength {
+			t.Errorf("line of %d characters: %q", len(l), l)
+		}
+	}
+
+	m, errs := Parse([]byte(field + "\r\nbody"))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if m.Subject != subject {
+		t.Errorf("Subject %q, want %q", m.Subject, subject)
+	}
+}
+
+func TestEncodeQuotedPrintable(t *testing.T) {
+	for _, in := range []string{
+		"hello\r\n",
+		"café, naïve, Größe\r\n",
+		"trailing space \r\ntrailing tab\t\r\nend ",
+		strings.Repeat("a long line without breaks ", 20) + "\r\n",
+		strings.Repeat("é", 100),
+		"a=b, 100% =?utf-8?q?x?=\r\n",
+	} {
+		enc := EncodeQuotedPrintable([]byte(in))
+
+		for _, l := range strings.Split(string(enc), "\r\n") {
+			if len(l) > 76 {
+				t.Errorf("%q: line of %d characters: %q", in, len(l), l)
+			}
+			if strings.TrimRight(l, " \t") != l {
+				t.Errorf("%q: line with trailing whitespace: %q", in, l)
+			}
+		}
+
+		headers := map[string][]string{"Content-Transfer-Encoding": {"quoted-printable"}}
+		dec, _, err := decodeContentTransferEncoding(nil, headers, &enc)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		if string(dec) != in {
+			t.Errorf("round trip of %q = %q", in, dec)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Signed and encrypted multiparts.
+
+package eml
+
+import (
+	"strings"
+)
+
+// SignedPart is a multipart/signed entity (RFC1847), as used by S/MIME and
+// PGP/MIME: the signed content and the signature covering it. Nothing is
+// verified, the pieces are given as found to a cryptographic library.
+type SignedPart struct {
+	Protocol string // media type of the signature, the protocol parameter
+	Micalg   string // hash algorithm of the signature, such as sha-256 or pgp-sha256
+
+	// the first part, whose Raw holds the exact bytes the signature was
+	// computed over: its headers, the blank line and its body, without the
+	// line break belonging to the boundary delimiter
+	Content Part
+
+	// the part of the Protocol type holding the signature, with its transfer
+	// encoding decoded in Data. a zero Part when missing
+	Signature Part
+}
+
+// EncryptedPart is a multipart/encrypted entity (RFC1847), as used by
+// PGP/MIME: the control information and the encrypted data
+type EncryptedPart struct {
+	Protocol string // media type of the control part, the protocol parameter
+	Control  Part   // first part, such as application/pgp-encrypted
+	Content  Part   // second part, the encrypted data, usually application/octet-stream
+}
+
+// get the data of a part from its raw bytes, with only its transfer
+// encoding decoded. nil when it can't be read
+func rawPartData(p Part) []byte {
+	r, err := ParseRaw(p.Raw)
+	if err != nil {
+		return nil
+	}
+
+	data, _, err := decodeContentTransferEncoding(nil, p.Headers, &r.Body)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// walk the MIME tree, calling f with each multipart of type mt and its
+// parameters
+func (m Message) findMultiparts(mt string, f func(n *MIMENode)) {
+	m.WalkMIME(func(n *MIMENode, depth int) error {
+		if !n.leaf && n.Type == mt && len(n.Children) > 0 {
+			f(n)
+		}
+		return nil
+	})
+}
+
+// SignedParts returns the multipart/signed entities of the message, in the
+// order they are found in the MIME tree, the outermost first. A message
+// with none is not signed with S/MIME or PGP/MIME, although an S/MIME
+// message may still be signed as a whole with application/pkcs7-mime.
+func (m Message) SignedParts() (signed []SignedPart) {
+	m.findMultiparts("multipart/signed", func(n *MIMENode) {
+		s := SignedPart{
+			Protocol: strings.ToLower(n.Params["protocol"]),
+			Micalg:   strings.ToLower(n.Params["micalg"]),
+			Content:  n.Children[0].Part,
+		}
+
+		// the signature is the second part, but some signers add parts
+		// after it, so it is found by its type when there are more
+		for _, c := range n.Children[1:] {
+			if strings.EqualFold(c.Type, s.Protocol) || len(n.Children) == 2 {
+				s.Signature = c.Part
+				s.Signature.Data = rawPartData(c.Part)
+				break
+			}
+		}
+
+		signed = append(signed, s)
+	})
+
+	return
+}
+
+// EncryptedParts returns the multipart/encrypted entities of the message,
+// in the order they are found in the MIME tree. A message with none is not
+// encrypted with PGP/MIME, although an S/MIME message may still be
+// encrypted as a whole with application/pkcs7-mime.
+func (m Message) EncryptedParts() (encrypted []EncryptedPart) {
+	m.findMultiparts("multipart/encrypted", func(n *MIMENode) {
+		e := EncryptedPart{Protocol: strings.ToLower(n.Params["protocol"])}
+		if len(n.Children) > 0 {
+			e.Control = n.Children[0].Part
+			e.Control.Data = rawPartData(n.Children[0].Part)
+		}
+		if len(n.Children) > 1 {
+			e.Content = n.Children[1].Part
+			e.Content.Data = rawPartData(n.Children[1].Part)
+		}
+
+		encrypted = append(encrypted, e)
+	})
+
+	return
+}
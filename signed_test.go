@@ -0,0 +1,81 @@
+package eml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSignedParts(t *testing.T) {
+	// the signed content keeps its trailing whitespace, which a
+	// signature covers
+	content := "Content-Type: multipart/mixed; boundary=\"in\"\r\n\r\n" +
+		"--in\r\nContent-Type: text/plain\r\n\r\nhello  \r\n" +
+		"--in\r\nContent-Type: text/plain; name=a.txt\r\nContent-Disposition: attachment\r\n\r\nfile\r\n--in--\r\n"
+	raw := "From: a@example.com\r\n" +
+		"Content-Type: multipart/signed; protocol=\"application/pgp-signature\"; micalg=pgp-SHA256; boundary=\"out\"\r\n\r\n" +
+		"--out\r\n" + content + "\r\n" +
+		"--out\r\nContent-Type: application/pgp-signature\r\nContent-Transfer-Encoding: base64\r\n\r\nc2lnbmF0dXJl\r\n" +
+		"--out--\r\n"
+
+	m, errs := Parse([]byte(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	s := m.SignedParts()
+	if len(s) != 1 {
+		t.Fatalf("%d signed parts", len(s))
+	}
+
+	if !bytes.Equal(s[0].Content.Raw, []byte(content)) {
+		t.Errorf("signed content\n%q\nwant\n%q", s[0].Content.Raw, content)
+	}
+	if s[0].Content.Type != "multipart/mixed" {
+		t.Errorf("content type %q", s[0].Content.Type)
+	}
+	if s[0].Protocol != "application/pgp-signature" || s[0].Micalg != "pgp-sha256" {
+		t.Errorf("protocol %q, micalg %q", s[0].Protocol, s[0].Micalg)
+	}
+	if s[0].Signature.Type != "application/pgp-signature" || string(s[0].Signature.Data) != "signature" {
+		t.Errorf("signature %q: %q", s[0].Signature.Type, s[0].Signature.Data)
+	}
+
+	if m.Text != "hello  " {
+		t.Errorf("Text %q", m.Text)
+	}
+	if len(m.EncryptedParts()) != 0 {
+		t.Errorf("encrypted parts %+v", m.EncryptedParts())
+	}
+}
+
+func TestEncryptedParts(t *testing.T) {
+	raw := `Content-Type: multipart/encrypted; protocol="application/pgp-encrypted"; boundary=x
+
+--x
+Content-Type: application/pgp-encrypted
+
+Version: 1
+--x
+Content-Type: application/octet-stream
+
+-----BEGIN PGP MESSAGE-----
+--x--
+`
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	e := m.EncryptedParts()
+	if len(e) != 1 {
+		t.Fatalf("%d encrypted parts", len(e))
+	}
+	if e[0].Protocol != "application/pgp-encrypted" || string(e[0].Control.Data) != "Version: 1" {
+		t.Errorf("control %q: %q", e[0].Protocol, e[0].Control.Data)
+	}
+	if !strings.HasPrefix(string(e[0].Content.Data), "-----BEGIN PGP MESSAGE") {
+		t.Errorf("content %q", e[0].Content.Data)
+	}
+}
@@ -0,0 +1,292 @@
+// MIME structure of a message.
+
+package eml
+
+import (
+	"bytes"
+	"mime"
+	"net/textproto"
+	"strings"
+)
+
+// PartNode is an entity of the MIME tree of a message, as it appears in the
+// source: nothing is decoded, neither the charsets nor the transfer
+// encodings.
+type PartNode struct {
+	Type     string      // media type, lowercased
+	Headers  []RawHeader // headers of the entity, unfolded
+	Body     []byte      // body of the entity, still transfer encoded
+	Children []*PartNode // parts of a multipart, in order
+}
+
+// ParseStructure parses the MIME tree of a message without decoding it.
+// The Body of every node is a slice of data, so the exact bytes of each
+// part can be located in the source. The tree is the one Parse builds: when
+// the body can't be parsed as MIME, the error is returned along with a tree
+// made of the message alone.
+func ParseStructure(data []byte) (*PartNode, error) {
+	r, err := ParseRaw(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ct := rawHeaderValue(r.RawHeaders, "Content-Type")
+	if strings.TrimSpace(ct) == "" {
+		return bodyNode("", r.Body, nil).partNode(r.RawHeaders, r.Body), nil
+	}
+
+	tree, parts, _, err := parseBody(ct, r.Body, textproto.MIMEHeader{})
+	if err != nil {
+		return bodyNode(ct, r.Body, nil).partNode(r.RawHeaders, r.Body), err
+	}
+
+	next := 0
+	tree.fillLeaves(parts, &next)
+
+	return tree.partNode(r.RawHeaders, r.Body), nil
+}
+
+// MIMENode is an entity of the MIME tree of a parsed message. The Part of
+// a leaf is the one of Parts, while a multipart gets its media type,
+// parameters, headers and exact bytes, with its raw body as Data. The root
+// node is the message itself.
+type MIMENode struct {
+	Part
+	Children []*MIMENode // parts of a multipart, in order
+
+	leaf bool // stands for an entry of Parts
+}
+
+// set the parts of the leaves of a tree built by parseBody, which stand
+// for them in the same order. the leaves of the parts dropped after the
+// parse are removed, returning false for such a leaf
+func (n *MIMENode) fillLeaves(parts []Part, next *int) bool {
+	if n.leaf {
+		if *next >= len(parts) {
+			return false
+		}
+		n.Part = parts[*next]
+		*next++
+		return true
+	}
+
+	children := n.Children[:0]
+	for _, c := range n.Children {
+		if c.fillLeaves(parts, next) {
+			children = append(children, c)
+		}
+	}
+	n.Children = children
+
+	return true
+}
+
+// get the root of the tree of a message whose body is not parsed as MIME,
+// for lack of a Content-Type or because it is malformed: the body as a
+// whole, of the declared media type or else text/plain
+func bodyNode(ct string, body []byte, headers map[string][]string) *MIMENode {
+	mt := strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
+	if mt == "" {
+		mt = "text/plain"
+	}
+
+	return &MIMENode{Part: Part{Type: mt, Data: body, Headers: headers}}
+}
+
+// convert a tree to its undecoded form, the node itself having the given
+// headers and body. the ones of the parts are read back from their Raw
+func (n *MIMENode) partNode(headers []RawHeader, body []byte) *PartNode {
+	node := &PartNode{
+		Type:    strings.ToLower(strings.TrimSpace(strings.Split(n.Type, ";")[0])),
+		Headers: headers,
+		Body:    body,
+	}
+
+	for _, c := range n.Children {
+		r, err := ParseRaw(c.Raw)
+		if err != nil {
+			// no header section at all, the whole part is the body
+			r = RawMessage{Body: c.Raw}
+		}
+
+		node.Children = append(node.Children, c.partNode(r.RawHeaders, r.Body))
+	}
+
+	return node
+}
+
+// get the MIME tree of the message in its undecoded form, as ParseStructure
+// would return it
+func (m Message) structure() *PartNode {
+	tree := m.tree
+	if tree == nil {
+		tree = bodyNode(m.ContentType, m.Body, m.ParsedHeaders)
+	}
+
+	headers := make([]RawHeader, len(m.fields))
+	for i, f := range m.fields {
+		headers[i] = RawHeader{[]byte(f[0]), []byte(f[1])}
+	}
+
+	return tree.partNode(headers, m.Body)
+}
+
+// WalkMIME calls f for each entity of the MIME tree of the message, in
+// depth-first order: the message itself at depth 0, then its parts at depth
+// 1, the parts of those at depth 2 and so on. The walk stops at the first
+// error returned by f, which is returned. Unlike Parts, the multiparts are
+// visited too, so the nesting of the parts can be told. The tree is built
+// when the message is parsed: a message whose body couldn't be parsed, or
+// that has no Content-Type, is a tree of its root alone.
+func (m Message) WalkMIME(f func(node *MIMENode, depth int) error) error {
+	var walk func(n *MIMENode, depth int) error
+	walk = func(n *MIMENode, depth int) error {
+		if err := f(n, depth); err != nil {
+			return err
+		}
+
+		for _, c := range n.Children {
+			if err := walk(c, depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if m.tree == nil {
+		return nil
+	}
+
+	return walk(m.tree, 0)
+}
+
+// get the first value of a raw header, ignoring the case of the key
+func rawHeaderValue(hs []RawHeader, key string) string {
+	for _, h := range hs {
+		if strings.EqualFold(string(h.Key), key) {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
+
+// split the body of a multipart into its parts, as slices of body, along
+// with the text found before the first delimiter (the preamble) and after
+// the close delimiter (the epilogue). the line break preceding a delimiter
+// belongs to the delimiter, as stated by RFC2046, and a part left open by a
+// missing close delimiter runs to the end of the body
+func splitMultipart(body []byte, boundary string) (preamble []byte, parts [][]byte, epilogue []byte) {
+	delim := []byte("--" + boundary)
+	start := -1
+
+	// cut the line break preceding the delimiter at i
+	cut := func(from, i int) []byte {
+		e := i
+		if e > from && body[e-1] == '\n' {
+			e--
+		}
+		if e > from && body[e-1] == '\r' {
+			e--
+		}
+		return body[from:e]
+	}
+
+	for i := 0; i < len(body); {
+		end := len(body)
+		if n := bytes.IndexByte(body[i:], '\n'); n >= 0 {
+			end = i + n + 1
+		}
+
+		line := body[i:end]
+		if bytes.HasPrefix(line, delim) {
+			rest := bytes.TrimRight(line[len(delim):], " \t\r\n")
+			if len(rest) == 0 || string(rest) == "--" {
+				if start >= 0 {
+					parts = append(parts, cut(start, i))
+				} else {
+					preamble = cut(0, i)
+				}
+
+				if len(rest) > 0 {
+					return preamble, parts, body[end:]
+				}
+				start = end
+			}
+		}
+
+		i = end
+	}
+
+	if start >= 0 {
+		parts = append(parts, body[start:])
+	}
+
+	return
+}
+
+// get the text around the parts of the top-level multipart, converted to
+// UTF-8 when it isn't
+func (m Message) multipartText(epilogue bool) string {
+	ct := ""
+	if v := m.header("Content-Type"); len(v) > 0 {
+		ct = v[0]
+	}
+
+	mt, ps, err := mime.ParseMediaType(ct)
+	if err != nil || !strings.HasPrefix(mt, "multipart/") || ps["boundary"] == "" {
+		return ""
+	}
+
+	pre, _, epi := splitMultipart(m.Body, ps["boundary"])
+	if epilogue {
+		pre = epi
+	}
+
+	return strings.TrimSpace(string(rawHeaderToUTF8(pre, ParseOptions{})))
+}
+
+// Preamble returns the text found before the first part of the multipart
+// body, usually a notice such as "This is a multi-part message in MIME
+// format", which mail clients hide. It is empty when there is none or when
+// the message is not a multipart.
+func (m Message) Preamble() string {
+	return m.multipartText(false)
+}
+
+// Epilogue returns the text found after the end of the multipart body,
+// empty when there is none or when the message is not a multipart.
+func (m Message) Epilogue() string {
+	return m.multipartText(true)
+}
+
+// write the tree in its canonical notation, such as
+// mixed(alternative(plain,html),image/png). multiparts and texts are
+// named by their subtype, the other types by the full media type
+func (n *PartNode) String() string {
+	name := n.Type
+	if strings.HasPrefix(name, "multipart/") || strings.HasPrefix(name, "text/") {
+		name = name[strings.Index(name, "/")+1:]
+	}
+
+	if !strings.HasPrefix(n.Type, "multipart/") {
+		return name
+	}
+
+	children := make([]string, len(n.Children))
+	for i, c := range n.Children {
+		children[i] = c.String()
+	}
+
+	return name + "(" + strings.Join(children, ",") + ")"
+}
+
+// StructureFingerprint returns a hash of the MIME structure of the message,
+// the tree of its content types written as mixed(alternative(plain,html),
+// application/pdf). Messages built by the same generator share the same
+// fingerprint regardless of their contents, which helps to cluster
+// campaigns.
+func (m Message) StructureFingerprint() string {
+	return sha256Hex([]byte(m.structure().String()))
+}
@@ -0,0 +1,295 @@
+package eml
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const nestedMessage = `From: a@example.com
+Content-Type: multipart/mixed; boundary=outer
+
+preamble
+--outer
+Content-Type: multipart/alternative; boundary=inner
+
+--inner
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+caf=E9
+--inner
+Content-Type: text/html; charset=utf-8
+
+<p>café</p>
+--inner--
+
+--outer
+Content-Type: application/pdf
+Content-Disposition: attachment; filename=a.pdf
+Content-Transfer-Encoding: base64
+
+JVBERi0xLjQ=
+--outer--
+`
+
+func TestWalkMIME(t *testing.T) {
+	m, errs := Parse(crlf(nestedMessage))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	var lines []string
+	var leaves []Part
+	err := m.WalkMIME(func(n *MIMENode, depth int) error {
+		lines = append(lines, fmt.Sprintf("%s%s", strings.Repeat("  ", depth), n.Type))
+		if len(n.Children) == 0 {
+			leaves = append(leaves, n.Part)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"multipart/mixed",
+		"  multipart/alternative",
+		"    text/plain",
+		"    text/html",
+		"  application/pdf",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("tree\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+
+	// the leaves are the parts, as decoded
+	if !reflect.DeepEqual(leaves, m.Parts) {
+		t.Errorf("leaves %+v\nparts %+v", leaves, m.Parts)
+	}
+	if string(leaves[0].Data) != "café" || leaves[0].DecodedCharset != "iso-8859-1" {
+		t.Errorf("text leaf %q decoded from %q", leaves[0].Data, leaves[0].DecodedCharset)
+	}
+}
+
+func TestWalkMIMEStop(t *testing.T) {
+	m, _ := Parse(crlf(nestedMessage))
+
+	stop := fmt.Errorf("stop")
+	visited := 0
+	err := m.WalkMIME(func(n *MIMENode, depth int) error {
+		visited++
+		if depth == 2 {
+			return stop
+		}
+		return nil
+	})
+
+	if err != stop || visited != 3 {
+		t.Errorf("error %v after %d nodes", err, visited)
+	}
+}
+
+func TestPartRaw(t *testing.T) {
+	data := crlf(nestedMessage)
+	m, errs := Parse(data)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// the raw parts joined with the delimiters give the body back
+	inner := "--inner\r\n" + string(m.Parts[0].Raw) + "\r\n--inner\r\n" + string(m.Parts[1].Raw) + "\r\n--inner--\r\n"
+	body := "preamble\r\n--outer\r\nContent-Type: multipart/alternative; boundary=inner\r\n\r\n" + inner +
+		"\r\n--outer\r\n" + string(m.Parts[2].Raw) + "\r\n--outer--\r\n"
+	if body != string(m.Body) {
+		t.Errorf("joined raw parts\n%q\nwant\n%q", body, m.Body)
+	}
+
+	for i, p := range m.Parts {
+		if !bytes.Contains(data, p.Raw) || !bytes.HasPrefix(p.Raw, []byte("Content-Type: ")) {
+			t.Errorf("part %d raw %q", i, p.Raw)
+		}
+	}
+}
+
+// the types of the MIME tree of a parsed message, as a PartNode
+func typeTree(n *MIMENode) *PartNode {
+	p := &PartNode{Type: strings.ToLower(strings.TrimSpace(strings.Split(n.Type, ";")[0]))}
+	for _, c := range n.Children {
+		p.Children = append(p.Children, typeTree(c))
+	}
+	return p
+}
+
+func TestParseStructureRaw(t *testing.T) {
+	raw := crlf("Subject: =?utf-8?q?caf=C3=A9?=\n" + nestedMessage)
+
+	tree, err := ParseStructure(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nodes []*PartNode
+	var walk func(n *PartNode)
+	walk = func(n *PartNode) {
+		nodes = append(nodes, n)
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(tree)
+
+	bodies := []string{
+		"", // the whole body, checked below
+		"", // the alternative, checked below
+		"caf=E9",
+		"<p>café</p>",
+		"JVBERi0xLjQ=",
+	}
+	if len(nodes) != len(bodies) {
+		t.Fatalf("%d nodes, want %d", len(nodes), len(bodies))
+	}
+
+	if got := string(tree.Body); !strings.HasPrefix(got, "preamble\r\n--outer\r\n") || !strings.HasSuffix(got, "--outer--\r\n") {
+		t.Errorf("root body %q", got)
+	}
+	if got := string(nodes[1].Body); !strings.HasPrefix(got, "--inner\r\n") || !strings.HasSuffix(got, "--inner--\r\n") {
+		t.Errorf("alternative body %q", got)
+	}
+	for i, want := range bodies {
+		if want != "" && string(nodes[i].Body) != want {
+			t.Errorf("%s body %q, want %q", nodes[i].Type, nodes[i].Body, want)
+		}
+	}
+
+	// the headers are unfolded but not decoded
+	if h := tree.Headers[0]; string(h.Key) != "Subject" || string(h.Value) != "=?utf-8?q?caf=C3=A9?=" {
+		t.Errorf("root header %q: %q", h.Key, h.Value)
+	}
+
+	// every body is a slice of the input, not a copy
+	for _, n := range nodes {
+		off := cap(raw) - cap(n.Body)
+		if off < 0 || off+len(n.Body) > len(raw) || !bytes.Equal(raw[off:off+len(n.Body)], n.Body) {
+			t.Errorf("%s body is not a slice of the input", n.Type)
+			continue
+		}
+
+		raw[off] ^= 0xff
+		if n.Body[0] != raw[off] {
+			t.Errorf("%s body is a copy of the input", n.Type)
+		}
+		raw[off] ^= 0xff
+	}
+}
+
+func TestStructureAgrees(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		raw  string
+		want string
+		err  bool
+	}{
+		{"nested", nestedMessage, "mixed(alternative(plain,html),application/pdf)", false},
+		{"no Content-Type", "From: a@example.com\n\nhello\n", "plain", false},
+		{"single part", "Content-Type: image/png\n\nPNG\n", "image/png", false},
+		{
+			"digest",
+			"Content-Type: multipart/digest; boundary=d\n\n--d\n\nSubject: one\n\nfirst\n--d\nContent-Type: text/plain\n\nsecond\n--d--\n",
+			"digest(message/rfc822,plain)", false,
+		},
+		{
+			"empty part Content-Type",
+			"Content-Type: multipart/mixed; boundary=b\n\n--b\nContent-Type:\n\nhello\n--b--\n",
+			"mixed(plain)", false,
+		},
+		{
+			"unparsable part Content-Type",
+			"Content-Type: multipart/mixed; boundary=b\n\n--b\nContent-Type: Text/Plain; =broken\n\nhello\n--b--\n",
+			"mixed(plain)", false,
+		},
+		{"multipart without boundary", "Content-Type: multipart/mixed\n\nhello\n", "mixed()", true},
+		{
+			"nested multipart without boundary",
+			"Content-Type: multipart/mixed; boundary=b\n\n--b\nContent-Type: multipart/alternative\n\nhello\n--b--\n",
+			"mixed()", true,
+		},
+		{"bad media type", "Content-Type: text/plain; =broken\n\nhello\n", "plain", true},
+	} {
+		raw := crlf(c.raw)
+
+		m, errs := Parse(raw)
+		if (len(errs) > 0) != c.err {
+			t.Errorf("%s: parse errors %v", c.name, errs)
+		}
+
+		tree, err := ParseStructure(raw)
+		if (err != nil) != c.err {
+			t.Errorf("%s: ParseStructure error %v", c.name, err)
+		}
+
+		got := tree.String()
+		if got != c.want {
+			t.Errorf("%s: ParseStructure %s, want %s", c.name, got, c.want)
+		}
+		if walked := typeTree(m.tree).String(); walked != got {
+			t.Errorf("%s: WalkMIME tree %s, ParseStructure %s", c.name, walked, got)
+		}
+		if fp := m.StructureFingerprint(); fp != sha256Hex([]byte(tree.String())) {
+			t.Errorf("%s: fingerprint of another tree than %s", c.name, tree)
+		}
+
+		// one line per entity in the dump
+		debug := m.Debug()
+		structure := debug[strings.Index(debug, "Structure:\n")+len("Structure:\n"):]
+		if i := strings.Index(structure, "Attachments:"); i >= 0 {
+			structure = structure[:i]
+		}
+		if n := strings.Count(got, ",") + strings.Count(strings.ReplaceAll(got, "()", ""), "(") + 1; strings.Count(structure, " bytes)\n") != n {
+			t.Errorf("%s: Debug structure\n%s\nwant %d entities", c.name, structure, n)
+		}
+	}
+}
+
+func TestPreambleEpilogue(t *testing.T) {
+	for _, c := range []struct {
+		name, raw          string
+		preamble, epilogue string
+	}{
+		{
+			"both",
+			"Content-Type: multipart/mixed; boundary=b\n\n" +
+				"This is a multi-part message in MIME format.\n\n" +
+				"--b\nContent-Type: text/plain\n\nhello\n--b--\n" +
+				"trailing notes\nsecond line\n",
+			"This is a multi-part message in MIME format.",
+			"trailing notes\r\nsecond line",
+		},
+		{
+			"none",
+			"Content-Type: multipart/mixed; boundary=b\n\n--b\nContent-Type: text/plain\n\nhello\n--b--\n",
+			"", "",
+		},
+		{
+			"latin-1 preamble",
+			"Content-Type: multipart/mixed; boundary=b\n\nCe message est au format MIME, d\xe9sol\xe9.\n--b\n\nhello\n--b--\n",
+			"Ce message est au format MIME, désolé.", "",
+		},
+		{"nested only", nestedMessage, "preamble", ""},
+		{"not a multipart", "Content-Type: text/plain\n\npreamble\n--b--\nepilogue\n", "", ""},
+	} {
+		m, errs := Parse(crlf(c.raw))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if got := m.Preamble(); got != c.preamble {
+			t.Errorf("%s: preamble %q, want %q", c.name, got, c.preamble)
+		}
+		if got := m.Epilogue(); got != c.epilogue {
+			t.Errorf("%s: epilogue %q, want %q", c.name, got, c.epilogue)
+		}
+	}
+}
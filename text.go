@@ -0,0 +1,111 @@
+// Normalization of the decoded text.
+
+package eml
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CleanText returns the text body normalized for display: line breaks
+// become LF, trailing whitespace is trimmed from every line, runs of three
+// or more blank lines are collapsed into a single one, and the leading and
+// trailing blank lines are removed. Text is left untouched.
+func (m Message) CleanText() string {
+	lines := strings.Split(strings.ReplaceAll(m.Text, "\r\n", "\n"), "\n")
+
+	var out []string
+	blanks := 0
+
+	// write the pending blank lines before a line with text
+	flush := func() {
+		if blanks >= 3 {
+			blanks = 1
+		}
+		if len(out) > 0 {
+			for ; blanks > 0; blanks-- {
+				out = append(out, "")
+			}
+		}
+		blanks = 0
+	}
+
+	for _, l := range lines {
+		l = strings.TrimRight(l, " \t\r")
+		if l == "" {
+			blanks++
+			continue
+		}
+
+		flush()
+		out = append(out, l)
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// attribution lines introducing a quote, such as "On Mon, Jan 2, 2006 at
+// 15:04, Alice <alice@example.com> wrote:", in the languages of the common
+// clients. Gmail wraps the long ones, so they are matched on two lines too
+var attributionR = regexp.MustCompile(`(?i)^\s*(on\s.+\swrote|le\s.+\sa\s+écrit|am\s.+\sschrieb.*|el\s.+\sescribió|il\s.+\sha\s+scritto|em\s.+\sescreveu|op\s.+\sschreef.*)\s*:\s*$`)
+
+// headers of the original message as quoted by Outlook, without ">"
+var outlookQuoteR = regexp.MustCompile(`(?i)^\s*\*?(from|de|von|da|van)\s*:\*?\s`)
+var outlookSentR = regexp.MustCompile(`(?i)^\s*\*?(sent|date|envoyé|gesendet|enviado|inviato|verzonden)\s*:\*?\s`)
+
+// signatures added by mobile clients, without a delimiter
+var mobileSignatureR = regexp.MustCompile(`(?i)^\s*(sent from my .+|get outlook for .+|sent from (yahoo )?mail for .+|enviado desde mi .+|envoyé de mon .+|von meinem .+ gesendet)\s*$`)
+
+// VisibleText returns the text written by the sender of a reply, without
+// the history it quotes: the quoted lines (starting with ">", at any
+// level), the attribution lines introducing them and the signature are
+// removed. The answers written between the quoted lines of an inline reply
+// are kept. The signature starts at the "-- " delimiter or at a mobile
+// signature such as "Sent from my iPhone", and the unquoted history that
+// Outlook appends after an "-----Original Message-----" line or a
+// From/Sent header block is dropped too. Text is left untouched.
+func (m Message) VisibleText() string {
+	lines := strings.Split(strings.ReplaceAll(m.Text, "\r\n", "\n"), "\n")
+
+	// check if the lines from j on start with a quote, blank lines aside,
+	// to tell an attribution line from text that happens to look like one
+	quoteFollows := func(j int) bool {
+		for ; j < len(lines); j++ {
+			if t := strings.TrimSpace(lines[j]); t != "" {
+				return strings.HasPrefix(t, ">")
+			}
+		}
+		return false
+	}
+
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		l := strings.TrimRight(lines[i], " \t\r")
+
+		if l == "--" || strings.TrimRight(lines[i], "\r") == "-- " || mobileSignatureR.MatchString(l) || forwardMarkerR.MatchString(l) {
+			break
+		}
+
+		// the header block of the message quoted by Outlook
+		if outlookQuoteR.MatchString(l) && i+1 < len(lines) && (outlookSentR.MatchString(lines[i+1]) || i+2 < len(lines) && outlookSentR.MatchString(lines[i+2])) {
+			break
+		}
+
+		if strings.HasPrefix(strings.TrimLeft(l, " \t"), ">") || attributionR.MatchString(l) && quoteFollows(i+1) {
+			continue
+		}
+		if i+1 < len(lines) && attributionR.MatchString(l+" "+strings.TrimSpace(lines[i+1])) && quoteFollows(i+2) {
+			i++
+			continue
+		}
+
+		// a blank line is only kept between two lines of text
+		if l == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+
+		out = append(out, l)
+	}
+
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
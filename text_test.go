@@ -0,0 +1,74 @@
+package eml
+
+import "testing"
+
+func TestVisibleText(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			"gmail quote",
+			"Sounds good, see you then.\n\nOn Mon, Oct 2, 2023 at 10:00 AM Alice <alice@example.com> wrote:\n> Lunch tomorrow?\n> Alice\n",
+			"Sounds good, see you then.",
+		},
+		{
+			"gmail wrapped attribution",
+			"Yes.\n\nOn Mon, Oct 2, 2023 at 10:00 AM Alice Longname <\nalice@example.com> wrote:\n\n> Are you coming?\n",
+			"Yes.",
+		},
+		{
+			"outlook quote",
+			"Thanks, done.\r\n\r\nFrom: Alice <alice@example.com>\r\nSent: Monday, October 2, 2023 10:00 AM\r\nTo: Bob\r\nSubject: task\r\n\r\nPlease do the task.\r\n",
+			"Thanks, done.",
+		},
+		{
+			"outlook original message",
+			"Thanks, done.\n\n-----Original Message-----\nFrom: Alice\nPlease do the task.\n",
+			"Thanks, done.",
+		},
+		{
+			"nested quotes",
+			"Agreed.\n\nOn Tue, Bob wrote:\n> Me too.\n>\n> On Mon, Alice wrote:\n>> I like it.\n>>> Earlier text\n",
+			"Agreed.",
+		},
+		{
+			"inline reply",
+			"On Mon, Alice wrote:\n> First question?\nFirst answer.\n\n> Second question?\nSecond answer.\n",
+			"First answer.\n\nSecond answer.",
+		},
+		{
+			"signature delimiter",
+			"See attached.\n\n-- \nBob Smith\nACME Corp\n",
+			"See attached.",
+		},
+		{
+			"mobile signature",
+			"On my way.\n\nSent from my iPhone\n\n> Where are you?\n",
+			"On my way.",
+		},
+		{
+			"attribution-like text without a quote",
+			"On Monday the team wrote:\nthe plan is ready.\n",
+			"On Monday the team wrote:\nthe plan is ready.",
+		},
+	} {
+		m := Message{Text: c.text}
+		if got := m.VisibleText(); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+		if m.Text != c.text {
+			t.Errorf("%s: Text changed", c.name)
+		}
+	}
+}
+
+func TestCleanText(t *testing.T) {
+	m := Message{Text: "\r\n\r\nfirst  \r\nsecond\t\r\n\r\n\r\n\r\n\r\nthird\r\n\r\nfourth\r\n\r\n"}
+
+	want := "first\nsecond\n\nthird\n\nfourth"
+	if got := m.CleanText(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
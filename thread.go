@@ -0,0 +1,274 @@
+// Conversation and threading helpers.
+
+package eml
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ConversationParticipants returns every distinct mailbox found on the From,
+// To and Cc headers of msgs, in the order they were first seen. Mailboxes
+// are canonicalized, so the same person written with a different case is
+// only listed once.
+func ConversationParticipants(msgs []Message) (participants []Address) {
+	seen := make(map[string]bool)
+
+	for _, m := range msgs {
+		for _, list := range [][]Address{m.From, m.To, m.Cc} {
+			for _, ma := range mailboxes(list) {
+				ma = canonicalMailbox(ma)
+				if ma.local == "" || seen[ma.Email()] {
+					continue
+				}
+
+				seen[ma.Email()] = true
+				participants = append(participants, ma)
+			}
+		}
+	}
+
+	return
+}
+
+// ReferencedIDs returns the ids of every message this one points at, the
+// References followed by the In-Reply-To ids missing from them, without
+// repetitions. These are the edges of the message on a thread graph.
+func (m Message) ReferencedIDs() (ids []string) {
+	seen := make(map[string]bool)
+
+	for _, list := range [][]string{m.References, m.InReply} {
+		for _, id := range list {
+			if id == "" || seen[id] {
+				continue
+			}
+
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return
+}
+
+// ThreadNode is a message of a thread built by BuildThreads, with its
+// replies as Children. Message is nil for the ghost nodes, the messages
+// referenced by others but missing from the set, which hold the thread
+// together.
+type ThreadNode struct {
+	Message  *Message
+	Parent   *ThreadNode
+	Children []*ThreadNode
+}
+
+// reply and forward prefixes of a subject, in the languages of the common
+// clients, with an optional counter (Re[2]:) and a full width colon
+var subjectPrefixR = regexp.MustCompile(`(?i)^\s*(?:re|fwd?|aw|wg|sv|vs|vb|antw|doorst|rif|tr|odp|pd|ynt|ilt|回复|回覆|答复|转发|轉寄)\s*(?:\[\d+\])?\s*[:：]\s*`)
+
+// a leading subject blob, such as a [list] tag, and the trailing (fwd)
+var subjectBlobR = regexp.MustCompile(`^\s*\[[^\[\]]*\]\s*`)
+var subjectFwdTrailerR = regexp.MustCompile(`(?i)\s*\(fwd\)\s*$`)
+
+// get the base subject of s, as defined by RFC5256 for threading, also
+// removing the reply and forward prefixes of other languages
+func baseSubject(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+
+	for {
+		prev := s
+
+		s = subjectFwdTrailerR.ReplaceAllString(s, "")
+
+		if loc := subjectPrefixR.FindStringIndex(s); loc != nil {
+			s = s[loc[1]:]
+		}
+
+		// a blob is removed when something is left after it
+		if loc := subjectBlobR.FindStringIndex(s); loc != nil && loc[1] < len(s) {
+			s = s[loc[1]:]
+		}
+
+		// the [fwd: subject] wrapper
+		if len(s) > 6 && strings.EqualFold(s[:5], "[fwd:") && s[len(s)-1] == ']' {
+			s = strings.TrimSpace(s[5 : len(s)-1])
+		}
+
+		if s == prev {
+			return s
+		}
+	}
+}
+
+// check if a subject has a reply or forward prefix
+func isReplySubject(s string) bool {
+	return baseSubject(s) != strings.Join(strings.Fields(s), " ")
+}
+
+// BaseSubject returns the subject without its reply and forward prefixes
+// (Re:, Fwd:, and their translations such as AW:, SV: or 回复：), however
+// many they are, nor the [list] tags preceding them, as RFC5256 defines the
+// base subject. Whitespace runs are collapsed to a single space.
+func (m Message) BaseSubject() string {
+	return baseSubject(m.Subject)
+}
+
+// check if n is o or one of its ancestors
+func (n *ThreadNode) isAncestorOf(o *ThreadNode) bool {
+	for ; o != nil; o = o.Parent {
+		if o == n {
+			return true
+		}
+	}
+	return false
+}
+
+// move n under p, or to the root when p is nil
+func (n *ThreadNode) setParent(p *ThreadNode) {
+	if n.Parent != nil {
+		siblings := n.Parent.Children
+		for i, c := range siblings {
+			if c == n {
+				n.Parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+
+	n.Parent = p
+	if p != nil {
+		p.Children = append(p.Children, n)
+	}
+}
+
+// subject of a thread root, taken from its first child for a ghost
+func (n *ThreadNode) subject() string {
+	if n.Message == nil && len(n.Children) > 0 {
+		n = n.Children[0]
+	}
+	if n.Message == nil {
+		return ""
+	}
+	return n.Message.Subject
+}
+
+// drop the ghosts without children and replace the others by their
+// children, but at the root, where a ghost holds several threads together
+func pruneGhosts(list []*ThreadNode, parent *ThreadNode) (kept []*ThreadNode) {
+	for _, n := range list {
+		n.Children = pruneGhosts(n.Children, n)
+
+		switch {
+		case n.Message != nil, parent == nil && len(n.Children) > 1:
+			kept = append(kept, n)
+		default:
+			for _, c := range n.Children {
+				c.Parent = parent
+			}
+			kept = append(kept, n.Children...)
+		}
+	}
+
+	return
+}
+
+// BuildThreads groups msgs in threads with the JWZ algorithm
+// (https://www.jwz.org/doc/threading.html) and returns their roots, in the
+// order the messages were first seen. A message is a reply to the last id
+// of its References, or to its In-Reply-To, and the References link the
+// messages they list to each other. Referenced messages missing from msgs
+// are ghost nodes, kept only when they join several replies. References
+// making a loop are ignored and a Message-ID seen twice is taken as a
+// different message. Finally, the threads whose roots have the same
+// base subject (see BaseSubject) are joined.
+func BuildThreads(msgs []Message) []*ThreadNode {
+	nodes := make(map[string]*ThreadNode)
+	var order []*ThreadNode
+
+	node := func(id string) *ThreadNode {
+		n, ok := nodes[id]
+		if !ok {
+			n = &ThreadNode{}
+			nodes[id] = n
+			order = append(order, n)
+		}
+		return n
+	}
+
+	for i := range msgs {
+		m := &msgs[i]
+
+		var n *ThreadNode
+		if old := nodes[m.MessageID]; m.MessageID == "" || (old != nil && old.Message != nil) {
+			n = &ThreadNode{}
+			order = append(order, n)
+		} else {
+			n = node(m.MessageID)
+		}
+		n.Message = m
+
+		refs := m.References
+		if len(refs) == 0 && len(m.InReply) > 0 {
+			refs = m.InReply[:1]
+		}
+
+		// the links between the references found first are kept
+		var prev *ThreadNode
+		for _, id := range refs {
+			r := node(id)
+			if prev != nil && r.Parent == nil && !r.isAncestorOf(prev) {
+				r.setParent(prev)
+			}
+			prev = r
+		}
+
+		// but the message itself knows its parent best
+		if prev != nil && !n.isAncestorOf(prev) {
+			n.setParent(prev)
+		}
+	}
+
+	var roots []*ThreadNode
+	for _, n := range order {
+		if n.Parent == nil {
+			roots = append(roots, n)
+		}
+	}
+	roots = pruneGhosts(roots, nil)
+
+	// join the threads with the same subject
+	var threads []*ThreadNode
+	bySubject := make(map[string]int)
+
+	for _, r := range roots {
+		subject := baseSubject(r.subject())
+		k, ok := bySubject[subject]
+		if subject == "" || !ok {
+			bySubject[subject] = len(threads)
+			threads = append(threads, r)
+			continue
+		}
+
+		o := threads[k]
+		oReply := o.Message != nil && isReplySubject(o.Message.Subject)
+		rReply := r.Message != nil && isReplySubject(r.Message.Subject)
+
+		switch {
+		case o.Message == nil && r.Message == nil:
+			for _, c := range append([]*ThreadNode{}, r.Children...) {
+				c.setParent(o)
+			}
+		case o.Message == nil, rReply && !oReply:
+			r.setParent(o)
+		case r.Message == nil, oReply && !rReply:
+			o.setParent(r)
+			threads[k] = r
+		default:
+			g := &ThreadNode{}
+			o.setParent(g)
+			r.setParent(g)
+			threads[k] = g
+		}
+	}
+
+	return threads
+}
@@ -0,0 +1,194 @@
+package eml
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReferencedIDs(t *testing.T) {
+	for _, c := range []struct {
+		name, headers string
+		want          []string
+	}{
+		{
+			"overlapping",
+			"References: <a@x> <b@x> <c@x>\nIn-Reply-To: <c@x>",
+			[]string{"a@x", "b@x", "c@x"},
+		},
+		{
+			"disjoint",
+			"References: <a@x> <b@x>\nIn-Reply-To: <d@x>",
+			[]string{"a@x", "b@x", "d@x"},
+		},
+		{
+			"in-reply-to only",
+			"In-Reply-To: <a@x> <b@x>",
+			[]string{"a@x", "b@x"},
+		},
+		{
+			"repeated references",
+			"References: <a@x> <b@x> <a@x>\nIn-Reply-To: <b@x> <e@x>",
+			[]string{"a@x", "b@x", "e@x"},
+		},
+		{
+			"own id not added",
+			"Message-ID: <self@x>\nReferences: <a@x>",
+			[]string{"a@x"},
+		},
+		{"none", "Subject: new thread", nil},
+	} {
+		m, errs := Parse(crlf(c.headers + "\n\nhi\n"))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if got := m.ReferencedIDs(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestBaseSubject(t *testing.T) {
+	for _, c := range []struct {
+		subject, want string
+	}{
+		{"hello", "hello"},
+		{"Re: hello", "hello"},
+		{"RE: Re: re: hello", "hello"},
+		{"Fwd: Fw: FW: hello", "hello"},
+		{"AW: WG: hallo", "hallo"},
+		{"SV: VS: hei", "hei"},
+		{"Antw: Doorst: hallo", "hallo"},
+		{"RIF: Tr: ciao", "ciao"},
+		{"回复：你好", "你好"},
+		{"回复: 转发：你好", "你好"},
+		{"Re[2]: Re [3] : hello", "hello"},
+		{"[list] Re: hello", "hello"},
+		{"Re: [list] Fwd: [other] hello", "hello"},
+		{"[Fwd: hello]", "hello"},
+		{"hello (fwd)", "hello"},
+		{"  Re:   spaced \t out  ", "spaced out"},
+		{"[list]", "[list]"},
+		{"Regarding: hello", "Regarding: hello"},
+		{"Re:", ""},
+	} {
+		if got := (Message{Subject: c.subject}).BaseSubject(); got != c.want {
+			t.Errorf("%q: base subject %q, want %q", c.subject, got, c.want)
+		}
+	}
+}
+
+// parse a message of a thread from its headers
+func threadMessage(t *testing.T, headers string) Message {
+	m, errs := Parse(crlf(headers + "\n\nhi\n"))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	return m
+}
+
+// render threads as their message ids, the children sorted in parentheses
+// and the ghosts as "-"
+func threadString(nodes []*ThreadNode) string {
+	var s []string
+	for _, n := range nodes {
+		id := "-"
+		if n.Message != nil {
+			id = strings.TrimSuffix(n.Message.MessageID, "@x")
+		}
+		for _, c := range n.Children {
+			if c.Parent != n {
+				id += "!"
+			}
+		}
+		if len(n.Children) > 0 {
+			id += "(" + threadString(n.Children) + ")"
+		}
+		s = append(s, id)
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
+
+func TestBuildThreads(t *testing.T) {
+	headers := []string{
+		"Message-ID: <1@x>\nSubject: Meeting on Friday",
+		"Message-ID: <2@x>\nSubject: Re: Meeting on Friday\nIn-Reply-To: <1@x>\nReferences: <1@x>",
+		"Message-ID: <3@x>\nSubject: RE: Meeting on Friday\nIn-Reply-To: <2@x>\nReferences: <1@x> <2@x>",
+		"Message-ID: <4@x>\nSubject: AW: Meeting on Friday\nIn-Reply-To: <1@x>",
+		"Message-ID: <5@x>\nSubject: Re: Re: Meeting on Friday\nReferences: <1@x> <2@x> <3@x>",
+		"Message-ID: <6@x>\nSubject: Fwd: Meeting on Friday",
+	}
+
+	var msgs []Message
+	for _, h := range headers {
+		msgs = append(msgs, threadMessage(t, h))
+	}
+
+	if got := threadString(BuildThreads(msgs)); got != "1(2(3(5)) 4 6)" {
+		t.Errorf("threads %s", got)
+	}
+
+	// the replies seen before the messages they answer
+	msgs = []Message{msgs[4], msgs[2], msgs[5], msgs[0], msgs[3], msgs[1]}
+	if got := threadString(BuildThreads(msgs)); got != "1(2(3(5)) 4 6)" {
+		t.Errorf("threads of the shuffled messages %s", got)
+	}
+}
+
+func TestBuildThreadsEdgeCases(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		headers []string
+		want    string
+	}{
+		{
+			"ghost joining replies",
+			[]string{
+				"Message-ID: <1@x>\nSubject: Re: lost\nReferences: <root@x>",
+				"Message-ID: <2@x>\nSubject: Re: other\nReferences: <root@x>",
+			},
+			"-(1 2)",
+		},
+		{
+			"ghost with a single reply",
+			[]string{"Message-ID: <1@x>\nSubject: Re: lost\nReferences: <root@x>"},
+			"1",
+		},
+		{
+			"circular references",
+			[]string{
+				"Message-ID: <1@x>\nSubject: a\nReferences: <2@x>",
+				"Message-ID: <2@x>\nSubject: b\nReferences: <1@x>",
+			},
+			"2(1)",
+		},
+		{
+			"duplicate message id",
+			[]string{
+				"Message-ID: <1@x>\nSubject: first",
+				"Message-ID: <1@x>\nSubject: second",
+			},
+			"1 1",
+		},
+		{
+			"same subject without references",
+			[]string{
+				"Message-ID: <1@x>\nSubject: Lunch",
+				"Message-ID: <2@x>\nSubject: Lunch",
+			},
+			"-(1 2)",
+		},
+	} {
+		var msgs []Message
+		for _, h := range c.headers {
+			msgs = append(msgs, threadMessage(t, h))
+		}
+
+		if got := threadString(BuildThreads(msgs)); got != c.want {
+			t.Errorf("%s: threads %s, want %s", c.name, got, c.want)
+		}
+	}
+}
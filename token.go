@@ -2,47 +2,127 @@ package eml
 
 import (
 	"bytes"
-	"errors"
-	"regexp"
 )
 
-// Regular expressions that correspond roughly to the syntax described by
-// RFC5322. We're a bit loose here, so we might succeed in parsing material
-// that the RFC considers invalid.
-var (
-	dotAtomR = regexp.MustCompile("^[a-zA-Z0-9!#$%&`*+\\-/=?^_'{|}~][a-zA-Z0-9.!#$%&`*+\\-/=?^_'{|}~]+")
-	atomR    = regexp.MustCompile("^[a-zA-Z0-9!#$%&`*+\\-/=?^_'{|}~]+")
-	specialR = regexp.MustCompile(`^[()<>\[\]:;@\,."]`)
-	qStringR = regexp.MustCompilePOSIX(`^"([^"]|\\")*"`)
-	uniCodes = regexp.MustCompile(`[^\x00-\x7F]+`)
-)
+// The tokenizer corresponds roughly to the syntax described by RFC5322.
+// We're a bit loose here, so we might succeed in parsing material that the
+// RFC considers invalid. It is a single pass over the input: each token is
+// identified by its first byte and consumed without looking past its end.
 
 type token []byte
 
-func try(re *regexp.Regexp, s []byte) int {
-	is := re.FindIndex(s)
-	if is == nil {
-		return 0
+// check if c is one of the specials of RFC5322
+func isSpecial(c byte) bool {
+	return bytes.IndexByte([]byte(`()<>[]:;@,."`), c) >= 0
+}
+
+// length of the (possibly nested) comment at the start of s, or 0 when the
+// comment is not closed
+func commentLen(s []byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// length of the quoted-string at the start of s, or 0 when it is not
+// closed. a quote preceded by a backslash may be escaped, so the longest
+// possible string is taken: up to the first quote that is not escaped, or
+// up to the last escaped one if the string is never closed otherwise. a
+// quoted-string never spans a line break
+func quotedLen(s []byte) int {
+	end := 0
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\n' {
+			break
+		}
+		if s[i] != '"' {
+			continue
+		}
+		if i > 1 && s[i-1] == '\\' {
+			end = i + 1
+			continue
+		}
+		return i + 1
 	}
-	if is[0] != 0 {
+	return end
+}
+
+// length of the RFC2047 encoded-word (=?charset?encoding?text?=) at the
+// start of s, or 0 when there is none. encoded-words are kept as single
+// tokens, since sloppy encoders leave specials in their text
+func encodedWordLen(s []byte) int {
+	if !bytes.HasPrefix(s, []byte("=?")) {
 		return 0
 	}
-	return is[1]
+
+	q := 0
+	for i := 2; i < len(s); i++ {
+		switch s[i] {
+		case ' ', '\t', '\r', '\n':
+			return 0
+		case '?':
+			if q++; q == 3 {
+				if i+1 < len(s) && s[i+1] == '=' {
+					return i + 2
+				}
+				return 0
+			}
+		}
+	}
+	return 0
+}
+
+// a comment is kept as a single token, parenthesis included
+func isComment(t token) bool {
+	return len(t) > 1 && t[0] == '('
 }
 
 func tokenize(s []byte) (ts []token, err error) {
-Next:
-	s = bytes.TrimSpace(s)
-	if len(s) == 0 {
-		return
-	}
-	for _, r := range []*regexp.Regexp{dotAtomR, atomR, uniCodes, qStringR, specialR} {
-		i := try(r, s)
-		if i > 0 {
-			ts = append(ts, s[0:i])
-			s = s[i:]
-			goto Next
+	for {
+		s = bytes.TrimSpace(s)
+		if len(s) == 0 {
+			return
 		}
+
+		i := 0
+		switch c := s[0]; {
+		case c == '(':
+			i = commentLen(s)
+			if i == 0 {
+				return nil, addressError("unbalanced comment", s[:1])
+			}
+		case c == '=' && encodedWordLen(s) > 0:
+			i = encodedWordLen(s)
+		case isAtext(c):
+			// atom or dot-atom, which may hold UTF-8 characters (RFC6532)
+			i = 1
+			for i < len(s) && (s[i] == '.' || isAtext(s[i])) {
+				i++
+			}
+		case c == '"':
+			i = quotedLen(s)
+			if i == 0 {
+				i = 1 // lone quote, as a special
+			}
+		case isSpecial(c):
+			i = 1
+		default:
+			return nil, addressError("unidentifiable token", s[:1])
+		}
+
+		ts = append(ts, s[0:i])
+		s = s[i:]
 	}
-	return nil, errors.New("unidentifiable token")
 }
@@ -0,0 +1,249 @@
+// Trace and delivery headers.
+
+package eml
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"time"
+)
+
+// SPFResult is the outcome of an SPF check, as recorded by a Received-SPF
+// header (RFC7208 9.1)
+type SPFResult struct {
+	Result     string            // pass, fail, softfail, neutral, none, temperror or permerror
+	Comment    string            // comment following the result, without its parenthesis
+	Properties map[string]string // such as client-ip, envelope-from and helo, keyed in lowercase
+}
+
+// get the timestamp of a Received header, written after its last ";"
+func receivedDate(v string) (time.Time, bool) {
+	i := strings.LastIndexByte(v, ';')
+	if i < 0 {
+		return time.Time{}, false
+	}
+
+	return parseDate(v[i+1:])
+}
+
+// DeliveryTarget returns the address the message was delivered to, telling
+// which alias received it. It prefers X-Original-To, then the first
+// (most recent) Delivered-To, then the envelope recipient recorded by the
+// MTA in Envelope-To.
+func (m Message) DeliveryTarget() (Address, bool) {
+	if boxes := mailboxes(m.OriginalTo); len(boxes) > 0 {
+		return boxes[0], true
+	}
+
+	for _, key := range []string{"Delivered-To", "Envelope-To"} {
+		for _, v := range m.header(key) {
+			if a, err := parseAddressList([]byte(v)); err == nil {
+				if boxes := mailboxes(a); len(boxes) > 0 {
+					return boxes[0], true
+				}
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// parse a Received-SPF header value: a result, an optional comment and a
+// list of key=value properties separated by ";"
+func parseReceivedSPF(v string) (r SPFResult) {
+	s := bytes.TrimSpace([]byte(v))
+	r.Properties = make(map[string]string)
+
+	n := bytes.IndexAny(s, " \t\r\n(;")
+	if n < 0 {
+		n = len(s)
+	}
+	r.Result = strings.ToLower(string(s[:n]))
+	s = bytes.TrimSpace(s[n:])
+
+	if len(s) > 0 && s[0] == '(' {
+		if l := commentLen(s); l > 0 {
+			r.Comment = string(s[1 : l-1])
+			s = s[l:]
+		} else {
+			r.Comment = string(s[1:])
+			s = nil
+		}
+	}
+
+	for {
+		s = bytes.TrimLeft(s, " \t\r\n;")
+
+		eq := bytes.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(string(bytes.TrimSpace(s[:eq])))
+		s = bytes.TrimLeft(s[eq+1:], " \t\r\n")
+
+		var value string
+		if l := quotedLen(s); len(s) > 0 && s[0] == '"' && l > 0 {
+			value = strings.ReplaceAll(string(s[1:l-1]), `\"`, `"`)
+			s = s[l:]
+		} else {
+			e := bytes.IndexAny(s, " \t\r\n;")
+			if e < 0 {
+				e = len(s)
+			}
+			value = string(s[:e])
+			s = s[e:]
+		}
+
+		// a trailing comment is not a property
+		if key != "" && !strings.ContainsAny(key, " \t(") {
+			r.Properties[key] = value
+		}
+	}
+
+	return
+}
+
+// ReceivedSPF returns the SPF checks recorded by the Received-SPF headers,
+// the most recent (the topmost header) first, one for each hop that checked
+// the sender.
+func (m Message) ReceivedSPF() (results []SPFResult) {
+	for _, v := range m.header("Received-SPF") {
+		results = append(results, parseReceivedSPF(v))
+	}
+
+	return
+}
+
+// ReceivedHop is a hop of the path of the message, as recorded by a
+// Received header (RFC5321 4.4). The clauses missing from the header are
+// left empty.
+type ReceivedHop struct {
+	From        string    // name the sending host gave (HELO), or its address literal
+	FromComment string    // TCP-info comment of the from clause, e.g. "host.example.com [192.0.2.1]"
+	FromIP      string    // address of the sending host, from its literal or comment
+	By          string    // host receiving the message
+	Via         string    // link type, rarely used
+	With        string    // protocol, such as SMTP, ESMTPS or LMTP
+	ID          string    // queue id given by the receiving host
+	For         string    // recipient of the message, without angle brackets
+	Timestamp   time.Time // date after the last ";", zero when missing or unparsable
+}
+
+// keywords of the clauses of a Received header
+var receivedClauses = map[string]bool{
+	"from": true,
+	"by":   true,
+	"via":  true,
+	"with": true,
+	"id":   true,
+	"for":  true,
+}
+
+// get the address found in a bracketed literal ([192.0.2.1] or
+// [IPv6:2001:db8::1]) of s, the last one when there are several
+func addressLiteral(s string) string {
+	e := strings.LastIndexByte(s, ']')
+	if e < 0 {
+		return ""
+	}
+	b := strings.LastIndexByte(s[:e], '[')
+	if b < 0 {
+		return ""
+	}
+
+	ip := s[b+1 : e]
+	if len(ip) > 5 && strings.EqualFold(ip[:5], "ipv6:") {
+		ip = ip[5:]
+	}
+	return ip
+}
+
+// parse a Received header value, clause by clause. the comments are
+// skipped, but the one of the from clause, and the words following the
+// value of the with clause (with Microsoft SMTP Server) are kept in it
+func parseReceived(v string) (hop ReceivedHop) {
+	hop.Timestamp, _ = receivedDate(v)
+	if i := strings.LastIndexByte(v, ';'); i >= 0 {
+		v = v[:i]
+	}
+
+	s := []byte(v)
+	clause, expect := "", false
+
+	for {
+		s = bytes.TrimLeft(s, " \t\r\n")
+		if len(s) == 0 {
+			break
+		}
+
+		if s[0] == '(' {
+			l := commentLen(s)
+			if l == 0 {
+				l = len(s)
+			}
+			if clause == "from" && hop.FromComment == "" {
+				hop.FromComment = strings.TrimSpace(strings.TrimSuffix(string(s[1:l]), ")"))
+			}
+			s = s[l:]
+			continue
+		}
+
+		n := bytes.IndexAny(s, " \t\r\n(")
+		if n < 0 {
+			n = len(s)
+		}
+		word := string(s[:n])
+		s = s[n:]
+
+		if lw := strings.ToLower(word); receivedClauses[lw] && (!expect || clause == "") {
+			clause, expect = lw, true
+			continue
+		}
+
+		if !expect {
+			if clause == "with" {
+				hop.With += " " + word
+			}
+			continue
+		}
+		expect = false
+
+		switch clause {
+		case "from":
+			hop.From = word
+		case "by":
+			hop.By = word
+		case "via":
+			hop.Via = word
+		case "with":
+			hop.With = word
+		case "id":
+			hop.ID = strings.Trim(word, "<>")
+		case "for":
+			hop.For = strings.Trim(word, "<>")
+		}
+	}
+
+	// Exchange writes the bare address as the comment
+	hop.FromIP = addressLiteral(hop.From)
+	if hop.FromIP == "" {
+		hop.FromIP = addressLiteral(hop.FromComment)
+	}
+	if hop.FromIP == "" && net.ParseIP(hop.FromComment) != nil {
+		hop.FromIP = hop.FromComment
+	}
+
+	return
+}
+
+// ReceivedChain returns the hops recorded by the Received headers, the most
+// recent (the topmost header) first, down to the host that first received
+// the message.
+func (m Message) ReceivedChain() (hops []ReceivedHop) {
+	for _, v := range m.header("Received") {
+		hops = append(hops, parseReceived(v))
+	}
+
+	return
+}
@@ -0,0 +1,163 @@
+package eml
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReceivedChain(t *testing.T) {
+	raw := "Received: from mail-wr1-x42b.google.com (mail-wr1-x42b.google.com [IPv6:2a00:1450:4864:20::42b])\n" +
+		"\tby mx.example.com (Postfix) with ESMTPS id 4S0Qk02Zx9z9sRk\n" +
+		"\tfor <bob@example.com>; Mon, 2 Oct 2023 10:00:02 +0000 (UTC)\n" +
+		"Received: by mail-wr1-x42b.google.com with SMTP id ffacd0b85a97d-32320381a07so1234567f8f.0\n" +
+		"        for <bob@example.com>; Mon, 02 Oct 2023 03:00:01 -0700 (PDT)\n" +
+		"Received: from [192.0.2.7] (helo=laptop) by relay.example.net with esmtpsa (TLS1.3) (Exim 4.96);\n" +
+		" Mon, 2 Oct 2023 09:59:59 +0000\n" +
+		"Received: from localhost (localhost [127.0.0.1]) by relay.example.net; not a date\n" +
+		"Subject: hi\n\nbody\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := []ReceivedHop{
+		{
+			From:        "mail-wr1-x42b.google.com",
+			FromComment: "mail-wr1-x42b.google.com [IPv6:2a00:1450:4864:20::42b]",
+			FromIP:      "2a00:1450:4864:20::42b",
+			By:          "mx.example.com",
+			With:        "ESMTPS",
+			ID:          "4S0Qk02Zx9z9sRk",
+			For:         "bob@example.com",
+			Timestamp:   time.Date(2023, 10, 2, 10, 0, 2, 0, time.UTC),
+		},
+		{
+			By:        "mail-wr1-x42b.google.com",
+			With:      "SMTP",
+			ID:        "ffacd0b85a97d-32320381a07so1234567f8f.0",
+			For:       "bob@example.com",
+			Timestamp: time.Date(2023, 10, 2, 10, 0, 1, 0, time.UTC),
+		},
+		{
+			From:        "[192.0.2.7]",
+			FromComment: "helo=laptop",
+			FromIP:      "192.0.2.7",
+			By:          "relay.example.net",
+			With:        "esmtpsa",
+			Timestamp:   time.Date(2023, 10, 2, 9, 59, 59, 0, time.UTC),
+		},
+		{
+			From:        "localhost",
+			FromComment: "localhost [127.0.0.1]",
+			FromIP:      "127.0.0.1",
+			By:          "relay.example.net",
+		},
+	}
+
+	hops := m.ReceivedChain()
+	if len(hops) != len(want) {
+		t.Fatalf("got %d hops, want %d", len(hops), len(want))
+	}
+	for i, h := range hops {
+		w := want[i]
+		if !h.Timestamp.Equal(w.Timestamp) {
+			t.Errorf("hop %d: timestamp %v, want %v", i, h.Timestamp, w.Timestamp)
+		}
+		h.Timestamp, w.Timestamp = time.Time{}, time.Time{}
+		if h != w {
+			t.Errorf("hop %d:\n got %+v\nwant %+v", i, h, w)
+		}
+	}
+}
+
+func TestDeliveryTarget(t *testing.T) {
+	for _, c := range []struct {
+		name, headers, want string
+	}{
+		{
+			"x-original-to first",
+			"Delivered-To: box@example.com\nX-Original-To: Alias@Example.com\nEnvelope-To: env@example.com\n",
+			"Alias@Example.com",
+		},
+		{
+			"most recent delivered-to",
+			"Delivered-To: box@example.com\nDelivered-To: alias@example.com\nEnvelope-To: env@example.com\n",
+			"box@example.com",
+		},
+		{
+			"envelope-to",
+			"Envelope-To: env@example.com\n",
+			"env@example.com",
+		},
+		{
+			"invalid delivered-to skipped",
+			"Delivered-To: not an address\nEnvelope-To: env@example.com\n",
+			"env@example.com",
+		},
+		{"none", "To: bob@example.com\n", ""},
+	} {
+		m, errs := Parse(crlf("Subject: hi\n" + c.headers + "\nbody\n"))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		a, ok := m.DeliveryTarget()
+		if ok != (c.want != "") || ok && a.Email() != c.want {
+			t.Errorf("%s: %v, %v, want %q", c.name, a, ok, c.want)
+		}
+	}
+}
+
+func TestOriginalTo(t *testing.T) {
+	m, errs := Parse(crlf("X-Original-To: a@example.com, b@example.com\n\nbody\n"))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if len(m.OriginalTo) != 2 || m.OriginalTo[0].Email() != "a@example.com" || m.OriginalTo[1].Email() != "b@example.com" {
+		t.Errorf("OriginalTo = %v", m.OriginalTo)
+	}
+}
+
+func TestReceivedSPF(t *testing.T) {
+	raw := "Received-SPF: Pass (mx.example.com: domain of alice@example.org designates 192.0.2.1 as permitted sender)\n" +
+		"\treceiver=mx.example.com; client-ip=192.0.2.1; envelope-from=\"alice@example.org\";\n" +
+		"\thelo=mail.example.org;\n" +
+		"Received-SPF: softfail (relay.example.net: transitioning domain of example.org does not designate 198.51.100.7 as permitted sender) client-ip=198.51.100.7; envelope-from=alice@example.org; helo=relay\n" +
+		"Received-SPF: none\n" +
+		"Subject: hi\n\nbody\n"
+
+	m, errs := Parse(crlf(raw))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := []SPFResult{
+		{
+			Result:  "pass",
+			Comment: "mx.example.com: domain of alice@example.org designates 192.0.2.1 as permitted sender",
+			Properties: map[string]string{
+				"receiver":      "mx.example.com",
+				"client-ip":     "192.0.2.1",
+				"envelope-from": "alice@example.org",
+				"helo":          "mail.example.org",
+			},
+		},
+		{
+			Result:  "softfail",
+			Comment: "relay.example.net: transitioning domain of example.org does not designate 198.51.100.7 as permitted sender",
+			Properties: map[string]string{
+				"client-ip":     "198.51.100.7",
+				"envelope-from": "alice@example.org",
+				"helo":          "relay",
+			},
+		},
+		{Result: "none", Properties: map[string]string{}},
+	}
+
+	if got := m.ReceivedSPF(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ReceivedSPF\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+// Decoding of the legacy uuencode transfer encoding.
+
+package eml
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// decode uuencoded data: an optional "begin mode name" line, lines starting
+// with their decoded length, and an "end" line. both the space and the
+// backquote stand for zero
+func decodeUU(data []byte) ([]byte, error) {
+	return io.ReadAll(newUUReader(bytes.NewReader(data)))
+}
+
+// uuReader decodes uuencoded data a line at a time, as decodeUU describes
+type uuReader struct {
+	r     *bufio.Reader
+	buf   []byte // decoded bytes not read yet
+	begun bool
+	err   error // returned once buf is read
+}
+
+func newUUReader(r io.Reader) io.Reader {
+	return &uuReader{r: bufio.NewReader(r)}
+}
+
+func (u *uuReader) Read(p []byte) (int, error) {
+	for len(u.buf) == 0 && u.err == nil {
+		u.decodeLine()
+	}
+
+	n := copy(p, u.buf)
+	u.buf = u.buf[n:]
+	if len(u.buf) == 0 {
+		return n, u.err
+	}
+
+	return n, nil
+}
+
+// decode the next line into buf, setting err at the end of the data
+func (u *uuReader) decodeLine() {
+	line, err := u.r.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		u.err = err
+		return
+	}
+	if err == io.EOF {
+		defer func() {
+			switch {
+			case u.err != nil:
+			case u.begun:
+				u.err = errors.New("uuencoded data without end line")
+			default:
+				u.err = io.EOF
+			}
+		}()
+	}
+	line = bytes.TrimRight(bytes.TrimSuffix(line, []byte("\n")), "\r")
+
+	switch {
+	case !u.begun && bytes.HasPrefix(line, []byte("begin ")):
+		u.begun = true
+		return
+	case bytes.Equal(bytes.TrimSpace(line), []byte("end")):
+		u.err = io.EOF
+		return
+	case len(line) == 0:
+		return
+	}
+
+	n := int(line[0]-' ') & 63
+	if n == 0 {
+		return
+	}
+
+	line = line[1:]
+	if len(line) < (n+2)/3*4 {
+		// trailing spaces may have been trimmed by a gateway
+		line = append(line, bytes.Repeat([]byte(" "), (n+2)/3*4-len(line))...)
+	}
+
+	out := make([]byte, 0, (n+2)/3*3)
+	for i := 0; i+3 < len(line) && len(out) < n; i += 4 {
+		c0, c1, c2, c3 := (line[i]-' ')&63, (line[i+1]-' ')&63, (line[i+2]-' ')&63, (line[i+3]-' ')&63
+		out = append(out, c0<<2|c1>>4, c1<<4|c2>>2, c2<<6|c3)
+	}
+
+	if len(out) < n {
+		u.buf, u.err = out, errors.New("truncated uuencoded line")
+		return
+	}
+	u.buf = out[:n]
+}
@@ -0,0 +1,149 @@
+// Address validation.
+
+package eml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// check if c is an atext character of RFC5322. bytes of UTF-8 sequences are
+// accepted too, as allowed by RFC6532
+func isAtext(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c >= 0x80:
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0
+}
+
+// validate a dot-atom: atoms of atext separated by single dots
+func validateDotAtom(s, what string) error {
+	if strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".") {
+		return fmt.Errorf("%s %q starts or ends with a dot", what, s)
+	}
+
+	if strings.Contains(s, "..") {
+		return fmt.Errorf("%s %q has consecutive dots", what, s)
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '.' && !isAtext(s[i]) {
+			return fmt.Errorf("%s %q has the invalid character %q", what, s, s[i])
+		}
+	}
+
+	return nil
+}
+
+// validate a quoted-string, checking that its quotes are balanced
+func validateQuoted(s, what string) error {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return fmt.Errorf("%s %q has unbalanced quotes", what, s)
+	}
+
+	for i := 1; i < len(s)-1; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s)-1 {
+				return fmt.Errorf("%s %q has unbalanced quotes", what, s)
+			}
+		case '"':
+			return fmt.Errorf("%s %q has unbalanced quotes", what, s)
+		case '\r', '\n':
+			return fmt.Errorf("%s %q has a line break", what, s)
+		}
+	}
+
+	return nil
+}
+
+// validate an addr-spec (local@domain)
+func validateAddrSpec(s string) error {
+	at := strings.LastIndexByte(s, '@')
+	if at < 0 {
+		return fmt.Errorf("address %q is missing the @", s)
+	}
+
+	local, domain := s[:at], s[at+1:]
+
+	switch {
+	case local == "":
+		return fmt.Errorf("address %q has an empty local part", s)
+	case strings.HasPrefix(local, `"`) || strings.HasSuffix(local, `"`):
+		if err := validateQuoted(local, "local part"); err != nil {
+			return err
+		}
+	default:
+		if err := validateDotAtom(local, "local part"); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case domain == "":
+		return fmt.Errorf("address %q has an empty domain", s)
+	case strings.HasPrefix(domain, "["):
+		if !strings.HasSuffix(domain, "]") || strings.ContainsAny(domain[1:len(domain)-1], "[]\\") {
+			return fmt.Errorf("domain literal %q is invalid", domain)
+		}
+	default:
+		if err := validateDotAtom(domain, "domain"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateAddress checks that s is a single syntactically valid mailbox, as
+// defined by RFC5322: an addr-spec (local@domain) or a display name followed
+// by an addr-spec in angle brackets. The returned error describes the first
+// violation found.
+func ValidateAddress(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return errors.New("empty address")
+	}
+
+	if !strings.HasSuffix(s, ">") {
+		if strings.ContainsAny(s, "<>") {
+			return fmt.Errorf("address %q has unbalanced angle brackets", s)
+		}
+		return validateAddrSpec(s)
+	}
+
+	lt := strings.LastIndexByte(s, '<')
+	if lt < 0 {
+		return fmt.Errorf("address %q has unbalanced angle brackets", s)
+	}
+
+	// the display name must be a phrase: words made of atoms and quoted
+	// strings (dots are tolerated, as obsolete phrases allow them)
+	if name := strings.TrimSpace(s[:lt]); name != "" {
+		if strings.Count(name, `"`)-strings.Count(name, `\"`) == 1 {
+			return fmt.Errorf("display name %q has unbalanced quotes", name)
+		}
+
+		toks, err := tokenize([]byte(name))
+		if err != nil {
+			return fmt.Errorf("display name %q is invalid: %v", name, err)
+		}
+
+		for _, t := range toks {
+			if t[0] == '"' {
+				if err := validateQuoted(string(t), "display name"); err != nil {
+					return err
+				}
+			} else if len(t) == 1 && t[0] != '.' && !isAtext(t[0]) {
+				return fmt.Errorf("display name %q has the special character %q", name, t[0])
+			}
+		}
+	}
+
+	return validateAddrSpec(strings.TrimSpace(s[lt+1 : len(s)-1]))
+}
@@ -0,0 +1,61 @@
+package eml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	for _, s := range []string{
+		"jdoe@example.com",
+		"john.q.public@example.com",
+		"Joe Q. Public <john.q.public@example.com>",
+		`"Doe, John" <jdoe@example.com>`,
+		`"Giant; \"Big\" Box" <sysservices@example.net>`,
+		"<jdoe@example.com>",
+		`"john..doe"@example.com`,
+		`"quoted @ at"@example.com`,
+		"user+tag@example.com",
+		"!#$%&'*+-/=?^_`{|}~@example.com",
+		"jdoe@[192.0.2.1]",
+		"jdoe@[IPv6:2001:db8::1]",
+		"müller@bücher.de",
+		"  jdoe@example.com  ",
+	} {
+		if err := ValidateAddress(s); err != nil {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+}
+
+func TestValidateAddressInvalid(t *testing.T) {
+	for _, c := range []struct {
+		in, err string
+	}{
+		{"", "empty address"},
+		{"jdoe.example.com", "missing the @"},
+		{"@example.com", "empty local part"},
+		{"jdoe@", "empty domain"},
+		{".jdoe@example.com", "starts or ends with a dot"},
+		{"jdoe.@example.com", "starts or ends with a dot"},
+		{"john..doe@example.com", "consecutive dots"},
+		{"jdoe@example..com", "consecutive dots"},
+		{"j doe@example.com", "invalid character"},
+		{"jdoe@exa(mple.com", "invalid character"},
+		{`"jdoe@example.com`, "unbalanced quotes"},
+		{`"j"doe"@example.com`, "unbalanced quotes"},
+		{`"Doe, John <jdoe@example.com>`, "unbalanced quotes"},
+		{"jdoe@[192.0.2.1", "domain literal"},
+		{"jdoe@example.com>", "unbalanced angle brackets"},
+		{"Joe <jdoe@example.com", "unbalanced angle brackets"},
+		{"Doe, John <jdoe@example.com>", "special character"},
+		{"a@example.com, b@example.com", "invalid character"},
+	} {
+		err := ValidateAddress(c.in)
+		if err == nil {
+			t.Errorf("%q: no error", c.in)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: %v, want %q", c.in, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Incremental writing of multipart messages.
+
+package eml
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// Writer assembles a MIME multipart message on an io.Writer. The top-level
+// headers are set first, then each part is streamed with CreatePart or
+// CreateAttachment, so large attachments never need to be held in memory.
+// Close must be called to write the closing boundary.
+type Writer struct {
+	w       io.Writer
+	mw      *multipart.Writer
+	headers [][2]string
+	started bool
+	part    io.Closer // encoder of the part being written, if any
+}
+
+// NewWriter returns a Writer writing a multipart/mixed message to w, with a
+// random boundary
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, mw: multipart.NewWriter(w)}
+}
+
+// Boundary returns the boundary separating the message parts
+func (w *Writer) Boundary() string {
+	return w.mw.Boundary()
+}
+
+// SetHeader sets a top-level header, replacing the previous values of key.
+// Non-ASCII values are RFC2047 encoded. Setting a multipart Content-Type
+// (e.g. multipart/alternative) changes the type of the message, with the
+// boundary added by the Writer.
+func (w *Writer) SetHeader(key, value string) error {
+	if w.started {
+		return errors.New("headers already written")
+	}
+
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	for i := 0; i < len(w.headers); i++ {
+		if w.headers[i][0] == key {
+			w.headers = append(w.headers[:i], w.headers[i+1:]...)
+			i--
+		}
+	}
+
+	return w.AddHeader(key, value)
+}
+
+// AddHeader adds a top-level header, keeping the previous values of key
+func (w *Writer) AddHeader(key, value string) error {
+	if w.started {
+		return errors.New("headers already written")
+	}
+
+	w.headers = append(w.headers, [2]string{textproto.CanonicalMIMEHeaderKey(key), value})
+
+	return nil
+}
+
+// write the top-level headers, once, before the first part
+func (w *Writer) writeHeaders() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	ct := "multipart/mixed"
+	for _, h := range w.headers {
+		switch h[0] {
+		case "Content-Type":
+			if mt, _, err := mime.ParseMediaType(h[1]); err == nil && strings.HasPrefix(mt, "multipart/") {
+				ct = mt
+			}
+			continue
+		case "Mime-Version", "Content-Transfer-Encoding":
+			continue
+		}
+
+		if err := writeHeader(w.w, h[0], h[1]); err != nil {
+			return err
+		}
+	}
+
+	if err := writeHeader(w.w, "MIME-Version", "1.0"); err != nil {
+		return err
+	}
+
+	if err := writeHeader(w.w, "Content-Type", mime.FormatMediaType(ct, map[string]string{"boundary": w.Boundary()})); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w.w, "\r\n")
+
+	return err
+}
+
+// finish the encoding of the part being written
+func (w *Writer) closePart() (err error) {
+	if w.part != nil {
+		err = w.part.Close()
+		w.part = nil
+	}
+	return
+}
+
+// CreatePart starts a new part with the given headers. The returned writer
+// receives the part body as is, so it must already be transfer encoded as
+// declared by the headers.
+func (w *Writer) CreatePart(header textproto.MIMEHeader) (io.Writer, error) {
+	if err := w.writeHeaders(); err != nil {
+		return nil, err
+	}
+
+	if err := w.closePart(); err != nil {
+		return nil, err
+	}
+
+	return w.mw.CreatePart(header)
+}
+
+// CreateAttachment starts a new attachment part. The data written to the
+// returned writer is base64 encoded on the fly.
+func (w *Writer) CreateAttachment(filename, mimeType string) (io.Writer, error) {
+	pw, err := w.CreatePart(attachmentHeader(filename, mimeType, "attachment"))
+	if err != nil {
+		return nil, err
+	}
+
+	enc := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: pw})
+	w.part = enc
+
+	return enc, nil
+}
+
+// Close finishes the last part and writes the closing boundary
+func (w *Writer) Close() error {
+	if err := w.writeHeaders(); err != nil {
+		return err
+	}
+
+	if err := w.closePart(); err != nil {
+		return err
+	}
+
+	return w.mw.Close()
+}
@@ -0,0 +1,129 @@
+package eml
+
+import (
+	"bytes"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var b bytes.Buffer
+
+	w := NewWriter(&b)
+	w.SetHeader("From", "Zoë <zoe@example.com>")
+	w.SetHeader("To", "bob@example.com")
+	w.SetHeader("Subject", "café report")
+	w.AddHeader("X-Tag", "one")
+	w.AddHeader("X-Tag", "two")
+
+	pw, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Write([]byte("see the attachment"))
+
+	data := bytes.Repeat([]byte{0, 1, 2, 0xff, 'x'}, 10000)
+	aw, err := w.CreateAttachment("report.bin", "application/octet-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// streamed in chunks not aligned with the base64 groups
+	for i := 0; i < len(data); i += 1001 {
+		aw.Write(data[i:min(i+1001, len(data))])
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range strings.Split(b.String(), "\r\n") {
+		if len(l) > 78 {
+			t.Fatalf("line of %d characters: %q", len(l), l)
+		}
+	}
+
+	m, errs := Parse(b.Bytes())
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if m.Subject != "café report" {
+		t.Errorf("Subject = %q", m.Subject)
+	}
+	if len(m.From) != 1 || m.From[0].Name() != "Zoë" {
+		t.Errorf("From = %v", m.From)
+	}
+	if got := m.ParsedHeaders["X-Tag"]; len(got) != 2 {
+		t.Errorf("X-Tag = %q", got)
+	}
+	if m.Text != "see the attachment" {
+		t.Errorf("Text = %q", m.Text)
+	}
+	if len(m.Attachments) != 1 {
+		t.Fatalf("%d attachments", len(m.Attachments))
+	}
+	if a := m.Attachments[0]; a.Filename != "report.bin" || !bytes.Equal(a.Data, data) {
+		t.Errorf("attachment %q of %d bytes", a.Filename, len(a.Data))
+	}
+	if !strings.Contains(m.ParsedHeaders["Content-Type"][0], w.Boundary()) {
+		t.Errorf("Content-Type %q without the boundary", m.ParsedHeaders["Content-Type"])
+	}
+}
+
+func TestWriterAlternative(t *testing.T) {
+	var b bytes.Buffer
+
+	w := NewWriter(&b)
+	w.SetHeader("Content-Type", "text/plain")
+	w.SetHeader("Content-Type", "multipart/alternative")
+
+	for _, p := range []struct{ ct, body string }{
+		{"text/plain", "hello"},
+		{"text/html", "<p>hello</p>"},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {p.ct}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pw.Write([]byte(p.body))
+	}
+
+	if err := w.SetHeader("Subject", "late"); err == nil {
+		t.Error("no error setting a header after the first part")
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, errs := Parse(b.Bytes())
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if got := m.ParsedHeaders["Content-Type"]; len(got) != 1 || !strings.HasPrefix(got[0], "multipart/alternative;") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if m.Text != "hello" || m.Html != "<p>hello</p>" {
+		t.Errorf("Text = %q, Html = %q", m.Text, m.Html)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var b bytes.Buffer
+
+	w := NewWriter(&b)
+	w.SetHeader("Subject", "nothing")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, errs := Parse(b.Bytes())
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if m.Subject != "nothing" || len(m.Attachments) != 0 {
+		t.Errorf("Subject %q, %d attachments", m.Subject, len(m.Attachments))
+	}
+}